@@ -0,0 +1,168 @@
+package fssync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/Gleipnir-Technology/fieldseeker-sync/database"
+	"github.com/google/uuid"
+)
+
+// How far the actual duration can be from what the client reported before we flag it.
+// We allow whichever is larger.
+const (
+	probeDurationTolerance        = 2.0
+	probeDurationTolerancePercent = 0.1
+)
+
+// The parts of ffprobe's JSON output that we use
+type ffprobeOutput struct {
+	Format struct {
+		Duration string `json:"duration"`
+	} `json:"format"`
+	Streams []struct {
+		Channels   int    `json:"channels"`
+		CodecName  string `json:"codec_name"`
+		CodecType  string `json:"codec_type"`
+		SampleRate string `json:"sample_rate"`
+	} `json:"streams"`
+}
+
+// errAudioUnusable means the upload can't be processed and the client needs to send it again
+var errAudioUnusable = errors.New("audio upload is empty or corrupt")
+
+// probeAudio records the metadata of the raw upload for a note. It returns errAudioUnusable
+// if there's no point processing the upload further.
+func probeAudio(ctx context.Context, ws *workspace, audioUUID uuid.UUID) error {
+	note, err := database.NoteAudioGetLatest(ctx, audioUUID.String())
+	if err != nil {
+		return fmt.Errorf("Failed to get note %s: %v", audioUUID, err)
+	}
+	var reported *float32
+	if note.Duration.IsValue() {
+		d := note.Duration.MustGet()
+		reported = &d
+	}
+	probe, err := probeAudioFile(ctx, ws, audioUUID, "raw", AudioFileContentKeyRaw(audioUUID.String()), reported)
+	if err != nil || probe == nil {
+		return err
+	}
+	if probe.Problem != nil && *probe.Problem != database.AudioFileProblemDurationMismatch {
+		return errAudioUnusable
+	}
+	return nil
+}
+
+// probeAudioDerivatives records the metadata of each file we produced from the raw upload
+func probeAudioDerivatives(ctx context.Context, ws *workspace, audioUUID uuid.UUID) error {
+	keys := map[string]string{
+		"normalized": AudioFileContentKeyNormalized(audioUUID.String()),
+	}
+	profiles, err := generatedAudioProfiles()
+	if err != nil {
+		return err
+	}
+	for _, profile := range profiles {
+		keys[profile.Extension] = profile.Key(audioUUID.String())
+	}
+	for variant, key := range keys {
+		if _, err := probeAudioFile(ctx, ws, audioUUID, variant, key, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// probeAudioFile runs ffprobe on a single file and saves the result. When reported is set
+// the actual duration is compared to it. Files that don't exist are skipped.
+func probeAudioFile(ctx context.Context, ws *workspace, audioUUID uuid.UUID, variant string, key string, reported *float32) (*database.AudioFileProbe, error) {
+	info, err := userFiles.Stat(ctx, key)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("%s doesn't exist, skipping probe", key)
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	probe := &database.AudioFileProbe{
+		NoteAudioUUID: audioUUID.String(),
+		Probed:        time.Now(),
+		Size:          info.Size,
+		Variant:       variant,
+	}
+	path, err := ws.Fetch(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size == 0 {
+		setProbeProblem(probe, database.AudioFileProblemEmpty)
+	} else if err := runFFprobe(ctx, path, probe); err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		message := err.Error()
+		probe.ProbeError = &message
+		setProbeProblem(probe, database.AudioFileProblemCorrupt)
+	} else if reported != nil && probe.Duration != nil {
+		difference := math.Abs(float64(*probe.Duration - *reported))
+		tolerance := math.Max(probeDurationTolerance, float64(*reported)*probeDurationTolerancePercent)
+		if difference > tolerance {
+			setProbeProblem(probe, database.AudioFileProblemDurationMismatch)
+		}
+	}
+	if probe.Problem != nil {
+		log.Printf("Problem with %s file for %s: %s", variant, audioUUID, *probe.Problem)
+	}
+	if err := database.AudioFileProbeSave(ctx, probe); err != nil {
+		return nil, err
+	}
+	return probe, nil
+}
+
+func runFFprobe(ctx context.Context, path string, probe *database.AudioFileProbe) error {
+	cmd := exec.CommandContext(ctx, "ffprobe", "-v", "error", "-print_format", "json", "-show_format", "-show_streams", path)
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return &commandError{fmt.Errorf("ffprobe failed: %v", err), exitErr.Stderr}
+		}
+		return fmt.Errorf("ffprobe failed: %v", err)
+	}
+	var output ffprobeOutput
+	if err := json.Unmarshal(out, &output); err != nil {
+		return fmt.Errorf("Failed to parse ffprobe output: %v", err)
+	}
+	for _, stream := range output.Streams {
+		if stream.CodecType != "audio" {
+			continue
+		}
+		probe.Channels = &stream.Channels
+		probe.Codec = &stream.CodecName
+		if rate, err := strconv.Atoi(stream.SampleRate); err == nil {
+			probe.SampleRate = &rate
+		}
+		break
+	}
+	if probe.Codec == nil {
+		return errors.New("no audio stream")
+	}
+	duration, err := strconv.ParseFloat(output.Format.Duration, 32)
+	if err != nil || duration <= 0 {
+		return errors.New("no duration")
+	}
+	d := float32(duration)
+	probe.Duration = &d
+	return nil
+}
+
+func setProbeProblem(probe *database.AudioFileProbe, problem database.AudioFileProblem) {
+	probe.Problem = &problem
+}
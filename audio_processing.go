@@ -15,77 +15,140 @@ import (
 // AudioJob represents a job to process an audio file.
 type AudioJob struct {
 	AudioUUID uuid.UUID
+	// Force regenerates files that are already up to date
+	Force bool
 }
 
-// audioJobChannel is the channel used to send audio processing jobs to the worker.
-var audioJobChannel chan AudioJob
-
-// StartAudioWorker initializes the audio job channel and starts the worker goroutine.
-func StartAudioWorker(ctx context.Context) {
-	buffer := 100
-	audioJobChannel = make(chan AudioJob, buffer) // Buffered channel to prevent blocking
-	log.Printf("Started audio worker with buffer depth %d", buffer)
-	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				log.Println("Audio worker shutting down.")
-				return
-			case job := <-audioJobChannel:
-				log.Printf("Processing audio job for UUID: %s", job.AudioUUID)
-				err := processAudioFile(job.AudioUUID)
-				if err != nil {
-					log.Printf("Error processing audio file %s: %v", job.AudioUUID, err)
-				}
-			}
-		}
-	}()
+// StartAudioWorker starts the pool of worker goroutines that process audio jobs from the job table.
+// The workers stop when the context is cancelled, killing any ffmpeg processes they're running.
+func StartAudioWorker(ctx context.Context) error {
+	transcriber, err := NewTranscriber(config.Transcriber)
+	if err != nil {
+		return fmt.Errorf("Failed to create transcriber: %v", err)
+	}
+	if transcriber == nil {
+		log.Println("Machine transcription is disabled")
+	}
+	startJobWorker(ctx, database.JobKindAudio, config.Audio.Workers, config.Audio.JobTimeout, func(ctx context.Context, job *database.Job) error {
+		return processAudioJob(ctx, transcriber, job)
+	})
+	return nil
 }
 
-// EnqueueAudioJob sends an audio processing job to the worker.
-func EnqueueAudioJob(job AudioJob) {
-	select {
-	case audioJobChannel <- job:
-		log.Printf("Enqueued audio job for UUID: %s", job.AudioUUID)
-	default:
-		log.Printf("Audio job channel is full, dropping job for UUID: %s", job.AudioUUID)
+// EnqueueAudioJob saves an audio processing job and wakes the worker.
+func EnqueueAudioJob(job AudioJob) error {
+	err := enqueueJob(database.JobKindAudio, job.AudioUUID.String(), job.Force)
+	if err != nil {
+		return fmt.Errorf("Failed to enqueue audio job for %s: %v", job.AudioUUID, err)
 	}
+	return nil
 }
 
-func processAudioFile(audioUUID uuid.UUID) error {
+func processAudioJob(ctx context.Context, transcriber Transcriber, job *database.Job) error {
+	audioUUID, err := uuid.Parse(job.UUID)
+	if err != nil {
+		return fmt.Errorf("Failed to parse audio UUID '%s': %v", job.UUID, err)
+	}
+	return processAudioFile(ctx, transcriber, audioUUID, job.Force)
+}
+
+// processAudioFile runs every step of the pipeline for a note. Steps whose output is newer than
+// their input are skipped unless force is set.
+func processAudioFile(ctx context.Context, transcriber Transcriber, audioUUID uuid.UUID, force bool) error {
+	ws, err := newWorkspace()
+	if err != nil {
+		return err
+	}
+	defer ws.Close()
+
+	err = probeAudio(ctx, ws, audioUUID)
+	if errors.Is(err, errAudioUnusable) {
+		// Retrying won't help, the client will be asked to upload it again
+		log.Printf("Not processing audio %s: %v", audioUUID, err)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to probe audio %s: %w", audioUUID, err)
+	}
+
 	// Normalize audio
-	err := normalizeAudio(audioUUID)
+	err = normalizeAudio(ctx, ws, audioUUID, force)
+	if err != nil {
+		return fmt.Errorf("failed to normalize audio %s: %w", audioUUID, err)
+	}
+
+	if config.Audio.Segmentation {
+		err = segmentAudio(ctx, ws, audioUUID, force)
+		if err != nil {
+			return fmt.Errorf("failed to segment audio %s: %w", audioUUID, err)
+		}
+	}
+
+	err = generateWaveform(ctx, ws, audioUUID, force)
+	if err != nil {
+		return fmt.Errorf("failed to generate waveform for audio %s: %w", audioUUID, err)
+	}
+
+	if transcriber != nil {
+		err = transcribeAudio(ctx, ws, transcriber, audioUUID, force)
+		if err != nil {
+			return fmt.Errorf("failed to transcribe audio %s: %w", audioUUID, err)
+		}
+	}
+
+	profiles, err := generatedAudioProfiles()
 	if err != nil {
-		return fmt.Errorf("failed to normalize audio %s: %v", audioUUID, err)
+		return err
+	}
+	for _, profile := range profiles {
+		err = transcodeAudio(ctx, ws, audioUUID, profile, force)
+		if err != nil {
+			return fmt.Errorf("failed to transcode audio %s to %s: %w", audioUUID, profile.Extension, err)
+		}
 	}
 
-	// Transcode to OGG
-	err = transcodeToOgg(audioUUID)
+	err = probeAudioDerivatives(ctx, ws, audioUUID)
 	if err != nil {
-		return fmt.Errorf("failed to transcode audio %s to OGG: %v", audioUUID, err)
+		return fmt.Errorf("failed to probe derived audio %s: %w", audioUUID, err)
 	}
 
-	EnqueueLabelStudioJob(LabelStudioJob{
+	err = EnqueueLabelStudioJob(LabelStudioJob{
 		UUID: audioUUID,
 	})
+	if err != nil {
+		return fmt.Errorf("failed to enqueue label studio job for %s: %w", audioUUID, err)
+	}
 	return nil
 }
 
-func normalizeAudio(audioUUID uuid.UUID) error {
-	source := AudioFileContentPathRaw(audioUUID.String())
-	_, err := os.Stat(source)
+func normalizeAudio(ctx context.Context, ws *workspace, audioUUID uuid.UUID, force bool) error {
+	source := AudioFileContentKeyRaw(audioUUID.String())
+	_, err := userFiles.Stat(ctx, source)
 	if errors.Is(err, os.ErrNotExist) {
 		log.Printf("%s doesn't exist, skipping normalization", source)
 		return nil
+	} else if err != nil {
+		return err
+	}
+	destination := AudioFileContentKeyNormalized(audioUUID.String())
+	if !force && isUpToDate(ctx, destination, source) {
+		log.Printf("%s is up to date, skipping normalization", destination)
+		return nil
 	}
 	log.Printf("Normalizing %s", source)
-	destination := AudioFileContentPathNormalized(audioUUID.String())
+	input, err := ws.Fetch(ctx, source)
+	if err != nil {
+		return err
+	}
 	// Use "ffmpeg" directly, assuming it's in the system PATH
-	cmd := exec.Command("ffmpeg", "-i", source, "-filter:a", "loudnorm", destination)
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-y", "-i", input, "-filter:a", "loudnorm", ws.Path(destination))
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		log.Printf("FFmpeg output for normalization: %s", out)
-		return fmt.Errorf("ffmpeg normalization failed: %v", err)
+		return &commandError{fmt.Errorf("ffmpeg normalization failed: %v", err), out}
+	}
+	err = ws.Save(ctx, destination)
+	if err != nil {
+		return err
 	}
 	err = database.NoteAudioNormalized(audioUUID.String())
 	if err != nil {
@@ -95,26 +158,92 @@ func normalizeAudio(audioUUID uuid.UUID) error {
 	return nil
 }
 
-func transcodeToOgg(audioUUID uuid.UUID) error {
-	source := AudioFileContentPathNormalized(audioUUID.String())
-	_, err := os.Stat(source)
+// transcribeAudio saves a machine transcription of the normalized audio as a new version of the
+// note which becomes the draft for review. We leave transcriptions a person already edited alone.
+func transcribeAudio(ctx context.Context, ws *workspace, transcriber Transcriber, audioUUID uuid.UUID, force bool) error {
+	source := AudioFileContentKeyNormalized(audioUUID.String())
+	_, err := userFiles.Stat(ctx, source)
 	if errors.Is(err, os.ErrNotExist) {
-		log.Printf("%s doesn't exist, skipping OGG transcoding", source)
+		log.Printf("%s doesn't exist, skipping transcription", source)
 		return nil
+	} else if err != nil {
+		return err
 	}
-	log.Printf("Transcoding %s to ogg", source)
-	destination := AudioFileContentPathOgg(audioUUID.String())
-	// Use "ffmpeg" directly, assuming it's in the system PATH
-	cmd := exec.Command("ffmpeg", "-i", source, "-vn", "-acodec", "libvorbis", destination)
-	out, err := cmd.CombinedOutput()
+	current, err := database.NoteAudioTranscriptionSourceGet(ctx, audioUUID.String())
+	if err != nil {
+		return err
+	}
+	if current.Reviewed || current.TranscriptionEdited {
+		log.Printf("Transcription of %s was edited by a person, skipping transcription", audioUUID)
+		return nil
+	}
+	if !force && current.Engine != nil && *current.Engine == transcriber.Name() {
+		log.Printf("%s was already transcribed by %s", audioUUID, transcriber.Name())
+		return nil
+	}
+	log.Printf("Transcribing %s with %s", source, transcriber.Name())
+	input, err := ws.Fetch(ctx, source)
+	if err != nil {
+		return err
+	}
+	transcript, err := transcriber.Transcribe(ctx, input)
 	if err != nil {
-		log.Printf("FFmpeg output for OGG transcoding: %s", out)
-		return fmt.Errorf("ffmpeg OGG transcoding failed: %v", err)
+		return err
 	}
-	err = database.NoteAudioTranscodedToOgg(audioUUID.String())
+	err = database.NoteAudioUpdateMachineTranscription(ctx, audioUUID.String(), transcript.Text, transcriber.Name(), transcript.Confidence)
 	if err != nil {
-		return fmt.Errorf("failed to update database for OGG transcoded audio %s: %v", audioUUID, err)
+		return err
 	}
-	log.Printf("Transcoded audio to %s", destination)
+	log.Printf("Transcribed %s with %.0f%% confidence", audioUUID, transcript.Confidence*100)
 	return nil
 }
+
+// AudioDerivativesMissing lists the files the pipeline would produce for a note that don't exist
+// or are older than the upload. Notes without an upload have nothing missing since there's
+// nothing to produce the files from.
+func AudioDerivativesMissing(stat StatFunc, audioUUID string) []string {
+	missing := make([]string, 0)
+	raw := AudioFileContentKeyRaw(audioUUID)
+	if stat(raw) == nil {
+		return missing
+	}
+	normalized := AudioFileContentKeyNormalized(audioUUID)
+	if !isUpToDateIn(stat, normalized, raw) {
+		return append(missing, normalized)
+	}
+	keys := []string{
+		AudioFileContentKeyWaveformJSON(audioUUID),
+		AudioFileContentKeyWaveformPNG(audioUUID),
+	}
+	profiles, err := generatedAudioProfiles()
+	if err != nil {
+		log.Printf("Failed to get audio profiles: %v", err)
+	}
+	for _, profile := range profiles {
+		keys = append(keys, profile.Key(audioUUID))
+	}
+	for _, key := range keys {
+		if !isUpToDateIn(stat, key, normalized) {
+			missing = append(missing, key)
+		}
+	}
+	return missing
+}
+
+// isUpToDate is true when the destination exists in storage and was written after the source
+func isUpToDate(ctx context.Context, destination string, source string) bool {
+	return isUpToDateIn(StatStorage(ctx, userFiles), destination, source)
+}
+
+// isUpToDateIn is true when the destination exists and was written after the source
+func isUpToDateIn(stat StatFunc, destination string, source string) bool {
+	destinationInfo := stat(destination)
+	if destinationInfo == nil {
+		return false
+	}
+	sourceInfo := stat(source)
+	if sourceInfo == nil {
+		return false
+	}
+	return !destinationInfo.ModTime.Before(sourceInfo.ModTime)
+}
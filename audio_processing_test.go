@@ -0,0 +1,82 @@
+package fssync
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestAudioDerivativesMissing(t *testing.T) {
+	previous := config
+	config = &Config{Audio: ConfigAudio{Profiles: []string{"ogg"}}}
+	t.Cleanup(func() { config = previous })
+
+	const note = "8a9b2f4e-0000-4000-8000-000000000001"
+	uploaded := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	processed := uploaded.Add(time.Minute)
+	derivatives := []string{
+		AudioFileContentKeyWaveformJSON(note),
+		AudioFileContentKeyWaveformPNG(note),
+		AudioFileContentKeyOgg(note),
+	}
+	cases := []struct {
+		name    string
+		files   map[string]time.Time
+		missing []string
+	}{
+		{"no upload", map[string]time.Time{}, []string{}},
+		{
+			"not normalized",
+			map[string]time.Time{AudioFileContentKeyRaw(note): uploaded},
+			[]string{AudioFileContentKeyNormalized(note)},
+		},
+		{
+			"normalized before the upload",
+			map[string]time.Time{
+				AudioFileContentKeyRaw(note):        uploaded,
+				AudioFileContentKeyNormalized(note): uploaded.Add(-time.Minute),
+			},
+			[]string{AudioFileContentKeyNormalized(note)},
+		},
+		{
+			"only normalized",
+			map[string]time.Time{
+				AudioFileContentKeyRaw(note):        uploaded,
+				AudioFileContentKeyNormalized(note): processed,
+			},
+			derivatives,
+		},
+		{
+			"waveform older than the normalized audio",
+			map[string]time.Time{
+				AudioFileContentKeyRaw(note):          uploaded,
+				AudioFileContentKeyNormalized(note):   processed,
+				AudioFileContentKeyWaveformJSON(note): processed,
+				AudioFileContentKeyWaveformPNG(note):  uploaded,
+				AudioFileContentKeyOgg(note):          processed,
+			},
+			[]string{AudioFileContentKeyWaveformPNG(note)},
+		},
+		{
+			"everything",
+			map[string]time.Time{
+				AudioFileContentKeyRaw(note):          uploaded,
+				AudioFileContentKeyNormalized(note):   processed,
+				AudioFileContentKeyWaveformJSON(note): processed,
+				AudioFileContentKeyWaveformPNG(note):  processed,
+				AudioFileContentKeyOgg(note):          processed,
+			},
+			[]string{},
+		},
+	}
+	for _, c := range cases {
+		files := make(map[string]*StorageInfo)
+		for key, modTime := range c.files {
+			files[key] = &StorageInfo{ModTime: modTime}
+		}
+		missing := AudioDerivativesMissing(StatListed(files), note)
+		if !slices.Equal(missing, c.missing) {
+			t.Errorf("%s: got missing %v, expected %v", c.name, missing, c.missing)
+		}
+	}
+}
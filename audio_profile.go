@@ -0,0 +1,159 @@
+package fssync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"slices"
+
+	"github.com/Gleipnir-Technology/fieldseeker-sync/database"
+	"github.com/google/uuid"
+)
+
+// AudioProfile describes one of the forms an audio note can be served in. Profiles without a
+// codec are served from the normalized audio as-is.
+type AudioProfile struct {
+	// Bitrate is passed to ffmpeg, such as "32k". Empty uses the encoder's default.
+	Bitrate string
+	// Codec is the ffmpeg encoder
+	Codec string
+	// Container is the ffmpeg muxer
+	Container   string
+	ContentType string
+	// Extension is used in file names and in the /audio/{uuid}.{extension} route
+	Extension string
+	// LowBandwidth profiles are offered to reviewers on slow connections
+	LowBandwidth bool
+}
+
+// AudioProfiles lists every profile that can be served, in the order browsers should try them.
+// The pipeline generates the ones named in FIELDSEEKER_SYNC_AUDIO_PROFILES.
+var AudioProfiles = []AudioProfile{
+	{
+		ContentType: "audio/mp4",
+		Extension:   "m4a",
+	},
+	{
+		Codec:       "libvorbis",
+		Container:   "ogg",
+		ContentType: "audio/ogg",
+		Extension:   "ogg",
+	},
+	{
+		// Small enough for reviewers on cellular connections and still clear for speech
+		Bitrate:      "24k",
+		Codec:        "libopus",
+		Container:    "webm",
+		ContentType:  "audio/webm",
+		Extension:    "webm",
+		LowBandwidth: true,
+	},
+	{
+		// We don't generate these anymore but some older notes have them
+		Bitrate:     "64k",
+		Codec:       "libmp3lame",
+		Container:   "mp3",
+		ContentType: "audio/mpeg",
+		Extension:   "mp3",
+	},
+}
+
+// AudioProfileByExtension finds the profile served at the given extension
+func AudioProfileByExtension(extension string) (*AudioProfile, error) {
+	for i := range AudioProfiles {
+		if AudioProfiles[i].Extension == extension {
+			return &AudioProfiles[i], nil
+		}
+	}
+	return nil, fmt.Errorf("No audio profile for extension '%s'", extension)
+}
+
+// IsTranscoded is true when the profile is made by transcoding the normalized audio
+func (p *AudioProfile) IsTranscoded() bool {
+	return p.Codec != ""
+}
+
+// Key is where the audio for a note is stored in this profile
+func (p *AudioProfile) Key(audioUUID string) string {
+	if !p.IsTranscoded() {
+		return AudioFileContentKeyNormalized(audioUUID)
+	}
+	return fmt.Sprintf("%s.%s", audioUUID, p.Extension)
+}
+
+// ServedAudioProfiles are the profiles every processed note is available in, in the order
+// of AudioProfiles
+func ServedAudioProfiles() []*AudioProfile {
+	results := make([]*AudioProfile, 0)
+	for i, profile := range AudioProfiles {
+		if !profile.IsTranscoded() || slices.Contains(config.Audio.Profiles, profile.Extension) {
+			results = append(results, &AudioProfiles[i])
+		}
+	}
+	return results
+}
+
+// generatedAudioProfiles are the profiles the pipeline produces
+func generatedAudioProfiles() ([]*AudioProfile, error) {
+	results := make([]*AudioProfile, 0, len(config.Audio.Profiles))
+	for _, extension := range config.Audio.Profiles {
+		profile, err := AudioProfileByExtension(extension)
+		if err != nil {
+			return results, err
+		}
+		if !profile.IsTranscoded() {
+			continue
+		}
+		results = append(results, profile)
+	}
+	return results, nil
+}
+
+// transcodeAudio produces the normalized audio in the given profile
+func transcodeAudio(ctx context.Context, ws *workspace, audioUUID uuid.UUID, profile *AudioProfile, force bool) error {
+	source := AudioFileContentKeyNormalized(audioUUID.String())
+	_, err := userFiles.Stat(ctx, source)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("%s doesn't exist, skipping %s transcoding", source, profile.Extension)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	destination := profile.Key(audioUUID.String())
+	if !force && isUpToDate(ctx, destination, source) {
+		log.Printf("%s is up to date, skipping transcoding", destination)
+		return nil
+	}
+	log.Printf("Transcoding %s to %s", source, profile.Extension)
+	input, err := ws.Fetch(ctx, source)
+	if err != nil {
+		return err
+	}
+	args := []string{"-y", "-i", input, "-vn", "-acodec", profile.Codec}
+	if profile.Bitrate != "" {
+		args = append(args, "-b:a", profile.Bitrate)
+	}
+	args = append(args, "-f", profile.Container, ws.Path(destination))
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		log.Printf("FFmpeg output for %s transcoding: %s", profile.Extension, out)
+		return &commandError{fmt.Errorf("ffmpeg %s transcoding failed: %v", profile.Extension, err), out}
+	}
+	err = ws.Save(ctx, destination)
+	if err != nil {
+		return err
+	}
+	// We've tracked whether the OGG file exists since before there were profiles
+	if profile.Extension == "ogg" {
+		err = database.NoteAudioTranscodedToOgg(audioUUID.String())
+		if err != nil {
+			return fmt.Errorf("failed to update database for OGG transcoded audio %s: %v", audioUUID, err)
+		}
+	}
+	log.Printf("Transcoded audio to %s", destination)
+	return nil
+}
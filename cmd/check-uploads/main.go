@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
@@ -49,14 +50,14 @@ func run() error {
 	raw_missing := NewSet()
 
 	for _, note := range notesAudio {
-		paths := map[string]string{
-			"mp3":        fssync.AudioFileContentPathMp3(note.UUID),
-			"normalized": fssync.AudioFileContentPathNormalized(note.UUID),
-			"ogg":        fssync.AudioFileContentPathOgg(note.UUID),
-			"raw":        fssync.AudioFileContentPathRaw(note.UUID),
+		keys := map[string]string{
+			"mp3":        fssync.AudioFileContentKeyMp3(note.UUID),
+			"normalized": fssync.AudioFileContentKeyNormalized(note.UUID),
+			"ogg":        fssync.AudioFileContentKeyOgg(note.UUID),
+			"raw":        fssync.AudioFileContentKeyRaw(note.UUID),
 		}
-		for name, path := range paths {
-			if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		for name, key := range keys {
+			if _, err := fssync.UserFiles().Stat(context.Background(), key); errors.Is(err, os.ErrNotExist) {
 				statistics[name] = statistics[name] + 1
 				if name == "raw" {
 					raw_missing.Add(note.UUID)
@@ -64,7 +65,11 @@ func run() error {
 			}
 		}
 	}
-	fmt.Printf("Checked %d audio notes. %d (%f) are missing raw files.\n", len(notesAudio), statistics["raw"], statistics["raw"]/len(notesAudio))
+	percent := 0.0
+	if len(notesAudio) > 0 {
+		percent = 100 * float64(statistics["raw"]) / float64(len(notesAudio))
+	}
+	fmt.Printf("Checked %d audio notes. %d (%.1f%%) are missing raw files.\n", len(notesAudio), statistics["raw"], percent)
 	if raw_missing.Size() < 30 {
 		fmt.Println("Missing raw files from:")
 		for _, uuid := range raw_missing.list {
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Gleipnir-Technology/fieldseeker-sync"
+	"github.com/Gleipnir-Technology/fieldseeker-sync/database"
+	"github.com/google/uuid"
+)
+
+// audioReprocess puts audio notes back through the processing pipeline by adding them to the
+// job queue. The webserver's audio workers do the processing.
+func audioReprocess(args []string) error {
+	flags := flag.NewFlagSet("audio reprocess", flag.ExitOnError)
+	creator := flags.String("creator", "", "only notes recorded by the user with this username")
+	dryRun := flags.Bool("dry-run", false, "list the notes that would be reprocessed without queueing them")
+	force := flags.Bool("force", false, "regenerate files even if they are up to date")
+	missing := flags.Bool("missing", false, "only notes that are missing a file the pipeline produces")
+	since := flags.String("since", "", "only notes recorded on or after this date (YYYY-MM-DD)")
+	until := flags.String("until", "", "only notes recorded before this date (YYYY-MM-DD)")
+	uuids := flags.String("uuid", "", "comma-separated UUIDs of the notes to reprocess")
+	flags.Parse(args)
+
+	var filter database.NoteAudioFilter
+	if *uuids != "" {
+		for _, u := range strings.Split(*uuids, ",") {
+			parsed, err := uuid.Parse(strings.TrimSpace(u))
+			if err != nil {
+				return fmt.Errorf("Invalid UUID '%s': %v", u, err)
+			}
+			filter.UUIDs = append(filter.UUIDs, parsed.String())
+		}
+	}
+	if *since != "" {
+		t, err := time.Parse(time.DateOnly, *since)
+		if err != nil {
+			return fmt.Errorf("Invalid since date '%s': %v", *since, err)
+		}
+		filter.CreatedAfter = &t
+	}
+	if *until != "" {
+		t, err := time.Parse(time.DateOnly, *until)
+		if err != nil {
+			return fmt.Errorf("Invalid until date '%s': %v", *until, err)
+		}
+		filter.CreatedBefore = &t
+	}
+
+	err := fssync.InitDB()
+	if err != nil {
+		return fmt.Errorf("Failed to init database: %v", err)
+	}
+	if *creator != "" {
+		id, err := userID(*creator)
+		if err != nil {
+			return err
+		}
+		filter.CreatorID = &id
+	}
+
+	notes, err := database.NoteAudioUUIDList(context.Background(), filter)
+	if err != nil {
+		return err
+	}
+	stat := fssync.StatStorage(context.Background(), fssync.UserFiles())
+	queued := 0
+	for _, note := range notes {
+		if *missing {
+			paths := fssync.AudioDerivativesMissing(stat, note)
+			if len(paths) == 0 {
+				continue
+			}
+			log.Printf("%s is missing %s", note, strings.Join(paths, ", "))
+		}
+		queued++
+		if *dryRun {
+			fmt.Println(note)
+			continue
+		}
+		err = fssync.EnqueueAudioJob(fssync.AudioJob{
+			AudioUUID: uuid.MustParse(note),
+			Force:     *force,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if *dryRun {
+		log.Printf("Would queue %d of %d matching audio notes", queued, len(notes))
+	} else {
+		log.Printf("Queued %d of %d matching audio notes", queued, len(notes))
+	}
+	return nil
+}
+
+func userID(username string) (int, error) {
+	users, err := database.Users()
+	if err != nil {
+		return 0, fmt.Errorf("Failed to get users: %v", err)
+	}
+	for _, u := range users {
+		if u.Username == username {
+			return u.ID, nil
+		}
+	}
+	return 0, fmt.Errorf("No user named '%s'", username)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Gleipnir-Technology/fieldseeker-sync"
+	"github.com/Gleipnir-Technology/fieldseeker-sync/database"
+	"github.com/Gleipnir-Technology/fieldseeker-sync/shared"
+)
+
+// exportLayer writes the rows of a layer as CSV or a spreadsheet, the same as /export/{layer}
+func exportLayer(args []string) error {
+	flags := flag.NewFlagSet("export layer", flag.ExitOnError)
+	bounds := flags.String("bounds", "", "only rows within west,south,east,north")
+	fields := flags.String("fields", "", "comma separated columns to export, all of them if empty")
+	extension := flags.String("format", "", "csv or xlsx, from the output's extension if empty and csv otherwise")
+	output := flags.String("o", "", "file to write, standard output if empty")
+	sortParam := flags.String("sort", "", "column to sort by, prefixed with - to reverse it")
+	updatedSince := flags.String("updated-since", "", "only rows synced after this RFC 3339 time")
+	filters := make(map[string]string)
+	flags.Func("where", "only rows where column=value, can be repeated", func(s string) error {
+		column, value, ok := strings.Cut(s, "=")
+		if !ok {
+			return errors.New("must be column=value")
+		}
+		filters[column] = value
+		return nil
+	})
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s export layer [flags] <layer>\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	name := flags.Arg(0)
+	layer, ok := database.Layers[name]
+	if !ok {
+		return fmt.Errorf("No such layer %s", name)
+	}
+
+	if *extension == "" {
+		*extension = "csv"
+		if e := strings.TrimPrefix(filepath.Ext(*output), "."); e != "" {
+			*extension = e
+		}
+	}
+	format, err := fssync.ExportFormatByExtension(*extension)
+	if err != nil {
+		return err
+	}
+	query := database.LayerQuery{
+		Filters:        filters,
+		Sort:           strings.TrimPrefix(*sortParam, "-"),
+		SortDescending: strings.HasPrefix(*sortParam, "-"),
+	}
+	var columns []string
+	if *fields != "" {
+		columns = strings.Split(*fields, ",")
+	}
+	for _, column := range columns {
+		if !layer.HasColumn(column) {
+			return fmt.Errorf("No column %s", column)
+		}
+	}
+	if query.Sort != "" && !layer.HasColumn(query.Sort) {
+		return fmt.Errorf("No column %s to sort by", query.Sort)
+	}
+	for column := range filters {
+		if !layer.HasColumn(column) {
+			return fmt.Errorf("No column %s to filter by", column)
+		}
+	}
+	if *updatedSince != "" {
+		t, err := time.Parse(time.RFC3339, *updatedSince)
+		if err != nil {
+			return fmt.Errorf("Failed to parse -updated-since: %v", err)
+		}
+		query.UpdatedSince = &t
+	}
+	if *bounds != "" {
+		query.Bounds, err = parseExportBounds(*bounds)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = fssync.InitDB()
+	if err != nil {
+		return fmt.Errorf("Failed to init database: %v", err)
+	}
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("Failed to create %s: %v", *output, err)
+		}
+		defer file.Close()
+		out = file
+	}
+	err = fssync.ExportLayer(context.Background(), out, format, name, columns, query)
+	if err != nil {
+		return fmt.Errorf("Failed to export %s: %v", name, err)
+	}
+	if file, ok := out.(*os.File); ok && file != os.Stdout {
+		return file.Close()
+	}
+	return nil
+}
+
+func parseExportBounds(s string) (*shared.Bounds, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return nil, errors.New("-bounds must be west,south,east,north")
+	}
+	values := make([]float64, 0, 4)
+	for _, part := range parts {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse -bounds: %v", err)
+		}
+		values = append(values, value)
+	}
+	return &shared.Bounds{
+		West:  values[0],
+		South: values[1],
+		East:  values[2],
+		North: values[3],
+	}, nil
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Gleipnir-Technology/fieldseeker-sync"
+	"github.com/Gleipnir-Technology/fieldseeker-sync/database"
+	"github.com/Gleipnir-Technology/fieldseeker-sync/shared"
+	"github.com/google/uuid"
+)
+
+// Orphans are moved under this prefix rather than deleted. It's hidden, so files in it aren't
+// listed by later runs.
+const quarantinePrefix = ".quarantine/"
+
+// filesReport is what files reconcile found and, with -repair, what it did about it
+type filesReport struct {
+	FlagMismatches     []flagMismatch       `json:"flag_mismatches"`
+	MissingDerivatives []missingDerivatives `json:"missing_derivatives"`
+	MissingUploads     []noteRef            `json:"missing_uploads"`
+	// Orphans are files named after a note that isn't in the database
+	Orphans []string `json:"orphans"`
+	// Recent files would be orphans, but they were written within the grace period so their
+	// note may not have been posted yet. They're never moved.
+	Recent []string `json:"recent"`
+	// Unrecognized files aren't named like anything we store. They're reported but never moved.
+	Unrecognized []string      `json:"unrecognized"`
+	Repaired     *filesRepairs `json:"repaired,omitempty"`
+}
+
+type noteRef struct {
+	Kind database.UploadKind `json:"kind"`
+	UUID string              `json:"uuid"`
+}
+
+type missingDerivatives struct {
+	noteRef
+	Keys []string `json:"keys"`
+}
+
+// flagMismatch is a note_audio flag that says a file exists when it doesn't or the other way around
+type flagMismatch struct {
+	Database bool   `json:"database"`
+	Flag     string `json:"flag"`
+	Storage  bool   `json:"storage"`
+	UUID     string `json:"uuid"`
+}
+
+type filesRepairs struct {
+	Enqueued    int `json:"enqueued"`
+	FlagsFixed  int `json:"flags_fixed"`
+	Quarantined int `json:"quarantined"`
+}
+
+// filesReconcile cross-checks the audio and image notes in the database against the user files
+// in storage. With -repair, flags are updated to match storage, notes missing derivatives are
+// queued for processing and orphaned files are quarantined.
+func filesReconcile(args []string) error {
+	flags := flag.NewFlagSet("files reconcile", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print the report as JSON")
+	grace := flags.Duration("grace", 24*time.Hour, "how long a file can wait for its note before it's an orphan")
+	repair := flags.Bool("repair", false, "fix flags, queue missing derivatives and quarantine orphans")
+	flags.Parse(args)
+
+	err := fssync.InitDB()
+	if err != nil {
+		return fmt.Errorf("Failed to init database: %v", err)
+	}
+	ctx := context.Background()
+	storage := fssync.UserFiles()
+
+	files := make(map[string]*fssync.StorageInfo)
+	err = storage.List(ctx, func(key string, info *fssync.StorageInfo) error {
+		files[key] = info
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to list user files: %w", err)
+	}
+	audioNotes, err := database.NoteAudioDeleted(ctx)
+	if err != nil {
+		return err
+	}
+	imageNotes, err := database.NoteImageDeleted(ctx)
+	if err != nil {
+		return err
+	}
+
+	report := filesReport{
+		FlagMismatches:     make([]flagMismatch, 0),
+		MissingDerivatives: make([]missingDerivatives, 0),
+		MissingUploads:     make([]noteRef, 0),
+		Orphans:            make([]string, 0),
+		Recent:             make([]string, 0),
+		Unrecognized:       make([]string, 0),
+	}
+	classifyFiles(&report, files, audioNotes, imageNotes, time.Now().Add(-*grace))
+
+	notesAudio, err := database.NoteAudioQuery()
+	if err != nil {
+		return err
+	}
+	// Derivatives are checked against the listing rather than asking storage about each one
+	stat := fssync.StatListed(files)
+	checkAudioNotes(&report, files, notesAudio, func(audioUUID string) []string {
+		return fssync.AudioDerivativesMissing(stat, audioUUID)
+	})
+
+	imageUUIDs := make([]string, 0, len(imageNotes))
+	for noteUUID, deleted := range imageNotes {
+		if !deleted {
+			imageUUIDs = append(imageUUIDs, noteUUID)
+		}
+	}
+	sort.Strings(imageUUIDs)
+	for _, noteUUID := range imageUUIDs {
+		if _, ok := files[fssync.ImageFileContentKeyRaw(noteUUID)]; !ok {
+			report.MissingUploads = append(report.MissingUploads, noteRef{database.UploadKindImage, noteUUID})
+			continue
+		}
+		keys, err := fssync.ImageDerivativesMissing(ctx, stat, noteUUID)
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			report.MissingDerivatives = append(report.MissingDerivatives, missingDerivatives{noteRef{database.UploadKindImage, noteUUID}, keys})
+		}
+	}
+
+	if *repair {
+		report.Repaired, err = repairFiles(ctx, storage, &report)
+		if err != nil {
+			return err
+		}
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	printFilesReport(&report)
+	return nil
+}
+
+// classifyFiles reports the files that aren't named after a note in the database. Uploads don't
+// wait for their note, so files written after cutoff are only recent, not orphans.
+func classifyFiles(report *filesReport, files map[string]*fssync.StorageInfo, audioNotes map[string]bool, imageNotes map[string]bool, cutoff time.Time) {
+	for key, info := range files {
+		kind, noteUUID, ok := fssync.UserFileKeyNote(key)
+		if !ok {
+			report.Unrecognized = append(report.Unrecognized, key)
+			continue
+		}
+		// Files of deleted notes are kept in case the note is restored
+		var known bool
+		if kind == database.UploadKindAudio {
+			_, known = audioNotes[noteUUID]
+		} else {
+			_, known = imageNotes[noteUUID]
+		}
+		if known {
+			continue
+		}
+		if info.ModTime.After(cutoff) {
+			report.Recent = append(report.Recent, key)
+		} else {
+			report.Orphans = append(report.Orphans, key)
+		}
+	}
+	sort.Strings(report.Orphans)
+	sort.Strings(report.Recent)
+	sort.Strings(report.Unrecognized)
+}
+
+// checkAudioNotes reports the audio notes without an upload or missing the files the pipeline
+// produces from it, and the flags that disagree with storage
+func checkAudioNotes(report *filesReport, files map[string]*fssync.StorageInfo, notes []*shared.NoteAudio, derivativesMissing func(audioUUID string) []string) {
+	sort.Slice(notes, func(i, j int) bool { return notes[i].UUID < notes[j].UUID })
+	for _, note := range notes {
+		if _, ok := files[fssync.AudioFileContentKeyRaw(note.UUID)]; !ok {
+			report.MissingUploads = append(report.MissingUploads, noteRef{database.UploadKindAudio, note.UUID})
+		} else if keys := derivativesMissing(note.UUID); len(keys) > 0 {
+			report.MissingDerivatives = append(report.MissingDerivatives, missingDerivatives{noteRef{database.UploadKindAudio, note.UUID}, keys})
+		}
+		_, normalized := files[fssync.AudioFileContentKeyNormalized(note.UUID)]
+		if normalized != note.IsAudioNormalized {
+			report.FlagMismatches = append(report.FlagMismatches, flagMismatch{note.IsAudioNormalized, "is_audio_normalized", normalized, note.UUID})
+		}
+		_, ogg := files[fssync.AudioFileContentKeyOgg(note.UUID)]
+		if ogg != note.IsTranscodedeToOgg {
+			report.FlagMismatches = append(report.FlagMismatches, flagMismatch{note.IsTranscodedeToOgg, "is_transcoded_to_ogg", ogg, note.UUID})
+		}
+	}
+}
+
+func repairFiles(ctx context.Context, storage fssync.Storage, report *filesReport) (*filesRepairs, error) {
+	repairs := &filesRepairs{}
+	// Set both flags from storage in one update per note
+	fixed := make(map[string]bool)
+	for _, mismatch := range report.FlagMismatches {
+		if fixed[mismatch.UUID] {
+			continue
+		}
+		fixed[mismatch.UUID] = true
+		normalized := exists(ctx, storage, fssync.AudioFileContentKeyNormalized(mismatch.UUID))
+		ogg := exists(ctx, storage, fssync.AudioFileContentKeyOgg(mismatch.UUID))
+		err := database.NoteAudioFileFlagsSet(ctx, mismatch.UUID, normalized, ogg)
+		if err != nil {
+			return repairs, err
+		}
+		repairs.FlagsFixed++
+	}
+	for _, missing := range report.MissingDerivatives {
+		noteUUID, err := uuid.Parse(missing.UUID)
+		if err != nil {
+			return repairs, err
+		}
+		if missing.Kind == database.UploadKindAudio {
+			err = fssync.EnqueueAudioJob(fssync.AudioJob{AudioUUID: noteUUID})
+		} else {
+			err = fssync.EnqueueImageJob(fssync.ImageJob{ImageUUID: noteUUID})
+		}
+		if err != nil {
+			return repairs, err
+		}
+		repairs.Enqueued++
+	}
+	for _, key := range report.Orphans {
+		err := quarantine(ctx, storage, key)
+		if err != nil {
+			return repairs, err
+		}
+		log.Printf("Quarantined %s", key)
+		repairs.Quarantined++
+	}
+	return repairs, nil
+}
+
+// quarantine moves a file out of the way so it can be looked at before it's deleted
+func quarantine(ctx context.Context, storage fssync.Storage, key string) error {
+	file, err := storage.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	err = storage.Put(ctx, quarantinePrefix+key, file)
+	if err != nil {
+		return err
+	}
+	return storage.Delete(ctx, key)
+}
+
+func exists(ctx context.Context, storage fssync.Storage, key string) bool {
+	_, err := storage.Stat(ctx, key)
+	return err == nil
+}
+
+func printFilesReport(report *filesReport) {
+	fmt.Printf("%d orphaned files\n", len(report.Orphans))
+	for _, key := range report.Orphans {
+		fmt.Printf("\t%s\n", key)
+	}
+	fmt.Printf("%d recent files waiting for their note\n", len(report.Recent))
+	for _, key := range report.Recent {
+		fmt.Printf("\t%s\n", key)
+	}
+	fmt.Printf("%d unrecognized files\n", len(report.Unrecognized))
+	for _, key := range report.Unrecognized {
+		fmt.Printf("\t%s\n", key)
+	}
+	fmt.Printf("%d notes without an upload\n", len(report.MissingUploads))
+	for _, note := range report.MissingUploads {
+		fmt.Printf("\t%s %s\n", note.Kind, note.UUID)
+	}
+	fmt.Printf("%d notes missing derivatives\n", len(report.MissingDerivatives))
+	for _, missing := range report.MissingDerivatives {
+		fmt.Printf("\t%s %s: %s\n", missing.Kind, missing.UUID, strings.Join(missing.Keys, ", "))
+	}
+	fmt.Printf("%d flags that disagree with storage\n", len(report.FlagMismatches))
+	for _, mismatch := range report.FlagMismatches {
+		fmt.Printf("\t%s %s is %t, file exists: %t\n", mismatch.UUID, mismatch.Flag, mismatch.Database, mismatch.Storage)
+	}
+	if report.Repaired != nil {
+		fmt.Printf("Fixed flags of %d notes, queued %d notes for processing and quarantined %d files\n", report.Repaired.FlagsFixed, report.Repaired.Enqueued, report.Repaired.Quarantined)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Gleipnir-Technology/fieldseeker-sync"
+	"github.com/Gleipnir-Technology/fieldseeker-sync/database"
+	"github.com/Gleipnir-Technology/fieldseeker-sync/shared"
+)
+
+func TestReconcileFiles(t *testing.T) {
+	const (
+		audio      = "8a9b2f4e-0000-4000-8000-000000000001"
+		noUpload   = "8a9b2f4e-0000-4000-8000-000000000002"
+		deleted    = "8a9b2f4e-0000-4000-8000-000000000003"
+		image      = "8a9b2f4e-0000-4000-8000-000000000004"
+		orphan     = "8a9b2f4e-0000-4000-8000-000000000005"
+		uploading  = "8a9b2f4e-0000-4000-8000-000000000006"
+		orphanType = "8a9b2f4e-0000-4000-8000-000000000007"
+	)
+	cutoff := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	old := &fssync.StorageInfo{ModTime: cutoff.Add(-time.Hour)}
+	files := map[string]*fssync.StorageInfo{
+		fssync.AudioFileContentKeyRaw(audio):        old,
+		fssync.AudioFileContentKeyNormalized(audio): old,
+		// Files of deleted notes are kept
+		fssync.AudioFileContentKeyRaw(deleted): old,
+		fssync.ImageFileContentKeyRaw(image):   old,
+		fssync.AudioFileContentKeyRaw(orphan):  old,
+		fssync.AudioFileContentKeyOgg(orphan):  old,
+		// Uploaded before its note was posted
+		fssync.ImageFileContentKeyRaw(uploading): {ModTime: cutoff.Add(time.Minute)},
+		// Named after an audio note, but stored like a photo
+		fssync.ImageFileContentKeyRaw(orphanType): old,
+		orphanType + ".exe":                       old,
+		"notes.txt":                               old,
+	}
+	audioNotes := map[string]bool{audio: false, noUpload: false, deleted: true, orphanType: false}
+	imageNotes := map[string]bool{image: false}
+	notes := []*shared.NoteAudio{
+		// Normalized, but the flags say otherwise for both files
+		{UUID: audio, IsAudioNormalized: false, IsTranscodedeToOgg: true},
+		{UUID: noUpload},
+	}
+
+	report := filesReport{}
+	classifyFiles(&report, files, audioNotes, imageNotes, cutoff)
+	checkAudioNotes(&report, files, notes, func(audioUUID string) []string {
+		if audioUUID != audio {
+			t.Errorf("Checked derivatives of %s, which has no upload", audioUUID)
+		}
+		return []string{fssync.AudioFileContentKeyWaveformJSON(audioUUID)}
+	})
+
+	expected := filesReport{
+		FlagMismatches: []flagMismatch{
+			{Database: false, Flag: "is_audio_normalized", Storage: true, UUID: audio},
+			{Database: true, Flag: "is_transcoded_to_ogg", Storage: false, UUID: audio},
+		},
+		MissingDerivatives: []missingDerivatives{
+			{noteRef{database.UploadKindAudio, audio}, []string{fssync.AudioFileContentKeyWaveformJSON(audio)}},
+		},
+		MissingUploads: []noteRef{{database.UploadKindAudio, noUpload}},
+		Orphans: []string{
+			fssync.AudioFileContentKeyRaw(orphan),
+			fssync.AudioFileContentKeyOgg(orphan),
+			fssync.ImageFileContentKeyRaw(orphanType),
+		},
+		Recent:       []string{fssync.ImageFileContentKeyRaw(uploading)},
+		Unrecognized: []string{orphanType + ".exe", "notes.txt"},
+	}
+	if !reflect.DeepEqual(report.Orphans, expected.Orphans) {
+		t.Errorf("Got orphans %v, expected %v", report.Orphans, expected.Orphans)
+	}
+	if !reflect.DeepEqual(report.Recent, expected.Recent) {
+		t.Errorf("Got recent %v, expected %v", report.Recent, expected.Recent)
+	}
+	if !reflect.DeepEqual(report.Unrecognized, expected.Unrecognized) {
+		t.Errorf("Got unrecognized %v, expected %v", report.Unrecognized, expected.Unrecognized)
+	}
+	if !reflect.DeepEqual(report.MissingUploads, expected.MissingUploads) {
+		t.Errorf("Got missing uploads %v, expected %v", report.MissingUploads, expected.MissingUploads)
+	}
+	if !reflect.DeepEqual(report.MissingDerivatives, expected.MissingDerivatives) {
+		t.Errorf("Got missing derivatives %v, expected %v", report.MissingDerivatives, expected.MissingDerivatives)
+	}
+	if !reflect.DeepEqual(report.FlagMismatches, expected.FlagMismatches) {
+		t.Errorf("Got flag mismatches %v, expected %v", report.FlagMismatches, expected.FlagMismatches)
+	}
+}
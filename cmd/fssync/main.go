@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// command runs a subcommand with the arguments that follow its name
+type command func(args []string) error
+
+var commands = map[string]map[string]command{
+	"audio": {
+		"reprocess": audioReprocess,
+	},
+	"export": {
+		"layer": exportLayer,
+	},
+	"files": {
+		"reconcile": filesReconcile,
+	},
+	"storage": {
+		"migrate": storageMigrate,
+	},
+}
+
+func main() {
+	err := run()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run() error {
+	if len(os.Args) < 3 {
+		usage()
+		os.Exit(1)
+	}
+	group, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(1)
+	}
+	cmd, ok := group[os.Args[2]]
+	if !ok {
+		usage()
+		os.Exit(1)
+	}
+
+	err := sentry.Init(sentry.ClientOptions{
+		EnableTracing:    true,
+		TracesSampleRate: 1.0,
+	})
+	if err != nil {
+		return err
+	}
+	defer sentry.Flush(2 * time.Second)
+
+	return cmd(os.Args[3:])
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s <group> <command> [flags]\n\nCommands:\n", os.Args[0])
+	for _, name := range slices.Sorted(maps.Keys(commands)) {
+		for _, sub := range slices.Sorted(maps.Keys(commands[name])) {
+			fmt.Fprintf(os.Stderr, "\t%s %s\n", name, sub)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/Gleipnir-Technology/fieldseeker-sync"
+)
+
+// storageMigrate copies the user files in the local directory into the configured storage so
+// we can switch a server from local disk to S3. Files that were already copied are skipped, so
+// it's safe to run again after an interruption and once more just before switching over.
+func storageMigrate(args []string) error {
+	flags := flag.NewFlagSet("storage migrate", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "list the files that would be copied without copying them")
+	overwrite := flags.Bool("overwrite", false, "copy files even if the storage has a file of the same size")
+	flags.Parse(args)
+
+	err := fssync.InitDB()
+	if err != nil {
+		return fmt.Errorf("Failed to init database: %v", err)
+	}
+	config := fssync.ReadConfig()
+	destination := fssync.UserFiles()
+	if _, ok := destination.(*fssync.LocalStorage); ok {
+		return errors.New("User files are already stored locally, set FIELDSEEKER_SYNC_USERFILES_BACKEND to migrate them elsewhere")
+	}
+	source := fssync.NewLocalStorage(config.UserFiles.Directory)
+
+	// Files the pipeline produced are only up to date when they're newer than what they came
+	// from. Storage gives copies the time they were written, so we copy oldest first to keep
+	// them in the order they were on disk.
+	files := make([]migrateFile, 0)
+	err = source.Walk(func(key string, info os.FileInfo) error {
+		files = append(files, migrateFile{info: info, key: key})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to list user files: %w", err)
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].info.ModTime().Before(files[j].info.ModTime())
+	})
+
+	ctx := context.Background()
+	var copied, skipped int
+	copyFile := func(key string, info os.FileInfo) error {
+		if !*overwrite {
+			existing, err := destination.Stat(ctx, key)
+			if err == nil && existing.Size == info.Size() {
+				skipped++
+				return nil
+			} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+		copied++
+		if *dryRun {
+			fmt.Println(key)
+			return nil
+		}
+		file, err := source.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		err = destination.Put(ctx, key, file)
+		if err != nil {
+			return err
+		}
+		log.Printf("Copied %s (%d bytes)", key, info.Size())
+		return nil
+	}
+	for _, f := range files {
+		if err := copyFile(f.key, f.info); err != nil {
+			return fmt.Errorf("Failed to migrate user files: %w", err)
+		}
+	}
+	if *dryRun {
+		log.Printf("Would copy %d files, %d are already copied", copied, skipped)
+	} else {
+		log.Printf("Copied %d files, %d were already copied", copied, skipped)
+	}
+	return nil
+}
+
+type migrateFile struct {
+	info os.FileInfo
+	key  string
+}
@@ -3,8 +3,10 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/Gleipnir-Technology/arcgis-go"
 	"github.com/Gleipnir-Technology/arcgis-go/fieldseeker"
@@ -66,17 +68,29 @@ func downloadAllRecords(layer arcgis.Layer, offset int) (int, int, error) {
 	//log.Printf("%v %v\n", layer.ID, layer.Name)
 	inserts := 0
 	updates := 0
+	start := offset
+	filter, err := database.ExportLayerFilterGet(context.Background(), "FS_"+layer.Name)
+	if err != nil {
+		return inserts, updates, err
+	}
 	count, err := fieldseeker.QueryCount(layer.ID)
 	if err != nil {
 		return inserts, updates, err
 	}
-	log.Printf("Need to get %v records for layer '%v'\n", count.Count, layer.Name)
+	where := filter.Where(time.Now())
+	if filter.IsFiltered() {
+		log.Printf("Layer '%v' has %v records, getting those matching '%v'\n", layer.Name, count.Count, where)
+	} else {
+		log.Printf("Need to get %v records for layer '%v'\n", count.Count, layer.Name)
+	}
 	if count.Count == 0 {
 		//log.Printf("No records available\n")
 		return inserts, updates, nil
 	}
+	seen := 0
 	for {
-		if offset >= count.Count {
+		// The count is for the whole layer, so it's only a useful stopping point when we aren't filtering
+		if !filter.IsFiltered() && offset >= count.Count {
 			//log.Printf("Offset is at %v/%v records. Stopping.\n", offset, count.Count)
 			break
 		}
@@ -84,8 +98,8 @@ func downloadAllRecords(layer arcgis.Layer, offset int) (int, int, error) {
 		query.ResultRecordCount = fieldseeker.MaxRecordCount()
 		query.ResultOffset = offset
 		query.SpatialReference = "4326"
-		query.OutFields = "*"
-		query.Where = "1=1"
+		query.OutFields = filter.OutFieldList()
+		query.Where = where
 		qr, err := fieldseeker.DoQuery(
 			layer.ID,
 			query)
@@ -102,12 +116,59 @@ func downloadAllRecords(layer arcgis.Layer, offset int) (int, int, error) {
 		inserts += i
 		updates += u
 		offset += len(qr.Features)
+		seen += len(qr.Features)
 		//log.Printf("Handled %v %v records. Offset %v. %v remain\n", len(qr.Features), layer.Name, offset, count.Count-offset)
+		if len(qr.Features) == 0 {
+			break
+		}
+	}
+	log.Printf("%d inserts, %d updates, %d no change\n", inserts, updates, seen-inserts-updates)
+	// A run that starts part way through hasn't seen the whole layer
+	if start == 0 {
+		if err := deleteRemovedRecords(layer, count.Count); err != nil {
+			return inserts, updates, err
+		}
 	}
-	log.Printf("%d inserts, %d updates, %d no change\n", inserts, updates, count.Count-inserts-updates)
 	return inserts, updates, nil
 }
 
+// deleteRemovedRecords deletes the rows FieldSeeker no longer has. The filter only limits which
+// rows we download, so the layer's objectids are listed without it. Rows outside the filter are
+// still in FieldSeeker and are kept.
+func deleteRemovedRecords(layer arcgis.Layer, count int) error {
+	objectids := make([]int, 0, count)
+	for {
+		query := arcgis.NewQuery()
+		query.ResultRecordCount = fieldseeker.MaxRecordCount()
+		query.ResultOffset = len(objectids)
+		query.OutFields = "OBJECTID"
+		query.Where = "1=1"
+		qr, err := fieldseeker.DoQuery(layer.ID, query)
+		if err != nil {
+			return fmt.Errorf("Failed to list objectids of %s: %v", layer.Name, err)
+		}
+		if len(qr.Features) == 0 {
+			break
+		}
+		for _, feature := range qr.Features {
+			objectids = append(objectids, int(feature.Attributes["OBJECTID"].(float64)))
+		}
+	}
+	// Anything short of the whole layer would look like deletions
+	if len(objectids) != count {
+		log.Printf("Listed %d of the %d objectids of %s, not deleting anything\n", len(objectids), count, layer.Name)
+		return nil
+	}
+	deleted, err := database.DeleteMissingRows(context.Background(), "FS_"+layer.Name, objectids)
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		log.Printf("%d deleted from %s\n", deleted, layer.Name)
+	}
+	return nil
+}
+
 func saveRawQuery(layer arcgis.Layer, query *arcgis.Query, filename string) {
 	output, err := os.Create(filename)
 	if err != nil {
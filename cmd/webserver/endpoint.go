@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -11,6 +13,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
@@ -63,40 +66,134 @@ func apiAudioContentPost(w http.ResponseWriter, r *http.Request, u *shared.User)
 		http.Error(w, "Failed to parse image UUID", http.StatusBadRequest)
 		return
 	}
-	err = fssync.AudioFileContentWrite(audioUUID, r.Body)
-	if err != nil {
+	body := http.MaxBytesReader(w, r.Body, fssync.ReadConfig().Uploads.MaxBytes)
+	err = fssync.AudioFileContentWrite(r.Context(), audioUUID, body)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, "Audio file is too large", http.StatusRequestEntityTooLarge)
+		return
+	} else if err != nil {
 		log.Printf("Failed to write content file: %v", err)
 		http.Error(w, "failed to write content file", http.StatusInternalServerError)
+		return
 	}
 
-	fssync.EnqueueAudioJob(fssync.AudioJob{AudioUUID: audioUUID})
+	err = fssync.EnqueueAudioJob(fssync.AudioJob{AudioUUID: audioUUID})
+	if err != nil {
+		log.Printf("Failed to enqueue audio job: %v", err)
+		http.Error(w, "failed to enqueue audio processing", http.StatusInternalServerError)
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 }
 
+// apiClientIos sends the mosquito sources, service requests and traps. With since set to the
+// cursor of an earlier response it sends only what changed or was deleted after it.
 func apiClientIos(w http.ResponseWriter, r *http.Request, u *shared.User) {
 	query := database.NewQuery()
 	query.Limit = 0
-	sources, err := database.MosquitoSourceQuery(&query)
+	var since *time.Time
+	if s := r.URL.Query().Get("since"); s != "" {
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			http.Error(w, "since must be a cursor from an earlier response", http.StatusBadRequest)
+			return
+		}
+		since = &t
+		query.UpdatedSince = since
+	}
+	cursor, err := database.ClientSyncCursor(r.Context())
 	if err != nil {
 		render.Render(w, r, errRender(err))
 		return
 	}
-	requests, err := database.ServiceRequestQuery(&query)
+	reuploadAudio, err := database.AudioFileProbeReuploadList(r.Context(), u.ID)
 	if err != nil {
 		render.Render(w, r, errRender(err))
 		return
 	}
-	traps, err := database.TrapDataQuery(&query)
-	if err != nil {
-		render.Render(w, r, errRender(err))
+	// The cursor covers everything but the audio to reupload, which is per user
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n%s", cursor.Format(time.RFC3339Nano), strings.Join(reuploadAudio, ","))
+	etag := fmt.Sprintf(`"%x"`, hash.Sum(nil)[:16])
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
-	response := NewResponseClientIos(sources, requests, traps)
-	if err := render.Render(w, r, response); err != nil {
+	deleted := database.ClientDeleted{
+		MosquitoSources: make([]string, 0),
+		ServiceRequests: make([]string, 0),
+		TrapData:        make([]string, 0),
+	}
+	if since != nil {
+		deleted, err = database.ClientDeletedSince(r.Context(), *since)
+		if err != nil {
+			render.Render(w, r, errRender(err))
+			return
+		}
+	}
+
+	out, err := compressWriter(w, r)
+	if err != nil {
 		render.Render(w, r, errRender(err))
 		return
 	}
+	defer out.Close()
+	w.Header().Set("Content-Type", "application/json")
+	// The sources, requests and traps are read from the database a page at a time and written
+	// as they're read, so a district of any size takes the same memory. Once the response has
+	// started an error can only cut it short.
+	err = streamClientIos(out, query, cursor.Format(time.RFC3339Nano), deleted, reuploadAudio)
+	if err != nil {
+		log.Printf("Failed to stream client sync to user %d: %v", u.ID, err)
+	}
+}
+
+func streamClientIos(w io.Writer, query database.DBQuery, cursor string, deleted database.ClientDeleted, reuploadAudio []string) error {
+	stream := newJSONStream(w)
+	stream.Field("cursor", cursor)
+	stream.Field("deleted", NewResponseClientIosDeleted(deleted))
+	stream.Field("reupload_audio", reuploadAudio)
+	stream.BeginArray("sources")
+	err := database.MosquitoSourceEach(query, func(source shared.MosquitoSource) error {
+		return stream.Item(NewResponseMosquitoSource(source))
+	})
+	if err != nil {
+		return err
+	}
+	stream.EndArray()
+	stream.BeginArray("requests")
+	err = database.ServiceRequestEach(query, func(request shared.ServiceRequest) error {
+		return stream.Item(NewResponseServiceRequest(request))
+	})
+	if err != nil {
+		return err
+	}
+	stream.EndArray()
+	stream.BeginArray("traps")
+	err = database.TrapDataEach(query, func(trap shared.TrapData) error {
+		return stream.Item(NewResponseTrapDatum(trap))
+	})
+	if err != nil {
+		return err
+	}
+	stream.EndArray()
+	return stream.Close()
+}
+
+// etagMatches reports whether an If-None-Match header matches an ETag. Weak ETags match their
+// strong form.
+func etagMatches(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
 }
 
 func apiClientIosNotePut(w http.ResponseWriter, r *http.Request, u *shared.User) {
@@ -125,7 +222,14 @@ func apiClientIosNotePut(w http.ResponseWriter, r *http.Request, u *shared.User)
 		http.Error(w, "Failed to decode the payload", http.StatusBadRequest)
 		return
 	}
-	if err := database.NoteUpdate(context.Background(), noteUUID, payload); err != nil {
+	err = database.NoteUpdate(r.Context(), noteUUID, payload, u.ID)
+	if errors.Is(err, database.ErrNoteAttachmentMissing) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	} else if errors.Is(err, database.ErrNoteDeleted) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
 		render.Render(w, r, errRender(err))
 		return
 	}
@@ -173,48 +277,55 @@ func apiImageContentPost(w http.ResponseWriter, r *http.Request, u *shared.User)
 	if err != nil {
 		log.Println("Failed to parse image UUID", u_str)
 		http.Error(w, "Failed to parse image UUID", http.StatusBadRequest)
+		return
 	}
-	// Read first 8 bytes to check PNG signature
-	config := fssync.ReadConfig()
-	filepath := fmt.Sprintf("%s/%s.photo", config.UserFiles.Directory, imageUUID.String())
-
-	// Create file in configured directory
-	dst, err := os.Create(filepath)
-	if err != nil {
-		log.Printf("Failed to create image file %s: %v", filepath, err)
-		http.Error(w, "Unable to create file", http.StatusInternalServerError)
+	body := http.MaxBytesReader(w, r.Body, fssync.ReadConfig().Uploads.MaxBytes)
+	err = fssync.ImageFileContentWrite(r.Context(), imageUUID, body)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, "Image file is too large", http.StatusRequestEntityTooLarge)
+		return
+	} else if errors.Is(err, fssync.ErrNotAnImage) {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	} else if err != nil {
+		log.Printf("Failed to write image file: %v", err)
+		http.Error(w, "Unable to save file", http.StatusInternalServerError)
 		return
 	}
-	defer dst.Close()
 
-	// Copy rest of request body to file
-	_, err = io.Copy(dst, r.Body)
+	err = fssync.EnqueueImageJob(fssync.ImageJob{ImageUUID: imageUUID})
 	if err != nil {
-		http.Error(w, "Unable to save file", http.StatusInternalServerError)
+		log.Printf("Failed to enqueue image job: %v", err)
+		http.Error(w, "failed to enqueue image processing", http.StatusInternalServerError)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	log.Printf("Saved image file %s\n", imageUUID)
-	fmt.Fprintf(w, "PNG uploaded successfully to %s", filepath)
+	fmt.Fprintf(w, "PNG uploaded successfully to %s", fssync.ImageFileContentKeyRaw(imageUUID.String()))
 }
 
 func apiMosquitoSource(w http.ResponseWriter, r *http.Request, u *shared.User) {
-	bounds, err := parseBounds(r)
+	query, limit, err := parseListQuery(r, filtersMosquitoSource)
 	if err != nil {
-		render.Render(w, r, errRender(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	query := database.NewQuery()
-	query.Bounds = *bounds
-	query.Limit = 100
 	sources, err := database.MosquitoSourceQuery(&query)
 	if err != nil {
 		render.Render(w, r, errRender(err))
 		return
 	}
+	sources, _ = paginate(w, r, sources, limit, shared.MosquitoSource.ID)
 
+	w.Header().Add("Vary", "Accept")
+	if wantsGeoJSON(r) {
+		renderGeoJSONList(w, r, sources, func(s shared.MosquitoSource) (GeoJSONFeature, error) {
+			response := NewResponseMosquitoSource(s)
+			return NewGeoJSONFeature(response.ID, response.Location, response)
+		})
+		return
+	}
 	data := []render.Renderer{}
 	for _, s := range sources {
 		data = append(data, NewResponseMosquitoSource(s))
@@ -225,20 +336,26 @@ func apiMosquitoSource(w http.ResponseWriter, r *http.Request, u *shared.User) {
 }
 
 func apiServiceRequest(w http.ResponseWriter, r *http.Request, u *shared.User) {
-	bounds, err := parseBounds(r)
+	query, limit, err := parseListQuery(r, filtersServiceRequest)
 	if err != nil {
-		render.Render(w, r, errRender(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	query := database.NewQuery()
-	query.Bounds = *bounds
-	query.Limit = 100
 	requests, err := database.ServiceRequestQuery(&query)
 	if err != nil {
 		render.Render(w, r, errRender(err))
 		return
 	}
+	requests, _ = paginate(w, r, requests, limit, shared.ServiceRequest.ID)
 
+	w.Header().Add("Vary", "Accept")
+	if wantsGeoJSON(r) {
+		renderGeoJSONList(w, r, requests, func(sr shared.ServiceRequest) (GeoJSONFeature, error) {
+			response := NewResponseServiceRequest(sr)
+			return NewGeoJSONFeature(response.ID, response.Location, response)
+		})
+		return
+	}
 	data := []render.Renderer{}
 	for _, sr := range requests {
 		data = append(data, NewResponseServiceRequest(sr))
@@ -249,21 +366,26 @@ func apiServiceRequest(w http.ResponseWriter, r *http.Request, u *shared.User) {
 }
 
 func apiTrapData(w http.ResponseWriter, r *http.Request, u *shared.User) {
-	bounds, err := parseBounds(r)
+	query, limit, err := parseListQuery(r, filtersTrapData)
 	if err != nil {
-		render.Render(w, r, errRender(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	query := database.NewQuery()
-	query.Bounds = *bounds
-	query.Limit = 100
 	trap_data, err := database.TrapDataQuery(&query)
 	if err != nil {
 		render.Render(w, r, errRender(err))
 		return
 	}
+	trap_data, _ = paginate(w, r, trap_data, limit, shared.TrapData.ID)
 
+	w.Header().Add("Vary", "Accept")
+	if wantsGeoJSON(r) {
+		renderGeoJSONList(w, r, trap_data, func(td shared.TrapData) (GeoJSONFeature, error) {
+			response := NewResponseTrapDatum(td)
+			return NewGeoJSONFeature(response.ID, response.Location, response)
+		})
+		return
+	}
 	data := []render.Renderer{}
 	for _, td := range trap_data {
 		data = append(data, NewResponseTrapDatum(td))
@@ -273,32 +395,85 @@ func apiTrapData(w http.ResponseWriter, r *http.Request, u *shared.User) {
 	}
 }
 
+// audioWaveformGet serves the peak data or image of the waveform generated for an audio note
+func audioWaveformGet(w http.ResponseWriter, r *http.Request, u *shared.User) {
+	extension := chi.URLParam(r, "extension")
+	uuid, err := uuid.Parse(chi.URLParam(r, "uuid"))
+	if err != nil {
+		http.Error(w, "Invalid uuid", http.StatusBadRequest)
+		return
+	}
+	var key string
+	if extension == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		key = fssync.AudioFileContentKeyWaveformJSON(uuid.String())
+	} else if extension == "png" {
+		w.Header().Set("Content-Type", "image/png")
+		key = fssync.AudioFileContentKeyWaveformPNG(uuid.String())
+	} else {
+		http.Error(w, fmt.Sprintf("Extension '%s' not found", extension), http.StatusNotFound)
+		return
+	}
+	storage := fssync.UserFiles()
+	info, err := storage.Stat(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			http.Error(w, "Waveform not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	file, err := storage.Get(r.Context(), key)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+	http.ServeContent(w, r, key, info.ModTime, file)
+}
+
 func audioGet(w http.ResponseWriter, r *http.Request, u *shared.User) {
 	extension := chi.URLParam(r, "extension")
 	uuid_string := chi.URLParam(r, "uuid")
 	uuid, err := uuid.Parse(uuid_string)
 	if err != nil {
 		http.Error(w, "Invalid uuid", http.StatusBadRequest)
+		return
 	}
-	filePath := "unknown"
-	contentType := "unknown"
-	if extension == "m4a" {
-		contentType = "audio/mpeg"
-		filePath = fssync.AudioFileContentPathNormalized(uuid.String())
-	} else if extension == "mp3" {
-		contentType = "audio/mp3"
-		filePath = fssync.AudioFileContentPathMp3(uuid.String())
-	} else if extension == "ogg" {
-		contentType = "audio/ogg"
-		filePath = fssync.AudioFileContentPathOgg(uuid.String())
-	} else {
+	profile, err := fssync.AudioProfileByExtension(extension)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Extension '%s' not found", extension), http.StatusNotFound)
+		return
+	}
+	serveAudioFile(w, r, profile.Key(uuid.String()), profile.ContentType)
+}
+
+// audioTrimmedGet serves the audio with the silence between speech removed
+func audioTrimmedGet(w http.ResponseWriter, r *http.Request, u *shared.User) {
+	extension := chi.URLParam(r, "extension")
+	uuid, err := uuid.Parse(chi.URLParam(r, "uuid"))
+	if err != nil {
+		http.Error(w, "Invalid uuid", http.StatusBadRequest)
+		return
+	}
+	if extension != "m4a" {
 		http.Error(w, fmt.Sprintf("Extension '%s' not found", extension), http.StatusNotFound)
 		return
 	}
-	log.Printf("Serving %s", filePath)
+	serveAudioFile(w, r, fssync.AudioFileContentKeyTrimmed(uuid.String()), "audio/mp4")
+}
+
+// How long a presigned URL for a user file stays valid. Long enough to listen to a note.
+const presignExpiry = time.Hour
+
+func serveAudioFile(w http.ResponseWriter, r *http.Request, key string, contentType string) {
+	log.Printf("Serving %s", key)
+	storage := fssync.UserFiles()
 	// Check if file exists
-	if _, err := os.Stat(filePath); err != nil {
-		if os.IsNotExist(err) {
+	info, err := storage.Stat(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
 			http.Error(w, "Audio file not found", http.StatusNotFound)
 			return
 		}
@@ -306,21 +481,23 @@ func audioGet(w http.ResponseWriter, r *http.Request, u *shared.User) {
 		return
 	}
 
-	// Open the file
-	file, err := os.Open(filePath)
-	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	// Let the storage serve the file itself if it can
+	presigned, err := storage.PresignGet(r.Context(), key, contentType, presignExpiry)
+	if err == nil {
+		http.Redirect(w, r, presigned, http.StatusTemporaryRedirect)
 		return
+	} else if !errors.Is(err, fssync.ErrPresignUnsupported) {
+		log.Printf("Failed to presign %s: %v", key, err)
 	}
-	defer file.Close()
 
-	// Get file info
-	fileInfo, err := file.Stat()
+	// Open the file
+	file, err := storage.Get(r.Context(), key)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
-	fileSize := fileInfo.Size()
+	defer file.Close()
+	fileSize := info.Size
 
 	// Parse range header
 	rangeHeader := r.Header.Get("Range")
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+
+	"github.com/Gleipnir-Technology/fieldseeker-sync"
+	"github.com/Gleipnir-Technology/fieldseeker-sync/database"
+	"github.com/Gleipnir-Technology/fieldseeker-sync/shared"
+)
+
+// exportGet downloads every row of a layer that matches the same filters as the layer API
+func exportGet(w http.ResponseWriter, r *http.Request, u *shared.User) {
+	name := chi.URLParam(r, "layer")
+	layer, ok := database.Layers[name]
+	if !ok {
+		http.Error(w, "No such layer", http.StatusNotFound)
+		return
+	}
+	format, err := fssync.ExportFormatByExtension(chi.URLParam(r, "format"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	params := r.URL.Query()
+	if params.Has("cursor") || params.Has("limit") {
+		http.Error(w, "Exports have every matching row, so there's no cursor or limit", http.StatusBadRequest)
+		return
+	}
+	fields, err := layerFields(layer, params.Get("fields"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query, err := parseLayerQuery(r, layer)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filename := fmt.Sprintf("%s-%s.%s", name, time.Now().Format("2006-01-02"), format.Extension)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Content-Type", format.ContentType)
+	// A season of a big layer takes longer than the request timeout. Writes to a client that's
+	// gone still fail, which ends the export.
+	ctx := context.WithoutCancel(r.Context())
+	out := &exportResponse{ResponseWriter: w}
+	err = fssync.ExportLayer(ctx, out, format, name, fields, query)
+	if err != nil {
+		log.Printf("Failed to export %s: %v", name, err)
+		// Once part of the file is sent all we can do is stop
+		if !out.wrote {
+			w.Header().Del("Content-Disposition")
+			render.Render(w, r, errRender(err))
+		}
+	}
+}
+
+// exportResponse notes whether any of the export has been sent
+type exportResponse struct {
+	http.ResponseWriter
+	wrote bool
+}
+
+func (e *exportResponse) Write(p []byte) (int, error) {
+	e.wrote = true
+	return e.ResponseWriter.Write(p)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/render"
+)
+
+const contentTypeGeoJSON = "application/geo+json"
+
+// GeoJSONFeatureCollection is a GeoJSON FeatureCollection of points (RFC 7946)
+type GeoJSONFeatureCollection struct {
+	Features []GeoJSONFeature `json:"features"`
+	Type     string           `json:"type"`
+}
+
+type GeoJSONFeature struct {
+	Geometry   GeoJSONPoint   `json:"geometry"`
+	ID         string         `json:"id"`
+	Properties map[string]any `json:"properties"`
+	Type       string         `json:"type"`
+}
+
+type GeoJSONPoint struct {
+	// Longitude then latitude
+	Coordinates [2]float64 `json:"coordinates"`
+	Type        string     `json:"type"`
+}
+
+// NewGeoJSONFeature makes a point feature of an API response. Its fields become the
+// properties, except for the location, which becomes the geometry.
+func NewGeoJSONFeature(id string, location ResponseLocation, response any) (GeoJSONFeature, error) {
+	feature := GeoJSONFeature{
+		Geometry: GeoJSONPoint{
+			Coordinates: [2]float64{location.Longitude, location.Latitude},
+			Type:        "Point",
+		},
+		ID:   id,
+		Type: "Feature",
+	}
+	content, err := json.Marshal(response)
+	if err != nil {
+		return feature, err
+	}
+	if err := json.Unmarshal(content, &feature.Properties); err != nil {
+		return feature, err
+	}
+	delete(feature.Properties, "location")
+	return feature, nil
+}
+
+// wantsGeoJSON reports whether the client asked for GeoJSON, either with format=geojson or in
+// its Accept header. GeoJSON has to be asked for by name, a wildcard gets the usual JSON.
+func wantsGeoJSON(r *http.Request) bool {
+	if r.URL.Query().Get("format") == "geojson" {
+		return true
+	}
+	offers := []string{"application/json", contentTypeGeoJSON}
+	return NegotiateContent(r.Header.Values("Accept"), offers) == contentTypeGeoJSON
+}
+
+// renderGeoJSONList writes items as a FeatureCollection, each made a feature by feature
+func renderGeoJSONList[T any](w http.ResponseWriter, r *http.Request, items []T, feature func(T) (GeoJSONFeature, error)) {
+	features := make([]GeoJSONFeature, 0, len(items))
+	for _, item := range items {
+		f, err := feature(item)
+		if err != nil {
+			render.Render(w, r, errRender(err))
+			return
+		}
+		features = append(features, f)
+	}
+	renderGeoJSON(w, features)
+}
+
+func renderGeoJSON(w http.ResponseWriter, features []GeoJSONFeature) {
+	w.Header().Set("Content-Type", contentTypeGeoJSON)
+	err := json.NewEncoder(w).Encode(GeoJSONFeatureCollection{
+		Features: features,
+		Type:     "FeatureCollection",
+	})
+	if err != nil {
+		// The status is already sent, all that's left is to say so
+		log.Printf("Failed to write GeoJSON: %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWantsGeoJSON(t *testing.T) {
+	cases := []struct {
+		query    string
+		accept   string
+		expected bool
+	}{
+		{"", "", false},
+		{"?format=geojson", "", true},
+		{"?format=geojson", "application/json", true},
+		{"?format=json", "", false},
+		{"", contentTypeGeoJSON, true},
+		{"", "application/json;q=0.5, application/geo+json", true},
+		{"", "application/json", false},
+		// A wildcard doesn't ask for GeoJSON by name
+		{"", "*/*", false},
+		{"", "application/*", false},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/api/service-request"+c.query, nil)
+		if c.accept != "" {
+			r.Header.Set("Accept", c.accept)
+		}
+		if got := wantsGeoJSON(r); got != c.expected {
+			t.Errorf("Got %v for %q with Accept %q, expected %v", got, c.query, c.accept, c.expected)
+		}
+	}
+}
+
+func TestNewGeoJSONFeature(t *testing.T) {
+	response := ResponseServiceRequest{
+		ID:       "b0e2a1c4-0000-4000-8000-000000000001",
+		Location: ResponseLocation{Latitude: 36.7, Longitude: -119.8},
+		Priority: "High",
+		Status:   "Open",
+	}
+	feature, err := NewGeoJSONFeature(response.ID, response.Location, response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feature.Type != "Feature" || feature.ID != response.ID {
+		t.Errorf("Got feature %s of type %s", feature.ID, feature.Type)
+	}
+	if feature.Geometry.Type != "Point" || feature.Geometry.Coordinates != [2]float64{-119.8, 36.7} {
+		t.Errorf("Got geometry %+v, expected longitude then latitude", feature.Geometry)
+	}
+	if _, ok := feature.Properties["location"]; ok {
+		t.Error("The location is still a property")
+	}
+	if feature.Properties["id"] != response.ID || feature.Properties["priority"] != "High" || feature.Properties["status"] != "Open" {
+		t.Errorf("Got properties %v", feature.Properties)
+	}
+
+	// What a client reads
+	content, err := json.Marshal(feature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Geometry struct {
+			Coordinates []float64 `json:"coordinates"`
+		} `json:"geometry"`
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(content, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.ID != response.ID || len(decoded.Geometry.Coordinates) != 2 || decoded.Geometry.Coordinates[0] != -119.8 {
+		t.Errorf("Got %s", content)
+	}
+}
+
+func TestRenderGeoJSONList(t *testing.T) {
+	locations := []ResponseLocation{{Latitude: 1, Longitude: 2}, {Latitude: 3, Longitude: 4}}
+	r := httptest.NewRequest("GET", "/api/trap-data?format=geojson", nil)
+	w := httptest.NewRecorder()
+	renderGeoJSONList(w, r, locations, func(l ResponseLocation) (GeoJSONFeature, error) {
+		return NewGeoJSONFeature("", l, l)
+	})
+	if w.Header().Get("Content-Type") != contentTypeGeoJSON {
+		t.Errorf("Got Content-Type %s", w.Header().Get("Content-Type"))
+	}
+	var collection GeoJSONFeatureCollection
+	if err := json.Unmarshal(w.Body.Bytes(), &collection); err != nil {
+		t.Fatal(err)
+	}
+	if collection.Type != "FeatureCollection" || len(collection.Features) != 2 || collection.Features[1].Geometry.Coordinates != [2]float64{4, 3} {
+		t.Errorf("Got %s", w.Body.String())
+	}
+
+	// No partial collection when a feature fails
+	w = httptest.NewRecorder()
+	renderGeoJSONList(w, r, locations, func(l ResponseLocation) (GeoJSONFeature, error) {
+		return GeoJSONFeature{}, errors.New("no feature")
+	})
+	if w.Code == 200 || w.Header().Get("Content-Type") == contentTypeGeoJSON {
+		t.Errorf("Got %d %s", w.Code, w.Body.String())
+	}
+}
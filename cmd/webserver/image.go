@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/Gleipnir-Technology/fieldseeker-sync"
+	"github.com/Gleipnir-Technology/fieldseeker-sync/database"
+	"github.com/Gleipnir-Technology/fieldseeker-sync/shared"
+)
+
+// imageGet serves the photo as it was uploaded
+func imageGet(w http.ResponseWriter, r *http.Request, u *shared.User) {
+	imageUUID, err := uuid.Parse(chi.URLParam(r, "uuid"))
+	if err != nil {
+		http.Error(w, "Invalid uuid", http.StatusBadRequest)
+		return
+	}
+	files, err := database.ImageFileList(r.Context(), imageUUID.String())
+	if err != nil {
+		log.Printf("Failed to get files of image %s: %v", imageUUID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	for _, file := range files {
+		if file.Variant != "original" {
+			continue
+		}
+		if file.Problem != nil {
+			http.Error(w, "Image not found", http.StatusNotFound)
+			return
+		}
+		// Until the image is processed we let ServeContent sniff the type
+		if file.ContentType != nil {
+			w.Header().Set("Content-Type", *file.ContentType)
+		}
+	}
+	if !serveImageFile(w, r, fssync.ImageFileContentKeyRaw(imageUUID.String())) {
+		http.Error(w, "Image not found", http.StatusNotFound)
+	}
+}
+
+// imageSizeGet serves a resized copy of the photo in the best format the client accepts
+func imageSizeGet(w http.ResponseWriter, r *http.Request, u *shared.User) {
+	imageUUID, err := uuid.Parse(chi.URLParam(r, "uuid"))
+	if err != nil {
+		http.Error(w, "Invalid uuid", http.StatusBadRequest)
+		return
+	}
+	size, err := fssync.ImageSizeByName(chi.URLParam(r, "size"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	accept := r.Header.Values("Accept")
+	w.Header().Set("Vary", "Accept")
+	offers := make([]string, 0, len(fssync.ImageFormats))
+	for _, format := range fssync.ImageFormats {
+		offers = append(offers, format.ContentType)
+	}
+	// The formats the client takes, best first. Every browser takes JPEG so it's served when
+	// the client doesn't ask for it, unless it's refused.
+	acceptable := make([]string, 0, len(offers))
+	for len(offers) > 0 {
+		contentType := NegotiateContent(accept, offers)
+		if contentType == "" {
+			break
+		}
+		acceptable = append(acceptable, contentType)
+		offers = slices.DeleteFunc(offers, func(o string) bool { return o == contentType })
+	}
+	if slices.Contains(offers, "image/jpeg") && !refusesContent(accept, "image/jpeg") {
+		acceptable = append(acceptable, "image/jpeg")
+	}
+	if len(acceptable) == 0 {
+		http.Error(w, "No acceptable image format", http.StatusNotAcceptable)
+		return
+	}
+	// A derivative can be missing while it's being made, so we fall back to the next format
+	for _, contentType := range acceptable {
+		format := fssync.ImageFormatByContentType(contentType)
+		w.Header().Set("Content-Type", format.ContentType)
+		if serveImageFile(w, r, fssync.ImageFileContentKeyDerivative(imageUUID.String(), size, format)) {
+			return
+		}
+	}
+	w.Header().Del("Content-Type")
+	http.Error(w, "Image not found", http.StatusNotFound)
+}
+
+// serveImageFile streams an image from storage. ServeContent handles range requests and
+// conditional requests against the ETag and Last-Modified headers. Returns false without
+// writing anything if there's no such file.
+func serveImageFile(w http.ResponseWriter, r *http.Request, key string) bool {
+	storage := fssync.UserFiles()
+	info, err := storage.Stat(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false
+		}
+		log.Printf("Failed to stat %s: %v", key, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return true
+	}
+	file, err := storage.Get(r.Context(), key)
+	if err != nil {
+		log.Printf("Failed to get %s: %v", key, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return true
+	}
+	defer file.Close()
+	// Files are replaced rather than modified so the time and size identify the content
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime.UnixNano(), info.Size))
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	http.ServeContent(w, r, key, info.ModTime, file)
+	return true
+}
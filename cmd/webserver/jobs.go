@@ -0,0 +1,46 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/Gleipnir-Technology/fieldseeker-sync"
+	"github.com/Gleipnir-Technology/fieldseeker-sync/database"
+	"github.com/Gleipnir-Technology/fieldseeker-sync/html"
+	"github.com/Gleipnir-Technology/fieldseeker-sync/shared"
+)
+
+func jobsGet(w http.ResponseWriter, r *http.Request, u *shared.User) {
+	jobs, err := database.JobListFailing(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data := html.ContentJobs{
+		Jobs: jobs,
+		User: u,
+	}
+	err = html.Jobs(w, data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func jobsIdRequeuePost(w http.ResponseWriter, r *http.Request, u *shared.User) {
+	id_str := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(id_str)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("%s requeued job %d", u.Username, id)
+	err = fssync.RequeueJob(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/jobs", http.StatusFound)
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+
+	"github.com/Gleipnir-Technology/fieldseeker-sync/database"
+	"github.com/Gleipnir-Technology/fieldseeker-sync/html"
+	"github.com/Gleipnir-Technology/fieldseeker-sync/shared"
+)
+
+// Parameters of the layer endpoints that aren't filters on a column
+var layerParams = map[string]bool{
+	"cursor":        true,
+	"east":          true,
+	"fields":        true,
+	"limit":         true,
+	"north":         true,
+	"sort":          true,
+	"south":         true,
+	"updated_since": true,
+	"west":          true,
+}
+
+type ResponseLayer struct {
+	Columns []string `json:"columns"`
+	Name    string   `json:"name"`
+}
+
+func (rl ResponseLayer) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// layerCursor is what's in the cursor the client passes back. It keeps the sort it was made
+// with since it means nothing in any other order.
+type layerCursor struct {
+	database.LayerCursor
+	Sort string `json:"sort"`
+}
+
+// apiLayerList lists the layers and their columns
+func apiLayerList(w http.ResponseWriter, r *http.Request, u *shared.User) {
+	names := make([]string, 0, len(database.Layers))
+	for name := range database.Layers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	data := []render.Renderer{}
+	for _, name := range names {
+		data = append(data, ResponseLayer{
+			Columns: database.Layers[name].Columns,
+			Name:    name,
+		})
+	}
+	if err := render.RenderList(w, r, data); err != nil {
+		render.Render(w, r, errRender(err))
+	}
+}
+
+// apiLayerGet returns a page of the rows of a layer. Like the other lists, the next page is in
+// the Link header.
+func apiLayerGet(w http.ResponseWriter, r *http.Request, u *shared.User) {
+	layer, ok := database.Layers[chi.URLParam(r, "layer")]
+	if !ok {
+		http.Error(w, "No such layer", http.StatusNotFound)
+		return
+	}
+	params := r.URL.Query()
+	fields, err := layerFields(layer, params.Get("fields"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query, err := parseLayerQuery(r, layer)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query.Limit, err = parseListLimit(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sortParam := params.Get("sort")
+	if s := params.Get("cursor"); s != "" {
+		cursor, err := decodeLayerCursor(s)
+		if err != nil || cursor.Sort != sortParam {
+			http.Error(w, "cursor must be from the Link header of an earlier page with the same sort", http.StatusBadRequest)
+			return
+		}
+		query.After = &cursor.LayerCursor
+	}
+
+	rows, next, err := layer.List(r.Context(), query)
+	if err != nil {
+		log.Printf("Failed to list layer %s: %v", chi.URLParam(r, "layer"), err)
+		render.Render(w, r, errRender(err))
+		return
+	}
+	items := make([]database.LayerRow, 0, len(rows))
+	for _, row := range rows {
+		items = append(items, layerRowFields(row, fields))
+	}
+	if next != nil {
+		cursor, err := encodeLayerCursor(layerCursor{*next, sortParam})
+		if err != nil {
+			render.Render(w, r, errRender(err))
+			return
+		}
+		linkNext(w, r, cursor)
+	}
+	render.JSON(w, r, items)
+}
+
+// apiLayerRowGet returns a row of a layer by its globalid
+func apiLayerRowGet(w http.ResponseWriter, r *http.Request, u *shared.User) {
+	layer, ok := database.Layers[chi.URLParam(r, "layer")]
+	if !ok {
+		http.Error(w, "No such layer", http.StatusNotFound)
+		return
+	}
+	fields, err := layerFields(layer, r.URL.Query().Get("fields"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	row, err := layer.Get(r.Context(), chi.URLParam(r, "globalid"))
+	if err != nil {
+		render.Render(w, r, errRender(err))
+		return
+	}
+	if row == nil {
+		http.Error(w, "No such row", http.StatusNotFound)
+		return
+	}
+	render.JSON(w, r, layerRowFields(row, fields))
+}
+
+// layerRowGet shows every column of a row of a layer
+func layerRowGet(w http.ResponseWriter, r *http.Request, u *shared.User) {
+	name := chi.URLParam(r, "layer")
+	layer, ok := database.Layers[name]
+	if !ok {
+		http.Error(w, "No such layer", http.StatusNotFound)
+		return
+	}
+	row, err := layer.Get(r.Context(), chi.URLParam(r, "globalid"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if row == nil {
+		http.Error(w, "No such row", http.StatusNotFound)
+		return
+	}
+	fields, err := layer.RowText(r.Context(), row)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data := html.ContentLayerRow{
+		Fields: fields,
+		Layer:  name,
+		User:   u,
+	}
+	err = html.LayerRow(w, data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// parseLayerQuery reads the sort, bounds, updated_since and column filters of a request for the
+// rows of a layer. The error is meant for the client.
+func parseLayerQuery(r *http.Request, layer database.Layer) (database.LayerQuery, error) {
+	params := r.URL.Query()
+	query := database.LayerQuery{
+		Filters: make(map[string]string),
+	}
+	sortParam := params.Get("sort")
+	query.Sort = strings.TrimPrefix(sortParam, "-")
+	query.SortDescending = strings.HasPrefix(sortParam, "-")
+	if query.Sort != "" && !layer.HasColumn(query.Sort) {
+		return query, fmt.Errorf("No column %s to sort by", query.Sort)
+	}
+	if s := params.Get("updated_since"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return query, errors.New("updated_since must be an RFC 3339 time")
+		}
+		query.UpdatedSince = &t
+	}
+	if params.Has("east") || params.Has("north") || params.Has("south") || params.Has("west") {
+		bounds, err := parseBounds(r)
+		if err != nil {
+			return query, errors.New("Bounds need east, north, south and west")
+		}
+		query.Bounds = bounds
+	}
+	for name, values := range params {
+		if layerParams[name] {
+			continue
+		}
+		if !layer.HasColumn(name) {
+			return query, fmt.Errorf("No column %s to filter by", name)
+		}
+		if err := layer.CheckValue(name, values[0]); err != nil {
+			return query, fmt.Errorf("%s isn't a value of %s", values[0], name)
+		}
+		query.Filters[name] = values[0]
+	}
+	return query, nil
+}
+
+// layerFields checks the comma separated columns the client asked for. All of them are
+// returned when it didn't ask.
+func layerFields(layer database.Layer, param string) ([]string, error) {
+	if param == "" {
+		return nil, nil
+	}
+	fields := strings.Split(param, ",")
+	for _, field := range fields {
+		if !layer.HasColumn(field) {
+			return nil, fmt.Errorf("No column %s", field)
+		}
+	}
+	return fields, nil
+}
+
+func layerRowFields(row database.LayerRow, fields []string) database.LayerRow {
+	if fields == nil {
+		return row
+	}
+	result := make(database.LayerRow, len(fields))
+	for _, field := range fields {
+		result[field] = row[field]
+	}
+	return result
+}
+
+func encodeLayerCursor(cursor layerCursor) (string, error) {
+	content, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(content), nil
+}
+
+func decodeLayerCursor(s string) (layerCursor, error) {
+	var cursor layerCursor
+	content, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, err
+	}
+	err = json.Unmarshal(content, &cursor)
+	return cursor, err
+}
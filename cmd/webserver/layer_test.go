@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/Gleipnir-Technology/fieldseeker-sync/database"
+)
+
+func TestLayerCursor(t *testing.T) {
+	pond := "Pond"
+	empty := ""
+	cases := []layerCursor{
+		{database.LayerCursor{ObjectID: 5}, ""},
+		{database.LayerCursor{ObjectID: 5}, "-habitat"},
+		{database.LayerCursor{ObjectID: 7, Value: &pond}, "habitat"},
+		// An empty value isn't the same as a null one
+		{database.LayerCursor{ObjectID: 7, Value: &empty}, "habitat"},
+		{database.LayerCursor{ObjectID: -1}, "objectid"},
+	}
+	for _, c := range cases {
+		encoded, err := encodeLayerCursor(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := decodeLayerCursor(encoded)
+		if err != nil {
+			t.Errorf("%+v: %v", c, err)
+			continue
+		}
+		if !reflect.DeepEqual(decoded, c) {
+			t.Errorf("Got %+v back from %+v", decoded, c)
+		}
+	}
+	for _, s := range []string{"not base64!", "bm90IGpzb24"} {
+		if _, err := decodeLayerCursor(s); err == nil {
+			t.Errorf("%s: got no error", s)
+		}
+	}
+}
+
+func TestParseLayerQuery(t *testing.T) {
+	layer := database.Layers["pointlocation"]
+	r := httptest.NewRequest("GET", "/api/layers/pointlocation?sort=-habitat&zone=North&objectid=5&updated_since=2025-06-01T00:00:00Z&east=-119&north=37&south=36&west=-120&limit=5&fields=name", nil)
+	query, err := parseLayerQuery(r, layer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query.Sort != "habitat" || !query.SortDescending {
+		t.Errorf("Got sort %s descending %t", query.Sort, query.SortDescending)
+	}
+	if !reflect.DeepEqual(query.Filters, map[string]string{"objectid": "5", "zone": "North"}) {
+		t.Errorf("Got filters %v", query.Filters)
+	}
+	if query.UpdatedSince == nil || query.Bounds == nil || query.Bounds.West != -120 {
+		t.Errorf("Got updated since %v bounds %v", query.UpdatedSince, query.Bounds)
+	}
+
+	for _, params := range []string{
+		"sort=nosuchcolumn",
+		"nosuchcolumn=1",
+		"objectid=abc",
+		"active=yes",
+		"creationdate=2025-06-01",
+		"updated_since=yesterday",
+		"east=-119",
+	} {
+		r := httptest.NewRequest("GET", "/api/layers/pointlocation?"+params, nil)
+		if _, err := parseLayerQuery(r, layer); err == nil {
+			t.Errorf("%s: got no error", params)
+		}
+	}
+}
+
+func TestLayerLinkNext(t *testing.T) {
+	pond := "Pond"
+	cursor, err := encodeLayerCursor(layerCursor{database.LayerCursor{ObjectID: 7, Value: &pond}, "-habitat"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("GET", "/api/layers/pointlocation?sort=-habitat&limit=2&cursor=old", nil)
+	w := httptest.NewRecorder()
+	next := linkNext(w, r, cursor)
+	if link := w.Header().Get("Link"); link != "<"+next+`>; rel="next"` {
+		t.Errorf("Got Link %q", link)
+	}
+	params := httptest.NewRequest("GET", next, nil).URL.Query()
+	if params.Get("sort") != "-habitat" || params.Get("limit") != "2" {
+		t.Errorf("Next page %s lost the parameters", next)
+	}
+	decoded, err := decodeLayerCursor(params.Get("cursor"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.ObjectID != 7 || decoded.Value == nil || *decoded.Value != pond || decoded.Sort != "-habitat" {
+		t.Errorf("Got cursor %+v", decoded)
+	}
+}
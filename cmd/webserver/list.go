@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Gleipnir-Technology/fieldseeker-sync/database"
+)
+
+// How many items a page of a list has unless the client asks for a different number
+const listPageDefault = 100
+
+// The most items a page of a list can have
+const listPageMax = 1000
+
+// The filter parameters of the list endpoints and the columns they match
+var (
+	filtersMosquitoSource = map[string]string{
+		"assigned_tech": "assignedtech",
+		"priority":      "priority",
+		"zone":          "zone",
+	}
+	filtersServiceRequest = map[string]string{
+		"assigned_tech": "assignedtech",
+		"priority":      "priority",
+		"status":        "status",
+		"zone":          "zone",
+	}
+	filtersTrapData = map[string]string{
+		"priority": "priority",
+		"zone":     "zone",
+	}
+)
+
+// parseListQuery reads the bounds, filters, limit and cursor of a list endpoint. The query
+// asks for one more than the limit so paginate can tell whether there's another page.
+func parseListQuery(r *http.Request, filters map[string]string) (database.DBQuery, int, error) {
+	query := database.NewQuery()
+	params := r.URL.Query()
+	if params.Has("east") || params.Has("north") || params.Has("south") || params.Has("west") {
+		bounds, err := parseBounds(r)
+		if err != nil {
+			return query, 0, fmt.Errorf("Bounds need east, north, south and west")
+		}
+		query.Bounds = *bounds
+	}
+	limit, after, err := parseListPage(r)
+	if err != nil {
+		return query, 0, err
+	}
+	query.Limit = limit + 1
+	query.After = &after
+	query.Equals = make(map[string]string)
+	for param, column := range filters {
+		if value := params.Get(param); value != "" {
+			query.Equals[column] = value
+		}
+	}
+	for _, param := range []string{"created_after", "created_before"} {
+		s := params.Get(param)
+		if s == "" {
+			continue
+		}
+		t, err := parseListTime(s)
+		if err != nil {
+			return query, 0, fmt.Errorf("%s must be a date or an RFC 3339 time", param)
+		}
+		if param == "created_after" {
+			query.CreatedAfter = &t
+		} else {
+			query.CreatedBefore = &t
+		}
+	}
+	return query, limit, nil
+}
+
+// parseListPage reads the limit and cursor of a list endpoint. Pages are in globalid order, so
+// without a cursor the page starts after the lowest.
+func parseListPage(r *http.Request) (int, uuid.UUID, error) {
+	limit, err := parseListLimit(r)
+	if err != nil {
+		return 0, uuid.Nil, err
+	}
+	after := uuid.Nil
+	if s := r.URL.Query().Get("cursor"); s != "" {
+		content, err := base64.RawURLEncoding.DecodeString(s)
+		if err == nil {
+			after, err = uuid.FromBytes(content)
+		}
+		if err != nil {
+			return 0, uuid.Nil, fmt.Errorf("cursor must be from the Link header of an earlier page")
+		}
+	}
+	return limit, after, nil
+}
+
+// parseListLimit reads how many items the client wants in a page
+func parseListLimit(r *http.Request) (int, error) {
+	s := r.URL.Query().Get("limit")
+	if s == "" {
+		return listPageDefault, nil
+	}
+	limit, err := strconv.Atoi(s)
+	if err != nil || limit < 1 || limit > listPageMax {
+		return 0, fmt.Errorf("limit must be between 1 and %d", listPageMax)
+	}
+	return limit, nil
+}
+
+func parseListTime(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, s)
+	if err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", s, time.Local)
+}
+
+// paginate cuts the extra item parseListQuery asked for off a page and, if there was one,
+// links to the next page in the Link header. It returns the URL of the next page, which is
+// empty on the last page.
+func paginate[T any](w http.ResponseWriter, r *http.Request, items []T, limit int, id func(T) uuid.UUID) ([]T, string) {
+	if len(items) <= limit {
+		return items, ""
+	}
+	items = items[:limit]
+	last := id(items[limit-1])
+	return items, linkNext(w, r, base64.RawURLEncoding.EncodeToString(last[:]))
+}
+
+// linkNext links to the page after this one in the Link header and returns its URL. The next
+// page is the same request with the cursor replaced.
+func linkNext(w http.ResponseWriter, r *http.Request, cursor string) string {
+	next := *r.URL
+	params := next.Query()
+	params.Set("cursor", cursor)
+	next.RawQuery = params.Encode()
+	w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.String()))
+	return next.String()
+}
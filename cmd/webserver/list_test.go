@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestParseListQueryDefaults(t *testing.T) {
+	r := httptest.NewRequest("GET", "/api/service-request", nil)
+	query, limit, err := parseListQuery(r, filtersServiceRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limit != listPageDefault || query.Limit != listPageDefault+1 {
+		t.Errorf("Got limit %d querying %d", limit, query.Limit)
+	}
+	if query.After == nil || *query.After != uuid.Nil {
+		t.Errorf("Got after %v, expected the start", query.After)
+	}
+	if len(query.Equals) != 0 || query.CreatedAfter != nil || query.CreatedBefore != nil {
+		t.Errorf("Got filters %v created %v to %v", query.Equals, query.CreatedAfter, query.CreatedBefore)
+	}
+}
+
+func TestParseListQueryLimit(t *testing.T) {
+	cases := []struct {
+		limit string
+		ok    bool
+	}{
+		{"1", true},
+		{"250", true},
+		{"1000", true},
+		{"0", false},
+		{"-5", false},
+		{"1001", false},
+		{"ten", false},
+		{"1.5", false},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/api/service-request?limit="+c.limit, nil)
+		query, limit, err := parseListQuery(r, filtersServiceRequest)
+		if !c.ok {
+			if err == nil {
+				t.Errorf("%s: got limit %d, expected an error", c.limit, limit)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.limit, err)
+			continue
+		}
+		if c.limit != strconv.Itoa(limit) || query.Limit != limit+1 {
+			t.Errorf("%s: got limit %d querying %d", c.limit, limit, query.Limit)
+		}
+	}
+}
+
+func TestParseListQueryFilters(t *testing.T) {
+	r := httptest.NewRequest("GET", "/api/service-request?priority=High&status=Open&habitat=Pond&created_after=2025-06-01&created_before=2025-07-01T12:00:00Z&east=-119&north=37&south=36&west=-120", nil)
+	query, _, err := parseListQuery(r, filtersServiceRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Parameters that aren't filters of the endpoint are ignored
+	expected := map[string]string{"priority": "High", "status": "Open"}
+	if !reflect.DeepEqual(query.Equals, expected) {
+		t.Errorf("Got filters %v", query.Equals)
+	}
+	after := time.Date(2025, 6, 1, 0, 0, 0, 0, time.Local)
+	if query.CreatedAfter == nil || !query.CreatedAfter.Equal(after) {
+		t.Errorf("Got created after %v", query.CreatedAfter)
+	}
+	before := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	if query.CreatedBefore == nil || !query.CreatedBefore.Equal(before) {
+		t.Errorf("Got created before %v", query.CreatedBefore)
+	}
+	if query.Bounds.East != -119 || query.Bounds.North != 37 || query.Bounds.South != 36 || query.Bounds.West != -120 {
+		t.Errorf("Got bounds %+v", query.Bounds)
+	}
+
+	for _, params := range []string{
+		"created_after=yesterday",
+		"created_before=2025-13-01",
+		"east=-119&north=37",
+		"cursor=abc",
+		// Valid base64, but not the 16 bytes of a UUID
+		"cursor=AQID",
+	} {
+		r := httptest.NewRequest("GET", "/api/service-request?"+params, nil)
+		if _, _, err := parseListQuery(r, filtersServiceRequest); err == nil {
+			t.Errorf("%s: got no error", params)
+		}
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	ids := make([]uuid.UUID, 5)
+	for i := range ids {
+		ids[i] = uuid.New()
+	}
+
+	// The extra item the query asked for means there's another page
+	r := httptest.NewRequest("GET", "/api/service-request?limit=2&status=Open", nil)
+	w := httptest.NewRecorder()
+	page, next := paginate(w, r, ids[:3], 2, identity)
+	if !reflect.DeepEqual(page, ids[:2]) {
+		t.Errorf("Got page %v", page)
+	}
+	if next == "" {
+		t.Fatal("Got no next page")
+	}
+	link := w.Header().Get("Link")
+	if link != "<"+next+`>; rel="next"` {
+		t.Errorf("Got Link %q for next page %s", link, next)
+	}
+	nextRequest := httptest.NewRequest("GET", next, nil)
+	if nextRequest.URL.Path != "/api/service-request" {
+		t.Errorf("Got next page at %s", nextRequest.URL.Path)
+	}
+	params := nextRequest.URL.Query()
+	if params.Get("limit") != "2" || params.Get("status") != "Open" {
+		t.Errorf("Next page %s lost the parameters", next)
+	}
+	query, _, err := parseListQuery(nextRequest, filtersServiceRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *query.After != ids[1] {
+		t.Errorf("Got cursor for %s, expected %s", *query.After, ids[1])
+	}
+
+	// Without the extra item it's the last page
+	for _, items := range [][]uuid.UUID{ids[:2], ids[:1], {}} {
+		w := httptest.NewRecorder()
+		page, next := paginate(w, r, items, 2, identity)
+		if len(page) != len(items) || next != "" || w.Header().Get("Link") != "" {
+			t.Errorf("Got %d items, next %q and Link %q for the last page", len(page), next, w.Header().Get("Link"))
+		}
+	}
+}
+
+// TestPaginateAll follows the Link header through a list the way a client would
+func TestPaginateAll(t *testing.T) {
+	ids := make([]uuid.UUID, 7)
+	for i := range ids {
+		ids[i] = uuid.New()
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return bytes.Compare(ids[i][:], ids[j][:]) < 0
+	})
+
+	got := make([]uuid.UUID, 0)
+	url := "/api/trap-data?limit=3"
+	for pages := 0; url != ""; pages++ {
+		if pages > len(ids) {
+			t.Fatal("Got more pages than items")
+		}
+		r := httptest.NewRequest("GET", url, nil)
+		query, limit, err := parseListQuery(r, filtersTrapData)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// What the database returns: in order, after the cursor, up to the query's limit
+		rows := make([]uuid.UUID, 0)
+		for _, id := range ids {
+			if bytes.Compare(id[:], query.After[:]) > 0 && len(rows) < query.Limit {
+				rows = append(rows, id)
+			}
+		}
+		var page []uuid.UUID
+		page, url = paginate(httptest.NewRecorder(), r, rows, limit, identity)
+		got = append(got, page...)
+	}
+	if !reflect.DeepEqual(got, ids) {
+		t.Errorf("Got %v, expected %v", got, ids)
+	}
+}
+
+func identity(id uuid.UUID) uuid.UUID {
+	return id
+}
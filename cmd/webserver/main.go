@@ -3,15 +3,19 @@ package main
 import (
 	"context"
 	"embed"
+	"errors"
+	"expvar"
 	"fmt"
 	"io"
 	"io/fs"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/alexedwards/scs/pgxstore"
@@ -44,7 +48,9 @@ func errRender(err error) render.Renderer {
 }
 
 func main() {
-	log.Fatal(run())
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
 }
 
 func run() error {
@@ -63,8 +69,17 @@ func run() error {
 		os.Exit(1)
 	}
 
-	fssync.StartAudioWorker(context.Background())
-	err = fssync.StartLabelStudioWorker(context.Background())
+	// Cancelling this context stops the background workers and the web server
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err = fssync.StartAudioWorker(ctx)
+	if err != nil {
+		fmt.Printf("Failed to start audio processor: %v", err)
+		os.Exit(2)
+	}
+	fssync.StartImageWorker(ctx)
+	err = fssync.StartLabelStudioWorker(ctx)
 	if err != nil {
 		fmt.Printf("Failed to create label studio processor: %v", err)
 		os.Exit(2)
@@ -98,11 +113,23 @@ func run() error {
 	//html.InitializeTemplates()
 	r.Method("GET", "/", NewEnsureAuth(index))
 	r.Method("GET", "/audio/{uuid}.{extension}", NewEnsureAuth(audioGet))
+	r.Method("GET", "/audio/{uuid}/trimmed.{extension}", NewEnsureAuth(audioTrimmedGet))
+	r.Method("GET", "/audio/{uuid}/waveform.{extension}", NewEnsureAuth(audioWaveformGet))
+	r.Method("GET", "/debug/vars", NewEnsureAuth(debugVarsGet))
+	r.Method("GET", "/export/{layer}.{format}", NewEnsureAuth(exportGet))
+	r.Method("GET", "/image/{uuid}", NewEnsureAuth(imageGet))
+	r.Method("GET", "/image/{uuid}/{size}", NewEnsureAuth(imageSizeGet))
+	r.Method("GET", "/jobs", NewEnsureAuth(jobsGet))
+	r.Method("POST", "/jobs/{id}/requeue", NewEnsureAuth(jobsIdRequeuePost))
+	r.Method("GET", "/layers/{layer}/{globalid}", NewEnsureAuth(layerRowGet))
+	r.Method("GET", "/map", NewEnsureAuth(mapGet))
+	r.Method("GET", "/note/{uuid}", NewEnsureAuth(noteGet))
 	r.Method("GET", "/process-audio", NewEnsureAuth(processAudioGet))
 	r.Method("GET", "/process-audio/{id}", NewEnsureAuth(processAudioIdGet))
 	r.Method("POST", "/process-audio/{id}", NewEnsureAuth(processAudioIdPost))
 	r.Method("POST", "/process-audio/{id}/delete", NewEnsureAuth(processAudioIdDeletePost))
 	r.Method("GET", "/service-request", NewEnsureAuth(serviceRequestList))
+	r.Method("GET", "/tiles/{layer}/{z}/{x}/{y}.mvt", NewEnsureAuth(tileGet))
 
 	r.Get("/login", loginGet)
 	r.Post("/login", loginPost)
@@ -110,15 +137,27 @@ func run() error {
 
 	r.Route("/api", func(r chi.Router) {
 		r.Use(render.SetContentType(render.ContentTypeJSON))
+		r.Method("GET", "/layers", NewEnsureAuth(apiLayerList))
+		r.Method("GET", "/layers/{layer}", NewEnsureAuth(apiLayerGet))
+		r.Method("GET", "/layers/{layer}/{globalid}", NewEnsureAuth(apiLayerRowGet))
 		r.Method("GET", "/mosquito-source", NewEnsureAuth(apiMosquitoSource))
+		r.Method("GET", "/notes", NewEnsureAuth(apiNoteList))
+		r.Method("GET", "/notes/{uuid}", NewEnsureAuth(apiNoteGet))
+		r.Method("DELETE", "/notes/{uuid}", NewEnsureAuth(apiNoteDelete))
 		r.Method("GET", "/service-request", NewEnsureAuth(apiServiceRequest))
 		r.Method("GET", "/trap-data", NewEnsureAuth(apiTrapData))
 		r.Method("GET", "/client/ios", NewEnsureAuth(apiClientIos))
 		r.Method("PUT", "/client/ios/note/{uuid}", NewEnsureAuth(apiClientIosNotePut))
 		r.Method("POST", "/audio/{uuid}", NewEnsureAuth(apiAudioPost))
 		r.Method("POST", "/audio/{uuid}/content", NewEnsureAuth(apiAudioContentPost))
+		r.Method("POST", "/audio/{uuid}/upload", NewEnsureAuth(apiAudioUploadPost))
 		r.Method("POST", "/image/{uuid}", NewEnsureAuth(apiImagePost))
 		r.Method("POST", "/image/{uuid}/content", NewEnsureAuth(apiImageContentPost))
+		r.Method("POST", "/image/{uuid}/upload", NewEnsureAuth(apiImageUploadPost))
+		r.Method("GET", "/upload/{id}", NewEnsureAuth(apiUploadGet))
+		r.Method("HEAD", "/upload/{id}", NewEnsureAuth(apiUploadGet))
+		r.Method("PUT", "/upload/{id}", NewEnsureAuth(apiUploadPut))
+		r.Method("POST", "/upload/{id}/complete", NewEnsureAuth(apiUploadCompletePost))
 		r.Get("/webhook/fieldseeker", webhookFieldseeker)
 		r.Post("/webhook/fieldseeker", webhookFieldseeker)
 	})
@@ -129,8 +168,31 @@ func run() error {
 	if len(bind) == 0 {
 		bind = ":3000"
 	}
+	server := &http.Server{
+		Addr:    bind,
+		Handler: r,
+	}
+	go func() {
+		<-ctx.Done()
+		log.Println("Shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Failed to shut down web server: %v", err)
+		}
+	}()
 	log.Println("Serving web requests on", bind)
-	return http.ListenAndServe(bind, r)
+	err = server.ListenAndServe()
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	fssync.WaitForJobWorkers()
+	return nil
+}
+
+// debugVarsGet exposes the process metrics, including the job queue depth and processing times
+func debugVarsGet(w http.ResponseWriter, r *http.Request, u *shared.User) {
+	expvar.Handler().ServeHTTP(w, r)
 }
 
 func parseBounds(r *http.Request) (*shared.Bounds, error) {
@@ -171,21 +233,19 @@ func parseBounds(r *http.Request) (*shared.Bounds, error) {
 }
 
 func serviceRequestList(w http.ResponseWriter, r *http.Request, u *shared.User) {
-	bounds := shared.Bounds{
-		East:  -180,
-		North: 180,
-		South: -180,
-		West:  180,
+	query, limit, err := parseListQuery(r, filtersServiceRequest)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	query := database.NewQuery()
-	query.Bounds = bounds
-	query.Limit = 100
 	requests, err := database.ServiceRequestQuery(&query)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	requests, next := paginate(w, r, requests, limit, shared.ServiceRequest.ID)
 	sr := html.ContentServiceRequests{
+		NextURL:         next,
 		ServiceRequests: requests,
 		User:            u,
 	}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Gleipnir-Technology/fieldseeker-sync"
+	"github.com/Gleipnir-Technology/fieldseeker-sync/database"
+	"github.com/Gleipnir-Technology/fieldseeker-sync/html"
+	"github.com/Gleipnir-Technology/fieldseeker-sync/shared"
+)
+
+// mapGet shows the operations map. The layers on it are loaded from the API by the page.
+func mapGet(w http.ResponseWriter, r *http.Request, u *shared.User) {
+	extent, err := database.MosquitoSourceExtent(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sources := make([]html.AudioSource, 0)
+	for _, profile := range fssync.ServedAudioProfiles() {
+		sources = append(sources, html.AudioSource{
+			ContentType:  profile.ContentType,
+			LowBandwidth: profile.LowBandwidth,
+			URL:          fmt.Sprintf("/audio/{uuid}.%s", profile.Extension),
+		})
+	}
+	data := html.ContentMap{
+		AudioSources: sources,
+		Extent:       extent,
+		User:         u,
+	}
+	err = html.Map(w, data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
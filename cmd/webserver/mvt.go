@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// The Mapbox Vector Tile format is protocol buffers. Points are all the tiles hold, so rather
+// than pull in a protobuf library the few messages are encoded by hand. See
+// https://github.com/mapbox/vector-tile-spec/blob/master/2.1/vector_tile.proto
+
+// The size of a tile in its own coordinates
+const mvtExtent = 4096
+
+const (
+	wireVarint = 0
+	wire64Bit  = 1
+	wireBytes  = 2
+)
+
+// mvtLayer collects the point features of one layer of a tile
+type mvtLayer struct {
+	features [][]byte
+	keys     []string
+	keyIndex map[string]int
+	name     string
+	values   [][]byte
+	valIndex map[string]int
+}
+
+func newMVTLayer(name string) *mvtLayer {
+	return &mvtLayer{
+		keyIndex: make(map[string]int),
+		name:     name,
+		valIndex: make(map[string]int),
+	}
+}
+
+// AddPoint adds a point at x and y in tile coordinates. Properties that can't be held in a
+// tile are left out.
+func (l *mvtLayer) AddPoint(x int, y int, properties map[string]any) {
+	// Sorted so the same rows always make the same tile
+	keys := make([]string, 0, len(properties))
+	for key := range properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	tags := make([]byte, 0)
+	for _, key := range keys {
+		encoded, ok := mvtValue(properties[key])
+		if !ok {
+			continue
+		}
+		tags = appendVarint(tags, uint64(l.key(key)))
+		tags = appendVarint(tags, uint64(l.value(encoded)))
+	}
+	// A single MoveTo from the cursor's start at 0,0
+	geometry := appendVarint(nil, 1|1<<3)
+	geometry = appendVarint(geometry, zigzag(int64(x)))
+	geometry = appendVarint(geometry, zigzag(int64(y)))
+
+	feature := appendBytesField(nil, 2, tags)
+	// GeomType POINT
+	feature = appendVarintField(feature, 3, 1)
+	feature = appendBytesField(feature, 4, geometry)
+	l.features = append(l.features, feature)
+}
+
+func (l *mvtLayer) key(key string) int {
+	if i, ok := l.keyIndex[key]; ok {
+		return i
+	}
+	l.keyIndex[key] = len(l.keys)
+	l.keys = append(l.keys, key)
+	return len(l.keys) - 1
+}
+
+func (l *mvtLayer) value(encoded []byte) int {
+	if i, ok := l.valIndex[string(encoded)]; ok {
+		return i
+	}
+	l.valIndex[string(encoded)] = len(l.values)
+	l.values = append(l.values, encoded)
+	return len(l.values) - 1
+}
+
+// Bytes encodes the layer as a tile holding only it
+func (l *mvtLayer) Bytes() []byte {
+	layer := appendVarintField(nil, 15, 2)
+	layer = appendBytesField(layer, 1, []byte(l.name))
+	for _, feature := range l.features {
+		layer = appendBytesField(layer, 2, feature)
+	}
+	for _, key := range l.keys {
+		layer = appendBytesField(layer, 3, []byte(key))
+	}
+	for _, value := range l.values {
+		layer = appendBytesField(layer, 4, value)
+	}
+	layer = appendVarintField(layer, 5, mvtExtent)
+	return appendBytesField(nil, 3, layer)
+}
+
+// mvtValue encodes a property as a tile Value message
+func mvtValue(value any) ([]byte, bool) {
+	switch v := value.(type) {
+	case string:
+		return appendBytesField(nil, 1, []byte(v)), true
+	case float32:
+		return appendDoubleField(nil, 3, float64(v)), true
+	case float64:
+		return appendDoubleField(nil, 3, v), true
+	case int16:
+		return appendVarintField(nil, 6, zigzag(int64(v))), true
+	case int32:
+		return appendVarintField(nil, 6, zigzag(int64(v))), true
+	case int64:
+		return appendVarintField(nil, 6, zigzag(v)), true
+	case int:
+		return appendVarintField(nil, 6, zigzag(int64(v))), true
+	case bool:
+		var b uint64
+		if v {
+			b = 1
+		}
+		return appendVarintField(nil, 7, b), true
+	case fmt.Stringer:
+		return appendBytesField(nil, 1, []byte(v.String())), true
+	}
+	return nil, false
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendVarintField(b []byte, field int, v uint64) []byte {
+	b = appendVarint(b, uint64(field<<3|wireVarint))
+	return appendVarint(b, v)
+}
+
+func appendBytesField(b []byte, field int, content []byte) []byte {
+	b = appendVarint(b, uint64(field<<3|wireBytes))
+	b = appendVarint(b, uint64(len(content)))
+	return append(b, content...)
+}
+
+func appendDoubleField(b []byte, field int, v float64) []byte {
+	b = appendVarint(b, uint64(field<<3|wire64Bit))
+	bits := math.Float64bits(v)
+	for i := 0; i < 8; i++ {
+		b = append(b, byte(bits>>(8*i)))
+	}
+	return b
+}
+
+func zigzag(v int64) uint64 {
+	return uint64((v << 1) ^ (v >> 63))
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// pbField is a field of a protocol buffers message. Varint and 64-bit fields are in value,
+// length delimited fields in content.
+type pbField struct {
+	number  int
+	wire    int
+	value   uint64
+	content []byte
+}
+
+// readPB splits a message into its fields
+func readPB(b []byte) ([]pbField, error) {
+	fields := make([]pbField, 0)
+	for len(b) > 0 {
+		key, n := readPBVarint(b)
+		if n == 0 {
+			return nil, errors.New("truncated key")
+		}
+		b = b[n:]
+		field := pbField{number: int(key >> 3), wire: int(key & 7)}
+		switch field.wire {
+		case wireVarint:
+			field.value, n = readPBVarint(b)
+			if n == 0 {
+				return nil, errors.New("truncated varint")
+			}
+			b = b[n:]
+		case wire64Bit:
+			if len(b) < 8 {
+				return nil, errors.New("truncated 64-bit value")
+			}
+			for i := 0; i < 8; i++ {
+				field.value |= uint64(b[i]) << (8 * i)
+			}
+			b = b[8:]
+		case wireBytes:
+			length, n := readPBVarint(b)
+			if n == 0 || uint64(len(b)-n) < length {
+				return nil, errors.New("truncated bytes")
+			}
+			field.content = b[n : n+int(length)]
+			b = b[n+int(length):]
+		default:
+			return nil, errors.New("unknown wire type")
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// readPBVarint returns the varint at the start of b and its length, which is 0 if it's cut off
+func readPBVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < len(b) && i < 10; i++ {
+		v |= uint64(b[i]&0x7f) << (7 * i)
+		if b[i] < 0x80 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
+
+func unzigzag(v uint64) int64 {
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+// testMVTFeature is a point feature read back from a tile
+type testMVTFeature struct {
+	geomType   uint64
+	commands   []uint64
+	properties map[string]any
+}
+
+type testMVTLayer struct {
+	extent   uint64
+	features []testMVTFeature
+	name     string
+	version  uint64
+}
+
+// decodeTestTile reads the layers of a tile and the features in them
+func decodeTestTile(t *testing.T, tile []byte) []testMVTLayer {
+	t.Helper()
+	fields, err := readPB(tile)
+	if err != nil {
+		t.Fatalf("Failed to read tile: %v", err)
+	}
+	layers := make([]testMVTLayer, 0)
+	for _, field := range fields {
+		if field.number != 3 || field.wire != wireBytes {
+			t.Fatalf("Got unexpected field %d in the tile", field.number)
+		}
+		layers = append(layers, decodeTestLayer(t, field.content))
+	}
+	return layers
+}
+
+func decodeTestLayer(t *testing.T, content []byte) testMVTLayer {
+	t.Helper()
+	fields, err := readPB(content)
+	if err != nil {
+		t.Fatalf("Failed to read layer: %v", err)
+	}
+	var layer testMVTLayer
+	var keys []string
+	var values []any
+	var features [][]byte
+	for _, field := range fields {
+		switch field.number {
+		case 1:
+			layer.name = string(field.content)
+		case 2:
+			features = append(features, field.content)
+		case 3:
+			keys = append(keys, string(field.content))
+		case 4:
+			values = append(values, decodeTestValue(t, field.content))
+		case 5:
+			layer.extent = field.value
+		case 15:
+			layer.version = field.value
+		default:
+			t.Fatalf("Got unexpected field %d in layer", field.number)
+		}
+	}
+	for _, content := range features {
+		fields, err := readPB(content)
+		if err != nil {
+			t.Fatalf("Failed to read feature: %v", err)
+		}
+		feature := testMVTFeature{properties: make(map[string]any)}
+		for _, field := range fields {
+			switch field.number {
+			case 2:
+				tags, err := readPackedVarints(field.content)
+				if err != nil || len(tags)%2 != 0 {
+					t.Fatalf("Got bad tags %v: %v", tags, err)
+				}
+				for i := 0; i < len(tags); i += 2 {
+					if tags[i] >= uint64(len(keys)) || tags[i+1] >= uint64(len(values)) {
+						t.Fatalf("Got tag %d=%d outside of the keys and values", tags[i], tags[i+1])
+					}
+					feature.properties[keys[tags[i]]] = values[tags[i+1]]
+				}
+			case 3:
+				feature.geomType = field.value
+			case 4:
+				feature.commands, err = readPackedVarints(field.content)
+				if err != nil {
+					t.Fatalf("Failed to read geometry: %v", err)
+				}
+			default:
+				t.Fatalf("Got unexpected field %d in feature", field.number)
+			}
+		}
+		layer.features = append(layer.features, feature)
+	}
+	return layer
+}
+
+func decodeTestValue(t *testing.T, content []byte) any {
+	t.Helper()
+	fields, err := readPB(content)
+	if err != nil || len(fields) != 1 {
+		t.Fatalf("Failed to read value %v: %v", fields, err)
+	}
+	field := fields[0]
+	switch field.number {
+	case 1:
+		return string(field.content)
+	case 3:
+		return math.Float64frombits(field.value)
+	case 6:
+		return unzigzag(field.value)
+	case 7:
+		return field.value == 1
+	}
+	t.Fatalf("Got unexpected value field %d", field.number)
+	return nil
+}
+
+func readPackedVarints(b []byte) ([]uint64, error) {
+	values := make([]uint64, 0)
+	for len(b) > 0 {
+		v, n := readPBVarint(b)
+		if n == 0 {
+			return nil, errors.New("truncated varint")
+		}
+		values = append(values, v)
+		b = b[n:]
+	}
+	return values, nil
+}
+
+func TestMVTLayer(t *testing.T) {
+	layer := newMVTLayer("sources")
+	layer.AddPoint(100, 4000, map[string]any{
+		"active":   true,
+		"habitat":  "Pond",
+		"name":     "North pond",
+		"priority": int32(3),
+		"depth":    1.5,
+		// Tiles can't hold these so they're left out
+		"comments": []string{"a"},
+		"missing":  nil,
+	})
+	// Points in the buffer around the tile are outside of the extent
+	layer.AddPoint(-20, 4200, map[string]any{
+		"active":  false,
+		"habitat": "Pond",
+		"updated": time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC),
+		"visits":  int64(-2),
+	})
+
+	layers := decodeTestTile(t, layer.Bytes())
+	if len(layers) != 1 {
+		t.Fatalf("Got %d layers", len(layers))
+	}
+	decoded := layers[0]
+	if decoded.name != "sources" || decoded.version != 2 || decoded.extent != 4096 {
+		t.Errorf("Got layer %s version %d extent %d", decoded.name, decoded.version, decoded.extent)
+	}
+	expected := []testMVTFeature{
+		{
+			geomType: 1,
+			// MoveTo once, then the zigzagged x and y
+			commands: []uint64{9, 200, 8000},
+			properties: map[string]any{
+				"active":   true,
+				"depth":    1.5,
+				"habitat":  "Pond",
+				"name":     "North pond",
+				"priority": int64(3),
+			},
+		},
+		{
+			geomType: 1,
+			commands: []uint64{9, 39, 8400},
+			properties: map[string]any{
+				"active":  false,
+				"habitat": "Pond",
+				"updated": "2025-06-01 00:00:00 +0000 UTC",
+				"visits":  int64(-2),
+			},
+		},
+	}
+	if len(decoded.features) != len(expected) {
+		t.Fatalf("Got %d features", len(decoded.features))
+	}
+	for i, feature := range decoded.features {
+		if !reflect.DeepEqual(feature, expected[i]) {
+			t.Errorf("Got feature %d %+v, expected %+v", i, feature, expected[i])
+		}
+	}
+	// Keys and values the features share are only in the layer once
+	if len(layer.keys) != 7 || len(layer.values) != 8 {
+		t.Errorf("Got %d keys and %d values", len(layer.keys), len(layer.values))
+	}
+}
@@ -59,6 +59,17 @@ func NegotiateContent(accepts []string, offers []string) string {
 	return bestMatch
 }
 
+// refusesContent is whether the accept values rule out an offer with a quality of zero, rather
+// than not mentioning it
+func refusesContent(accepts []string, offer string) bool {
+	for _, accept := range parseAcceptValues(accepts) {
+		if matches(offer, accept.value) {
+			return accept.quality == 0
+		}
+	}
+	return false
+}
+
 // parseAcceptValues parses accept header values into structured format
 func parseAcceptValues(accepts []string) []acceptValue {
 	var values []acceptValue
@@ -63,3 +63,21 @@ func TestWildcard(t *testing.T) {
 		t.Errorf("wildcard mistakenly matched %v", result)
 	}
 }
+
+func TestRefused(t *testing.T) {
+	cases := []struct {
+		accepts []string
+		refused bool
+	}{
+		{[]string{"image/webp"}, false},
+		{[]string{"image/webp,image/jpeg;q=0"}, true},
+		{[]string{"image/webp,*/*;q=0"}, true},
+		{[]string{"image/*;q=0,image/jpeg"}, false},
+		{[]string{}, false},
+	}
+	for _, c := range cases {
+		if refused := refusesContent(c.accepts, "image/jpeg"); refused != c.refused {
+			t.Errorf("Got refused %v for %v", refused, c.accepts)
+		}
+	}
+}
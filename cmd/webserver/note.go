@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/google/uuid"
+
+	"github.com/Gleipnir-Technology/fieldseeker-sync"
+	"github.com/Gleipnir-Technology/fieldseeker-sync/database"
+	"github.com/Gleipnir-Technology/fieldseeker-sync/html"
+	"github.com/Gleipnir-Technology/fieldseeker-sync/shared"
+)
+
+// apiNoteList lists a page of notes, optionally only those inside the bounds given by east,
+// north, south and west, taken since the date or time in created_after, by the user with the
+// ID in creator, or updated after the RFC 3339 time in updated_since. Notes deleted since then
+// are included so the app can remove them. Pages are in UUID order and link to the next one
+// like the other lists.
+func apiNoteList(w http.ResponseWriter, r *http.Request, u *shared.User) {
+	limit, after, err := parseListPage(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	afterUUID := after.String()
+	filter := database.NoteFilter{
+		After: &afterUUID,
+		// One more than the limit so paginate can tell whether there's another page
+		Limit: limit + 1,
+	}
+	if r.FormValue("east") != "" || r.FormValue("north") != "" || r.FormValue("south") != "" || r.FormValue("west") != "" {
+		bounds, err := parseBounds(r)
+		if err != nil {
+			http.Error(w, "Bounds need east, north, south and west", http.StatusBadRequest)
+			return
+		}
+		filter.Bounds = bounds
+	}
+	if after := r.FormValue("created_after"); after != "" {
+		t, err := parseListTime(after)
+		if err != nil {
+			http.Error(w, "created_after must be a date or an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		filter.CreatedAfter = &t
+	}
+	if creator := r.FormValue("creator"); creator != "" {
+		id, err := strconv.Atoi(creator)
+		if err != nil {
+			http.Error(w, "Invalid creator", http.StatusBadRequest)
+			return
+		}
+		filter.CreatorID = &id
+	}
+	if since := r.FormValue("updated_since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			http.Error(w, "Invalid updated_since, it should be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		filter.UpdatedSince = &t
+	}
+	notes, err := database.NoteList(r.Context(), filter)
+	if err != nil {
+		render.Render(w, r, errRender(err))
+		return
+	}
+	notes, _ = paginate(w, r, notes, limit, noteID)
+	data := []render.Renderer{}
+	for _, note := range notes {
+		data = append(data, NewResponseNote(note))
+	}
+	if err := render.RenderList(w, r, data); err != nil {
+		render.Render(w, r, errRender(err))
+	}
+}
+
+// noteID is the UUID of a note. Notes are saved with the UUID parsed from their URL, so it's
+// always valid.
+func noteID(note *database.Note) uuid.UUID {
+	return uuid.MustParse(note.UUID)
+}
+
+func apiNoteGet(w http.ResponseWriter, r *http.Request, u *shared.User) {
+	noteUUID, err := uuid.Parse(chi.URLParam(r, "uuid"))
+	if err != nil {
+		http.Error(w, "Failed to decode the uuid", http.StatusBadRequest)
+		return
+	}
+	note, err := database.NoteGet(r.Context(), noteUUID.String())
+	if err != nil {
+		render.Render(w, r, errRender(err))
+		return
+	}
+	if note == nil {
+		http.Error(w, "Note not found", http.StatusNotFound)
+		return
+	}
+	audio, err := database.NoteAudioAttachmentList(r.Context(), note.UUID)
+	if err != nil {
+		render.Render(w, r, errRender(err))
+		return
+	}
+	images, err := database.NoteImageAttachmentList(r.Context(), note.UUID)
+	if err != nil {
+		render.Render(w, r, errRender(err))
+		return
+	}
+	if err := render.Render(w, r, NewResponseNoteDetail(note, audio, images)); err != nil {
+		render.Render(w, r, errRender(err))
+	}
+}
+
+// noteGet shows a note along with its audio and a gallery of its photos
+func noteGet(w http.ResponseWriter, r *http.Request, u *shared.User) {
+	noteUUID, err := uuid.Parse(chi.URLParam(r, "uuid"))
+	if err != nil {
+		http.Error(w, "Failed to decode the uuid", http.StatusBadRequest)
+		return
+	}
+	note, err := database.NoteGet(r.Context(), noteUUID.String())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if note == nil {
+		http.Error(w, "Note not found", http.StatusNotFound)
+		return
+	}
+	audio, err := database.NoteAudioAttachmentList(r.Context(), note.UUID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	images, err := database.NoteImageAttachmentList(r.Context(), note.UUID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	usersById, err := usersById()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	players := make([]html.NoteAudioPlayer, 0, len(audio))
+	for _, a := range audio {
+		sources := make([]html.AudioSource, 0)
+		for _, profile := range fssync.ServedAudioProfiles() {
+			sources = append(sources, html.AudioSource{
+				ContentType:  profile.ContentType,
+				LowBandwidth: profile.LowBandwidth,
+				URL:          fmt.Sprintf("/audio/%s.%s", a.UUID, profile.Extension),
+			})
+		}
+		players = append(players, html.NoteAudioPlayer{
+			NoteAudioAttachment: a,
+			Sources:             sources,
+		})
+	}
+	var creator *shared.User
+	if note.Creator != nil {
+		creator = usersById[*note.Creator]
+	}
+	data := html.ContentNote{
+		Audio:   players,
+		Creator: creator,
+		Images:  images,
+		Note:    note,
+		User:    u,
+	}
+	err = html.Note(w, data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// apiNoteDelete marks a note as deleted. It stays in the database along with who deleted it.
+func apiNoteDelete(w http.ResponseWriter, r *http.Request, u *shared.User) {
+	noteUUID, err := uuid.Parse(chi.URLParam(r, "uuid"))
+	if err != nil {
+		http.Error(w, "Failed to decode the uuid", http.StatusBadRequest)
+		return
+	}
+	deleted, err := database.NoteDelete(r.Context(), noteUUID.String(), u.ID)
+	if err != nil {
+		render.Render(w, r, errRender(err))
+		return
+	}
+	if !deleted {
+		http.Error(w, "Note not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
 	//"sort"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/go-chi/chi/v5"
 
+	"github.com/Gleipnir-Technology/fieldseeker-sync"
 	"github.com/Gleipnir-Technology/fieldseeker-sync/database"
 	"github.com/Gleipnir-Technology/fieldseeker-sync/database/models"
 	"github.com/Gleipnir-Technology/fieldseeker-sync/html"
@@ -90,16 +92,58 @@ func processAudioIdGet(w http.ResponseWriter, r *http.Request, u *shared.User) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	source, err := database.NoteAudioTranscriptionSourceGet(context.Background(), task.NoteAudioUUID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	probes, err := database.AudioFileProbeList(context.Background(), task.NoteAudioUUID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	segments, err := database.NoteAudioSegmentList(context.Background(), task.NoteAudioUUID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	noteUUID, err := database.NoteAudioNoteUUID(context.Background(), task.NoteAudioUUID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	images := make([]*database.NoteImage, 0)
+	if noteUUID != nil {
+		images, err = database.NoteImageAttachmentList(context.Background(), *noteUUID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
 	usersById, err := usersById()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	sources := make([]html.AudioSource, 0)
+	for _, profile := range fssync.ServedAudioProfiles() {
+		sources = append(sources, html.AudioSource{
+			ContentType:  profile.ContentType,
+			LowBandwidth: profile.LowBandwidth,
+			URL:          fmt.Sprintf("/audio/%s.%s", task.NoteAudioUUID, profile.Extension),
+		})
+	}
 	data := html.ContentProcessAudioId{
-		NoteAudio: noteAudio,
-		Task:      task,
-		UsersById: usersById,
-		User:      u,
+		AudioFileProbes:     probes,
+		AudioSources:        sources,
+		Images:              images,
+		NoteAudio:           noteAudio,
+		NoteUUID:            noteUUID,
+		Segments:            segments,
+		Task:                task,
+		TranscriptionSource: source,
+		UsersById:           usersById,
+		User:                u,
 	}
 
 	log.Printf("noteAudio %s isvalue %v", noteAudio.UUID, noteAudio.Transcription.IsNull())
@@ -40,4 +40,81 @@ function initAudio() {
 	);
 }
 
+function initWaveform() {
+	const audioPlayer = document.getElementById('audio');
+	const waveform = document.getElementById('waveform');
+	const cursor = document.getElementById('waveformCursor');
+	if (waveform == null) {
+		return;
+	}
+	audioPlayer.addEventListener('timeupdate', function () {
+		if (!audioPlayer.duration) {
+			return;
+		}
+		cursor.style.left = `${ (audioPlayer.currentTime / audioPlayer.duration) * 100 }%`;
+	});
+	waveform.addEventListener(
+		'click',
+		function (e) {
+			const clickPosition = e.clientX - waveform.getBoundingClientRect().left;
+			audioPlayer.currentTime = (clickPosition / waveform.offsetWidth) * audioPlayer.duration;
+		}
+	);
+}
+
+function initSegments() {
+	const audioPlayer = document.getElementById('audio');
+	const waveform = document.getElementById('waveform');
+	const buttons = Array.from(document.querySelectorAll('.btn.segment'));
+	if (buttons.length == 0) {
+		return;
+	}
+	const segments = buttons.map(function (button) {
+		return {
+			button: button,
+			end: parseFloat(button.dataset.end),
+			start: parseFloat(button.dataset.start),
+		};
+	});
+	function seek(segment) {
+		if (segment) {
+			audioPlayer.currentTime = segment.start;
+		}
+	}
+	segments.forEach(function (segment) {
+		segment.button.addEventListener('click', function () { seek(segment); });
+	});
+	document.getElementById('nextSegment').addEventListener('click', function () {
+		seek(segments.find((s) => s.start > audioPlayer.currentTime + 0.1));
+	});
+	document.getElementById('previousSegment').addEventListener('click', function () {
+		// Go back to the start of the current segment unless we're right at the start of it
+		seek(segments.findLast((s) => s.start < audioPlayer.currentTime - 1) || segments[0]);
+	});
+	audioPlayer.addEventListener('timeupdate', function () {
+		segments.forEach(function (s) {
+			const active = audioPlayer.currentTime >= s.start && audioPlayer.currentTime < s.end;
+			s.button.classList.toggle('active', active);
+		});
+	});
+	function drawSegments() {
+		if (waveform == null || !audioPlayer.duration) {
+			return;
+		}
+		segments.forEach(function (s) {
+			const region = document.createElement('div');
+			region.classList.add('waveform-segment');
+			region.style.left = `${ (s.start / audioPlayer.duration) * 100 }%`;
+			region.style.width = `${ ((s.end - s.start) / audioPlayer.duration) * 100 }%`;
+			waveform.appendChild(region);
+		});
+	}
+	audioPlayer.addEventListener('loadedmetadata', drawSegments);
+	if (audioPlayer.readyState >= 2) {
+		drawSegments();
+	}
+}
+
 window.addEventListener("load", initAudio);
+window.addEventListener("load", initWaveform);
+window.addEventListener("load", initSegments);
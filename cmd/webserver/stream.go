@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// The encodings we can compress responses with, best first
+var contentEncodings = []string{"zstd", "gzip", "identity"}
+
+// compressWriter picks an encoding from the request's Accept-Encoding and returns a writer that
+// compresses into w with it. It must be closed to flush the end of the response.
+func compressWriter(w http.ResponseWriter, r *http.Request) (io.WriteCloser, error) {
+	w.Header().Add("Vary", "Accept-Encoding")
+	accept := r.Header.Values("Accept-Encoding")
+	// Without the header NegotiateContent would pick the first offer, but the client only
+	// takes identity
+	if len(accept) == 0 {
+		return nopWriteCloser{w}, nil
+	}
+	switch NegotiateContent(accept, contentEncodings) {
+	case "zstd":
+		// One goroutine per response keeps the memory each request uses small
+		encoder, err := zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		w.Header().Del("Content-Length")
+		w.Header().Set("Content-Encoding", "zstd")
+		return encoder, nil
+	case "gzip":
+		w.Header().Del("Content-Length")
+		w.Header().Set("Content-Encoding", "gzip")
+		return gzip.NewWriter(w), nil
+	default:
+		return nopWriteCloser{w}, nil
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// jsonStream writes a JSON object a field at a time, and arrays in it an element at a time, so
+// a response doesn't have to be held in memory to be encoded. The first error stops all further
+// writes and is returned by every call after it.
+type jsonStream struct {
+	err    error
+	fields int
+	items  int
+	out    *bufio.Writer
+}
+
+func newJSONStream(w io.Writer) *jsonStream {
+	s := &jsonStream{out: bufio.NewWriter(w)}
+	s.write([]byte("{"))
+	return s
+}
+
+// Field writes a field with its whole value
+func (s *jsonStream) Field(name string, v any) error {
+	s.name(name)
+	s.value(v)
+	return s.err
+}
+
+// BeginArray starts a field holding an array. Write its elements with Item.
+func (s *jsonStream) BeginArray(name string) error {
+	s.name(name)
+	s.write([]byte("["))
+	s.items = 0
+	return s.err
+}
+
+// Item writes an element of the array started by BeginArray
+func (s *jsonStream) Item(v any) error {
+	if s.items > 0 {
+		s.write([]byte(","))
+	}
+	s.items++
+	s.value(v)
+	return s.err
+}
+
+func (s *jsonStream) EndArray() error {
+	s.write([]byte("]"))
+	return s.err
+}
+
+// Close ends the object and flushes it. It doesn't close the writer underneath.
+func (s *jsonStream) Close() error {
+	s.write([]byte("}"))
+	if s.err == nil {
+		s.err = s.out.Flush()
+	}
+	return s.err
+}
+
+func (s *jsonStream) name(name string) {
+	if s.fields > 0 {
+		s.write([]byte(","))
+	}
+	s.fields++
+	s.value(name)
+	s.write([]byte(":"))
+}
+
+func (s *jsonStream) value(v any) {
+	if s.err != nil {
+		return
+	}
+	content, err := json.Marshal(v)
+	if err != nil {
+		s.err = err
+		return
+	}
+	s.write(content)
+}
+
+func (s *jsonStream) write(content []byte) {
+	if s.err != nil {
+		return
+	}
+	_, s.err = s.out.Write(content)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+type streamItem struct {
+	Name     string         `json:"name"`
+	Children []streamItem   `json:"children,omitempty"`
+	Tags     map[string]int `json:"tags,omitempty"`
+}
+
+// writeTestStream writes an object with fields around two arrays, one of them empty
+func writeTestStream(w io.Writer) error {
+	stream := newJSONStream(w)
+	stream.Field("cursor", "2025-06-01T00:00:00Z")
+	stream.BeginArray("items")
+	stream.Item(streamItem{Name: "a"})
+	stream.Item(streamItem{Name: "b", Children: []streamItem{{Name: "c", Tags: map[string]int{"x": 1}}}})
+	stream.Item(streamItem{Name: "d"})
+	stream.EndArray()
+	stream.BeginArray("empty")
+	stream.EndArray()
+	stream.Field("deleted", map[string][]string{"sources": {"e", "f"}})
+	return stream.Close()
+}
+
+var testStreamExpected = map[string]any{
+	"cursor": "2025-06-01T00:00:00Z",
+	"items": []any{
+		map[string]any{"name": "a"},
+		map[string]any{"name": "b", "children": []any{
+			map[string]any{"name": "c", "tags": map[string]any{"x": 1.0}},
+		}},
+		map[string]any{"name": "d"},
+	},
+	"empty":   []any{},
+	"deleted": map[string]any{"sources": []any{"e", "f"}},
+}
+
+func TestJSONStream(t *testing.T) {
+	var out bytes.Buffer
+	if err := writeTestStream(&out); err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("Failed to decode %s: %v", out.String(), err)
+	}
+	if !reflect.DeepEqual(decoded, testStreamExpected) {
+		t.Errorf("Got %s", out.String())
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("client went away")
+}
+
+func TestJSONStreamError(t *testing.T) {
+	stream := newJSONStream(failingWriter{})
+	// The buffer holds the start of the object, so the error comes out when it's flushed
+	if err := stream.Close(); err == nil {
+		t.Fatal("Got no error from a failing writer")
+	}
+	if err := stream.Field("more", 1); err == nil {
+		t.Error("Got no error writing after a failure")
+	}
+
+	stream = newJSONStream(io.Discard)
+	if err := stream.Field("bad", func() {}); err == nil {
+		t.Fatal("Got no error for a value JSON can't encode")
+	}
+	if err := stream.Item(1); err == nil {
+		t.Error("Got no error writing after a failure")
+	}
+}
+
+func TestCompressWriter(t *testing.T) {
+	cases := []struct {
+		accept   []string
+		encoding string
+	}{
+		{nil, ""},
+		{[]string{"zstd"}, "zstd"},
+		{[]string{"gzip, deflate, br, zstd"}, "zstd"},
+		{[]string{"gzip"}, "gzip"},
+		{[]string{"gzip", "zstd;q=0.5"}, "gzip"},
+		{[]string{"gzip;q=0"}, ""},
+		{[]string{"gzip;q=0, zstd;q=0"}, ""},
+		{[]string{"br"}, ""},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/api/client/ios", nil)
+		for _, accept := range c.accept {
+			r.Header.Add("Accept-Encoding", accept)
+		}
+		w := httptest.NewRecorder()
+		out, err := compressWriter(w, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := writeTestStream(out); err != nil {
+			t.Fatal(err)
+		}
+		if err := out.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		encoding := w.Header().Get("Content-Encoding")
+		if encoding != c.encoding {
+			t.Errorf("%v: got encoding %q, expected %q", c.accept, encoding, c.encoding)
+			continue
+		}
+		if vary := w.Header().Get("Vary"); vary != "Accept-Encoding" {
+			t.Errorf("%v: got Vary %q", c.accept, vary)
+		}
+		var body io.Reader = w.Body
+		switch encoding {
+		case "zstd":
+			decoder, err := zstd.NewReader(w.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer decoder.Close()
+			body = decoder
+		case "gzip":
+			decoder, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body = decoder
+		}
+		var decoded map[string]any
+		if err := json.NewDecoder(body).Decode(&decoded); err != nil {
+			t.Errorf("%v: failed to decode: %v", c.accept, err)
+			continue
+		}
+		if !reflect.DeepEqual(decoded, testStreamExpected) {
+			t.Errorf("%v: got %v", c.accept, decoded)
+		}
+	}
+}
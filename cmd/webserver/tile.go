@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/Gleipnir-Technology/fieldseeker-sync/database"
+	"github.com/Gleipnir-Technology/fieldseeker-sync/shared"
+)
+
+// tileLayer is a FieldSeeker table that can be drawn as map tiles
+type tileLayer struct {
+	// The columns that become the properties of each point
+	Columns []string
+	Table   string
+}
+
+// The layers served as tiles, by the name in the URL. FieldSeeker zones and treatment areas are
+// polygons, but sync only keeps one point of each so they're drawn as points too.
+var tileLayers = map[string]tileLayer{
+	"service-requests": {
+		Columns: []string{"globalid", "priority", "reqaddr1", "reqcity", "status"},
+		Table:   "FS_ServiceRequest",
+	},
+	"sources": {
+		Columns: []string{"active", "globalid", "habitat", "name", "usetype", "zone"},
+		Table:   "FS_PointLocation",
+	},
+	"traps": {
+		Columns: []string{"description", "globalid", "name"},
+		Table:   "FS_TrapLocation",
+	},
+	"treatment-areas": {
+		Columns: []string{"comments", "globalid", "treatdate", "type"},
+		Table:   "FS_TreatmentArea",
+	},
+	"zones": {
+		Columns: []string{"active", "globalid", "name"},
+		Table:   "FS_Zones",
+	},
+}
+
+// The deepest zoom we make tiles for
+const tileMaxZoom = 22
+
+// Points this far outside a tile, in tile coordinates, are still drawn so markers on the
+// edge aren't cut in half
+const tileBuffer = 64
+
+// How many tiles of a layer are cached before the cache is emptied
+const tileCacheSize = 4096
+
+// tileCache holds the tiles of a layer made since the layer last changed
+type tileCache struct {
+	generation time.Time
+	tiles      map[string][]byte
+}
+
+var (
+	tileCaches     = make(map[string]*tileCache)
+	tileCacheMutex sync.Mutex
+)
+
+// tileGet serves a Mapbox Vector Tile of a layer
+func tileGet(w http.ResponseWriter, r *http.Request, u *shared.User) {
+	name := chi.URLParam(r, "layer")
+	layer, ok := tileLayers[name]
+	if !ok {
+		http.Error(w, "No such layer", http.StatusNotFound)
+		return
+	}
+	z, x, y, err := parseTile(chi.URLParam(r, "z"), chi.URLParam(r, "x"), chi.URLParam(r, "y"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	generation, err := database.TileGeneration(r.Context(), layer.Table)
+	if err != nil {
+		log.Printf("Failed to get generation of %s: %v", name, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	etag := fmt.Sprintf(`"%x"`, generation.UnixNano())
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Set("Content-Type", "application/vnd.mapbox-vector-tile")
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	key := fmt.Sprintf("%d/%d/%d", z, x, y)
+	tile, ok := tileCacheLoad(name, generation, key)
+	if !ok {
+		tile, err = tileMake(r, name, layer, z, x, y)
+		if err != nil {
+			log.Printf("Failed to make tile %s/%s: %v", name, key, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		tileCacheStore(name, generation, key, tile)
+	}
+	w.Write(tile)
+}
+
+func parseTile(zoom string, column string, row string) (int, int, int, error) {
+	z, err := strconv.Atoi(zoom)
+	if err != nil || z < 0 || z > tileMaxZoom {
+		return 0, 0, 0, fmt.Errorf("Zoom must be between 0 and %d", tileMaxZoom)
+	}
+	x, err := strconv.Atoi(column)
+	if err != nil || x < 0 || x >= 1<<z {
+		return 0, 0, 0, fmt.Errorf("No tile %s at zoom %d", column, z)
+	}
+	y, err := strconv.Atoi(row)
+	if err != nil || y < 0 || y >= 1<<z {
+		return 0, 0, 0, fmt.Errorf("No tile row %s at zoom %d", row, z)
+	}
+	return z, x, y, nil
+}
+
+func tileMake(r *http.Request, name string, layer tileLayer, z int, x int, y int) ([]byte, error) {
+	// The bounds of the tile and its buffer in degrees
+	buffer := float64(tileBuffer) / mvtExtent
+	bounds := shared.Bounds{
+		East:  tileLongitude(float64(x)+1+buffer, z),
+		North: tileLatitude(float64(y)-buffer, z),
+		South: tileLatitude(float64(y)+1+buffer, z),
+		West:  tileLongitude(float64(x)-buffer, z),
+	}
+	points, err := database.TilePointsQuery(r.Context(), layer.Table, layer.Columns, bounds)
+	if err != nil {
+		return nil, err
+	}
+	encoder := newMVTLayer(name)
+	n := math.Exp2(float64(z))
+	for _, point := range points {
+		// Web Mercator, scaled to the tile
+		latitude := point.Y * math.Pi / 180
+		px := ((point.X+180)/360*n - float64(x)) * mvtExtent
+		py := ((1-math.Log(math.Tan(latitude)+1/math.Cos(latitude))/math.Pi)/2*n - float64(y)) * mvtExtent
+		if math.IsNaN(px) || math.IsNaN(py) {
+			continue
+		}
+		encoder.AddPoint(int(math.Round(px)), int(math.Round(py)), point.Properties)
+	}
+	return encoder.Bytes(), nil
+}
+
+func tileLongitude(x float64, z int) float64 {
+	return x/math.Exp2(float64(z))*360 - 180
+}
+
+func tileLatitude(y float64, z int) float64 {
+	return math.Atan(math.Sinh(math.Pi*(1-2*y/math.Exp2(float64(z))))) * 180 / math.Pi
+}
+
+func tileCacheLoad(name string, generation time.Time, key string) ([]byte, bool) {
+	tileCacheMutex.Lock()
+	defer tileCacheMutex.Unlock()
+	cache, ok := tileCaches[name]
+	if !ok || !cache.generation.Equal(generation) {
+		return nil, false
+	}
+	tile, ok := cache.tiles[key]
+	return tile, ok
+}
+
+// tileCacheStore keeps a tile until the layer changes. A sync that changes the layer empties it.
+func tileCacheStore(name string, generation time.Time, key string, tile []byte) {
+	tileCacheMutex.Lock()
+	defer tileCacheMutex.Unlock()
+	cache, ok := tileCaches[name]
+	// A tile made before the layer last changed is out of date already
+	if ok && generation.Before(cache.generation) {
+		return
+	}
+	if !ok || cache.generation.Before(generation) || len(cache.tiles) >= tileCacheSize {
+		cache = &tileCache{
+			generation: generation,
+			tiles:      make(map[string][]byte),
+		}
+		tileCaches[name] = cache
+	}
+	cache.tiles[key] = tile
+}
@@ -2,27 +2,26 @@ package main
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/go-chi/render"
 
+	"github.com/Gleipnir-Technology/fieldseeker-sync/database"
 	"github.com/Gleipnir-Technology/fieldseeker-sync/shared"
 )
 
-// ResponseErr renderer type for handling all sorts of errors.
-type ResponseClientIos struct {
-	MosquitoSources []ResponseMosquitoSource `json:"sources"`
-	ServiceRequests []ResponseServiceRequest `json:"requests"`
-	TrapData        []ResponseTrapData       `json:"traps"`
+// The globalids of what the client should drop since its last sync
+type ResponseClientIosDeleted struct {
+	MosquitoSources []string `json:"sources"`
+	ServiceRequests []string `json:"requests"`
+	TrapData        []string `json:"traps"`
 }
 
-func (i ResponseClientIos) Render(w http.ResponseWriter, r *http.Request) error {
-	return nil
-}
-func NewResponseClientIos(sources []shared.MosquitoSource, requests []shared.ServiceRequest, traps []shared.TrapData) ResponseClientIos {
-	return ResponseClientIos{
-		MosquitoSources: NewResponseMosquitoSources(sources),
-		ServiceRequests: NewResponseServiceRequests(requests),
-		TrapData:        NewResponseTrapData(traps),
+func NewResponseClientIosDeleted(deleted database.ClientDeleted) ResponseClientIosDeleted {
+	return ResponseClientIosDeleted{
+		MosquitoSources: deleted.MosquitoSources,
+		ServiceRequests: deleted.ServiceRequests,
+		TrapData:        deleted.TrapData,
 	}
 }
 
@@ -186,18 +185,105 @@ func NewResponseMosquitoTreatments(treatments []shared.MosquitoTreatment) []Resp
 	return results
 }
 
+// ResponseNote is a note as listed, with the UUIDs of what's attached to it
 type ResponseNote struct {
-	CategoryName string `json:"categoryName"`
-	Content      string `json:"content"`
+	Audio    []string          `json:"audio"`
+	Created  *time.Time        `json:"created"`
+	Creator  *int              `json:"creator"`
+	Deleted  *time.Time        `json:"deleted"`
+	ID       string            `json:"id"`
+	Images   []string          `json:"images"`
+	Location *ResponseLocation `json:"location"`
+	Text     string            `json:"text"`
+	Updated  *time.Time        `json:"updated"`
+}
+
+func (rn ResponseNote) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+func NewResponseNote(note *database.Note) ResponseNote {
+	result := ResponseNote{
+		Audio:   note.Audio,
+		Created: note.Created,
+		Creator: note.Creator,
+		Deleted: note.Deleted,
+		ID:      note.UUID,
+		Images:  note.Images,
+		Text:    note.Text,
+		Updated: note.Updated,
+	}
+	if note.Latitude != nil && note.Longitude != nil {
+		result.Location = &ResponseLocation{
+			Latitude:  *note.Latitude,
+			Longitude: *note.Longitude,
+		}
+	}
+	return result
+}
 
-	ID        string           `json:"id"`
-	Location  ResponseLocation `json:"location"`
-	Timestamp string           `json:"timestamp"`
+// ResponseNoteDetail is a note along with everything attached to it
+type ResponseNoteDetail struct {
+	Audio    []ResponseNoteAudio `json:"audio"`
+	Created  *time.Time          `json:"created"`
+	Creator  *int                `json:"creator"`
+	ID       string              `json:"id"`
+	Images   []ResponseNoteImage `json:"images"`
+	Location *ResponseLocation   `json:"location"`
+	Text     string              `json:"text"`
+	Updated  *time.Time          `json:"updated"`
 }
 
-func (rtd ResponseNote) Render(w http.ResponseWriter, r *http.Request) error {
+func (rnd ResponseNoteDetail) Render(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
+func NewResponseNoteDetail(note *database.Note, audio []*database.NoteAudioAttachment, images []*database.NoteImage) ResponseNoteDetail {
+	summary := NewResponseNote(note)
+	result := ResponseNoteDetail{
+		Audio:    make([]ResponseNoteAudio, 0, len(audio)),
+		Created:  summary.Created,
+		Creator:  summary.Creator,
+		ID:       summary.ID,
+		Images:   make([]ResponseNoteImage, 0, len(images)),
+		Location: summary.Location,
+		Text:     summary.Text,
+		Updated:  summary.Updated,
+	}
+	for _, a := range audio {
+		result.Audio = append(result.Audio, ResponseNoteAudio{
+			Breadcrumbs:   a.Breadcrumbs,
+			Created:       a.Created,
+			Duration:      a.Duration,
+			ID:            a.UUID,
+			Transcription: a.Transcription,
+		})
+	}
+	for _, i := range images {
+		result.Images = append(result.Images, ResponseNoteImage{
+			Created: i.Created,
+			Height:  i.Height,
+			ID:      i.UUID,
+			Width:   i.Width,
+		})
+	}
+	return result
+}
+
+// ResponseNoteAudio has the breadcrumbs in the same form the app uploads them
+type ResponseNoteAudio struct {
+	Breadcrumbs   []shared.NoteAudioBreadcrumbPayload `json:"breadcrumbs"`
+	Created       time.Time                           `json:"created"`
+	Duration      *float32                            `json:"duration"`
+	ID            string                              `json:"id"`
+	Transcription *string                             `json:"transcription"`
+}
+
+// ResponseNoteImage has the dimensions of the upload, which are null until it's processed
+type ResponseNoteImage struct {
+	Created time.Time `json:"created"`
+	Height  *int      `json:"height"`
+	ID      string    `json:"id"`
+	Width   *int      `json:"width"`
+}
 
 type ResponseServiceRequest struct {
 	Address            string           `json:"address"`
@@ -272,3 +358,24 @@ func NewResponseTrapData(data []shared.TrapData) []ResponseTrapData {
 	}
 	return results
 }
+
+// ResponseUpload is the state of a resumable upload. Offset is where the client should
+// send the next chunk from.
+type ResponseUpload struct {
+	Complete bool   `json:"complete"`
+	ID       string `json:"id"`
+	Offset   int64  `json:"offset"`
+	Size     int64  `json:"size"`
+}
+
+func (ru ResponseUpload) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+func NewResponseUpload(session *database.UploadSession, offset int64) ResponseUpload {
+	return ResponseUpload{
+		Complete: session.Completed != nil,
+		ID:       session.ID,
+		Offset:   offset,
+		Size:     session.Size,
+	}
+}
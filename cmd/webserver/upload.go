@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/google/uuid"
+
+	"github.com/Gleipnir-Technology/fieldseeker-sync"
+	"github.com/Gleipnir-Technology/fieldseeker-sync/database"
+	"github.com/Gleipnir-Technology/fieldseeker-sync/shared"
+)
+
+var contentRangeRegexp = regexp.MustCompile(`^bytes (\d+)-(\d+)/(\d+)$`)
+
+// The body of a request to start an upload
+type uploadStartPayload struct {
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+func apiAudioUploadPost(w http.ResponseWriter, r *http.Request, u *shared.User) {
+	uploadStart(w, r, u, database.UploadKindAudio)
+}
+
+func apiImageUploadPost(w http.ResponseWriter, r *http.Request, u *shared.User) {
+	uploadStart(w, r, u, database.UploadKindImage)
+}
+
+// uploadStart begins a resumable upload, or finds the one the client already started for the
+// same file so that it can pick up where it left off.
+func uploadStart(w http.ResponseWriter, r *http.Request, u *shared.User, kind database.UploadKind) {
+	contentUUID, err := uuid.Parse(chi.URLParam(r, "uuid"))
+	if err != nil {
+		http.Error(w, "Failed to decode the uuid", http.StatusBadRequest)
+		return
+	}
+	var payload uploadStartPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Failed to decode the payload", http.StatusBadRequest)
+		return
+	}
+	session, err := fssync.UploadStart(r.Context(), kind, contentUUID, u.ID, payload.SHA256, payload.Size)
+	if errors.Is(err, fssync.ErrUploadTooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	} else if err != nil {
+		log.Printf("Failed to start upload of %s %s: %v", kind, contentUUID, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/api/upload/%s", session.ID))
+	renderUpload(w, r, session, http.StatusCreated)
+}
+
+// apiUploadGet reports how much of the file we have so the client knows where to resume
+func apiUploadGet(w http.ResponseWriter, r *http.Request, u *shared.User) {
+	session := uploadSession(w, r, u)
+	if session == nil {
+		return
+	}
+	renderUpload(w, r, session, http.StatusOK)
+}
+
+// apiUploadPut receives a chunk of the file. The Content-Range header says where the chunk is
+// in the file and the total size, which has to match the size the upload was started with.
+func apiUploadPut(w http.ResponseWriter, r *http.Request, u *shared.User) {
+	session := uploadSession(w, r, u)
+	if session == nil {
+		return
+	}
+	match := contentRangeRegexp.FindStringSubmatch(r.Header.Get("Content-Range"))
+	if match == nil {
+		http.Error(w, "Content-Range must look like 'bytes <start>-<end>/<size>'", http.StatusBadRequest)
+		return
+	}
+	start, _ := strconv.ParseInt(match[1], 10, 64)
+	end, _ := strconv.ParseInt(match[2], 10, 64)
+	total, _ := strconv.ParseInt(match[3], 10, 64)
+	if end < start || end >= total || total != session.Size {
+		http.Error(w, "Content-Range doesn't fit the upload", http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+	body := http.MaxBytesReader(w, r.Body, end-start+1)
+	offset, err := fssync.UploadAppend(r.Context(), session, start, body)
+	if errors.Is(err, fssync.ErrUploadOffset) {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		render.Render(w, r, errRender(err))
+		return
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	renderUpload(w, r, session, http.StatusOK)
+}
+
+// apiUploadCompletePost checks the file against its checksum and starts processing it
+func apiUploadCompletePost(w http.ResponseWriter, r *http.Request, u *shared.User) {
+	session := uploadSession(w, r, u)
+	if session == nil {
+		return
+	}
+	err := fssync.UploadComplete(r.Context(), session.ID)
+	if errors.Is(err, fssync.ErrUploadIncomplete) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if errors.Is(err, fssync.ErrUploadChecksum) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	} else if errors.Is(err, fssync.ErrNotAnImage) {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	} else if err != nil {
+		render.Render(w, r, errRender(err))
+		return
+	}
+	session, err = database.UploadSessionGet(r.Context(), session.ID)
+	if err != nil {
+		render.Render(w, r, errRender(err))
+		return
+	}
+	renderUpload(w, r, session, http.StatusOK)
+}
+
+func renderUpload(w http.ResponseWriter, r *http.Request, session *database.UploadSession, status int) {
+	offset, err := fssync.UploadOffset(session)
+	if err != nil {
+		render.Render(w, r, errRender(err))
+		return
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	render.Status(r, status)
+	render.Render(w, r, NewResponseUpload(session, offset))
+}
+
+// uploadSession gets the session named in the URL, writing an error response if it doesn't
+// exist or belongs to someone else
+func uploadSession(w http.ResponseWriter, r *http.Request, u *shared.User) *database.UploadSession {
+	session, err := database.UploadSessionGet(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		render.Render(w, r, errRender(err))
+		return nil
+	}
+	if session == nil || session.Creator != u.ID {
+		http.Error(w, "Upload not found", http.StatusNotFound)
+		return nil
+	}
+	return session
+}
@@ -2,6 +2,10 @@ package fssync
 
 import (
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type ConfigArcgis struct {
@@ -10,10 +14,52 @@ type ConfigArcgis struct {
 	TenantID           string
 	Token              string
 }
+type ConfigAudio struct {
+	JobTimeout time.Duration
+	// Profiles are the extensions of the audio profiles to generate for each note
+	Profiles []string
+	// Segmentation enables detecting speech and producing a copy with the silence trimmed
+	Segmentation bool
+	// SilenceDecibels is how far below full scale audio has to be to count as silence
+	SilenceDecibels int
+	// SilenceMinimum is the shortest gap between speech that we trim
+	SilenceMinimum time.Duration
+	Workers        int
+}
 type ConfigDatabase struct {
 	URL string
 }
+type ConfigImages struct {
+	JobTimeout time.Duration
+	Workers    int
+}
+type ConfigLabelStudio struct {
+	JobTimeout time.Duration
+}
+type ConfigJobs struct {
+	MaxAttempts int
+}
+type ConfigS3 struct {
+	AccessKeyID     string
+	BaseURL         string
+	SecretAccessKey string
+}
+type ConfigTranscriber struct {
+	// Engine selects the speech-to-text engine. Empty disables machine transcription.
+	Engine        string
+	Language      string
+	WhisperBinary string
+	WhisperModel  string
+}
+type ConfigUploads struct {
+	// Directory holds the chunks of uploads that haven't been completed yet
+	Directory string
+	MaxBytes  int64
+}
 type ConfigUserFiles struct {
+	// Backend is "local" to keep files in Directory or "s3" to keep them in Bucket
+	Backend   string
+	Bucket    string
 	Directory string
 }
 type ConfigWebhook struct {
@@ -21,10 +67,17 @@ type ConfigWebhook struct {
 }
 
 type Config struct {
-	Arcgis    ConfigArcgis
-	Database  ConfigDatabase
-	UserFiles ConfigUserFiles
-	Webhook   ConfigWebhook
+	Arcgis      ConfigArcgis
+	Audio       ConfigAudio
+	Database    ConfigDatabase
+	Images      ConfigImages
+	Jobs        ConfigJobs
+	LabelStudio ConfigLabelStudio
+	S3          ConfigS3
+	Transcriber ConfigTranscriber
+	Uploads     ConfigUploads
+	UserFiles   ConfigUserFiles
+	Webhook     ConfigWebhook
 }
 
 func ReadConfig() *Config {
@@ -33,11 +86,50 @@ func ReadConfig() *Config {
 	c.Arcgis.ServiceRoot = os.Getenv("FIELDSEEKER_SYNC_ARCGIS_SERVICEROOT")
 	c.Arcgis.TenantID = os.Getenv("FIELDSEEKER_SYNC_ARCGIS_TENANTID")
 	c.Arcgis.Token = os.Getenv("FIELDSEEKER_SYNC_ARCGIS_TOKEN")
+	c.Audio.JobTimeout = time.Duration(envInt("FIELDSEEKER_SYNC_AUDIO_JOB_TIMEOUT_SECONDS", 600)) * time.Second
+	c.Audio.Profiles = strings.Split(envString("FIELDSEEKER_SYNC_AUDIO_PROFILES", "ogg,webm"), ",")
+	c.Audio.Segmentation, _ = strconv.ParseBool(os.Getenv("FIELDSEEKER_SYNC_AUDIO_SEGMENTATION"))
+	c.Audio.SilenceDecibels = envInt("FIELDSEEKER_SYNC_AUDIO_SILENCE_DECIBELS", 35)
+	c.Audio.SilenceMinimum = time.Duration(envInt("FIELDSEEKER_SYNC_AUDIO_SILENCE_MINIMUM_SECONDS", 2)) * time.Second
+	c.Audio.Workers = envInt("FIELDSEEKER_SYNC_AUDIO_WORKERS", 2)
 	c.Database.URL = os.Getenv("FIELDSEEKER_SYNC_DATABASE_URL")
+	c.Images.JobTimeout = time.Duration(envInt("FIELDSEEKER_SYNC_IMAGE_JOB_TIMEOUT_SECONDS", 120)) * time.Second
+	c.Images.Workers = envInt("FIELDSEEKER_SYNC_IMAGE_WORKERS", 2)
+	c.Jobs.MaxAttempts = envInt("FIELDSEEKER_SYNC_JOBS_MAX_ATTEMPTS", 5)
+	c.LabelStudio.JobTimeout = time.Duration(envInt("FIELDSEEKER_SYNC_LABEL_STUDIO_JOB_TIMEOUT_SECONDS", 300)) * time.Second
+	c.S3.AccessKeyID = os.Getenv("S3_ACCESS_KEY_ID")
+	c.S3.BaseURL = os.Getenv("S3_BASE_URL")
+	c.S3.SecretAccessKey = os.Getenv("S3_SECRET_ACCESS_KEY")
+	c.Transcriber.Engine = os.Getenv("FIELDSEEKER_SYNC_TRANSCRIBER")
+	c.Transcriber.Language = envString("FIELDSEEKER_SYNC_TRANSCRIBER_LANGUAGE", "en")
+	c.Transcriber.WhisperBinary = envString("FIELDSEEKER_SYNC_WHISPER_BINARY", "whisper-cli")
+	c.Transcriber.WhisperModel = os.Getenv("FIELDSEEKER_SYNC_WHISPER_MODEL")
+	c.UserFiles.Backend = envString("FIELDSEEKER_SYNC_USERFILES_BACKEND", "local")
+	c.UserFiles.Bucket = os.Getenv("FIELDSEEKER_SYNC_USERFILES_BUCKET")
 	c.UserFiles.Directory = os.Getenv("FIELDSEEKER_SYNC_USERFILES_DIRECTORY")
 	if len(c.UserFiles.Directory) == 0 {
 		c.UserFiles.Directory = "/opt/fieldseeker-sync/data"
 	}
+	c.Uploads.Directory = envString("FIELDSEEKER_SYNC_UPLOADS_DIRECTORY", filepath.Join(c.UserFiles.Directory, ".uploads"))
+	c.Uploads.MaxBytes = int64(envInt("FIELDSEEKER_SYNC_UPLOADS_MAX_MEGABYTES", 200)) << 20
 	c.Webhook.Secret = os.Getenv("FIELDSEEKER_SYNC_WEBHOOK_SECRET")
 	return &c
 }
+
+// Read an integer from the environment, using the default if it's missing or invalid
+func envInt(name string, def int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || value <= 0 {
+		return def
+	}
+	return value
+}
+
+// Read a string from the environment, using the default if it's missing
+func envString(name string, def string) string {
+	value := os.Getenv(name)
+	if len(value) == 0 {
+		return def
+	}
+	return value
+}
@@ -0,0 +1,122 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+)
+
+type AudioFileProblem string
+
+const (
+	AudioFileProblemCorrupt          AudioFileProblem = "corrupt"
+	AudioFileProblemDurationMismatch AudioFileProblem = "duration-mismatch"
+	AudioFileProblemEmpty            AudioFileProblem = "empty"
+)
+
+// AudioFileProbe is what ffprobe found in one of the files for an audio note.
+// Variant is which file was probed, such as "raw" or "ogg".
+type AudioFileProbe struct {
+	Channels      *int              `db:"channels"`
+	Codec         *string           `db:"codec"`
+	Duration      *float32          `db:"duration"`
+	NoteAudioUUID string            `db:"note_audio_uuid"`
+	ProbeError    *string           `db:"probe_error"`
+	Probed        time.Time         `db:"probed"`
+	Problem       *AudioFileProblem `db:"problem"`
+	SampleRate    *int              `db:"sample_rate"`
+	Size          int64             `db:"size"`
+	Variant       string            `db:"variant"`
+}
+
+// Save the result of probing a file, replacing any earlier result for the same file
+func AudioFileProbeSave(ctx context.Context, probe *AudioFileProbe) error {
+	if PGInstance == nil {
+		return errors.New("You must initialize the DB first")
+	}
+	args := pgx.NamedArgs{
+		"channels":        probe.Channels,
+		"codec":           probe.Codec,
+		"duration":        probe.Duration,
+		"note_audio_uuid": probe.NoteAudioUUID,
+		"probe_error":     probe.ProbeError,
+		"probed":          probe.Probed,
+		"problem":         nil,
+		"sample_rate":     probe.SampleRate,
+		"size":            probe.Size,
+		"variant":         probe.Variant,
+	}
+	if probe.Problem != nil {
+		args["problem"] = string(*probe.Problem)
+	}
+	query := `
+		INSERT INTO audio_file_probe (channels, codec, duration, note_audio_uuid, probe_error, probed, problem, sample_rate, size, variant)
+		VALUES (@channels, @codec, @duration, @note_audio_uuid, @probe_error, @probed, @problem, @sample_rate, @size, @variant)
+		ON CONFLICT (note_audio_uuid, variant) DO UPDATE SET
+			channels = EXCLUDED.channels,
+			codec = EXCLUDED.codec,
+			duration = EXCLUDED.duration,
+			probe_error = EXCLUDED.probe_error,
+			probed = EXCLUDED.probed,
+			problem = EXCLUDED.problem,
+			sample_rate = EXCLUDED.sample_rate,
+			size = EXCLUDED.size
+	`
+	_, err := PGInstance.DB.Exec(ctx, query, args)
+	if err != nil {
+		return fmt.Errorf("Failed to save probe of %s %s: %v", probe.NoteAudioUUID, probe.Variant, err)
+	}
+	return nil
+}
+
+// Get the results of probing the files of an audio note
+func AudioFileProbeList(ctx context.Context, uuid string) ([]*AudioFileProbe, error) {
+	results := make([]*AudioFileProbe, 0)
+	if PGInstance == nil {
+		return results, errors.New("You must initialize the DB first")
+	}
+	args := pgx.NamedArgs{
+		"uuid": uuid,
+	}
+	query := `
+		SELECT channels, codec, duration, note_audio_uuid, probe_error, probed, problem, sample_rate, size, variant
+		FROM audio_file_probe
+		WHERE note_audio_uuid = @uuid
+		ORDER BY variant
+	`
+	if err := pgxscan.Select(ctx, PGInstance.DB, &results, query, args); err != nil {
+		return results, fmt.Errorf("Failed to query probes of %s: %v", uuid, err)
+	}
+	return results, nil
+}
+
+// Get the UUIDs of audio notes created by the user whose uploads were empty or corrupt
+// so that the client can upload them again
+func AudioFileProbeReuploadList(ctx context.Context, userID int) ([]string, error) {
+	results := make([]string, 0)
+	if PGInstance == nil {
+		return results, errors.New("You must initialize the DB first")
+	}
+	args := pgx.NamedArgs{
+		"corrupt": string(AudioFileProblemCorrupt),
+		"creator": userID,
+		"empty":   string(AudioFileProblemEmpty),
+	}
+	query := `
+		SELECT DISTINCT probe.note_audio_uuid
+		FROM audio_file_probe probe
+		JOIN note_audio note ON note.uuid = probe.note_audio_uuid
+		WHERE probe.variant = 'raw'
+			AND probe.problem IN (@corrupt, @empty)
+			AND note.creator = @creator
+			AND note.deleted IS NULL
+	`
+	if err := pgxscan.Select(ctx, PGInstance.DB, &results, query, args); err != nil {
+		return results, fmt.Errorf("Failed to query uploads to request again: %v", err)
+	}
+	return results, nil
+}
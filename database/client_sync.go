@@ -0,0 +1,89 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+)
+
+// ClientDeleted is the globalids of the FieldSeeker rows the client sync covers that have been
+// deleted
+type ClientDeleted struct {
+	MosquitoSources []string
+	ServiceRequests []string
+	TrapData        []string
+}
+
+// Get the time of the latest change to anything the client sync covers. Clients pass it back to
+// get only what changed after it. It's the zero time when there's nothing to sync.
+func ClientSyncCursor(ctx context.Context) (time.Time, error) {
+	if PGInstance == nil {
+		return time.Time{}, errors.New("You must initialize the DB first")
+	}
+	// GREATEST skips the NULLs of empty tables
+	query := `
+		SELECT GREATEST(
+			(SELECT MAX(updated) FROM FS_MosquitoInspection),
+			(SELECT MAX(updated) FROM FS_PointLocation),
+			(SELECT MAX(updated) FROM FS_ServiceRequest),
+			(SELECT MAX(updated) FROM FS_TrapLocation),
+			(SELECT MAX(updated) FROM FS_Treatment),
+			(SELECT MAX(deleted) FROM fs_deleted)
+		) AS cursor
+	`
+	var results []*struct {
+		Cursor *time.Time `db:"cursor"`
+	}
+	if err := pgxscan.Select(ctx, PGInstance.DB, &results, query); err != nil {
+		return time.Time{}, fmt.Errorf("Failed to query client sync cursor: %v", err)
+	}
+	if len(results) == 0 || results[0].Cursor == nil {
+		return time.Time{}, nil
+	}
+	return *results[0].Cursor, nil
+}
+
+// Get the mosquito sources, service requests and traps deleted after a time
+func ClientDeletedSince(ctx context.Context, since time.Time) (ClientDeleted, error) {
+	results := ClientDeleted{
+		MosquitoSources: make([]string, 0),
+		ServiceRequests: make([]string, 0),
+		TrapData:        make([]string, 0),
+	}
+	if PGInstance == nil {
+		return results, errors.New("You must initialize the DB first")
+	}
+	args := pgx.NamedArgs{
+		"since": since,
+	}
+	// The trigger records the table name as postgres folds it
+	query := `
+		SELECT DISTINCT globalid, table_name
+		FROM fs_deleted
+		WHERE deleted > @since
+			AND table_name IN ('fs_pointlocation', 'fs_servicerequest', 'fs_traplocation')
+		ORDER BY table_name, globalid
+	`
+	var rows []*struct {
+		GlobalID  string `db:"globalid"`
+		TableName string `db:"table_name"`
+	}
+	if err := pgxscan.Select(ctx, PGInstance.DB, &rows, query, args); err != nil {
+		return results, fmt.Errorf("Failed to query deleted rows: %v", err)
+	}
+	for _, row := range rows {
+		switch row.TableName {
+		case "fs_pointlocation":
+			results.MosquitoSources = append(results.MosquitoSources, row.GlobalID)
+		case "fs_servicerequest":
+			results.ServiceRequests = append(results.ServiceRequests, row.GlobalID)
+		case "fs_traplocation":
+			results.TrapData = append(results.TrapData, row.GlobalID)
+		}
+	}
+	return results, nil
+}
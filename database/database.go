@@ -19,6 +19,7 @@ import (
 	"github.com/georgysavva/scany/v2/pgxscan"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/jackc/pgx/v5/stdlib"
 	_ "github.com/jackc/pgx/v5/stdlib"
@@ -82,6 +83,16 @@ func ConnectDB(ctx context.Context, connection_string string) error {
 type DBQuery struct {
 	Bounds shared.Bounds
 	Limit  int
+	// Only rows updated after this time, if set
+	UpdatedSince *time.Time
+	// Only rows with a globalid after this one, in globalid order, if set
+	After *uuid.UUID
+	// Only rows created in this range, if set
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	// Only rows where the column equals the value. The columns are put in the query as they
+	// are, so they must not come from the user.
+	Equals map[string]string
 }
 
 func NewQuery() DBQuery {
@@ -96,7 +107,12 @@ func MosquitoSourceQuery(q *DBQuery) ([]shared.MosquitoSource, error) {
 	if PGInstance == nil {
 		return results, errors.New("You must initialize the DB first")
 	}
-	args, query := prepQuery(q, "SELECT GEOMETRY_X AS \"geometry.X\",GEOMETRY_Y AS \"geometry.Y\",accessdesc,active,comments,creationdate,description,habitat,lastinspectdate,name,nextactiondatescheduled,usetype,waterorigin,zone,globalid FROM FS_PointLocation WHERE GEOMETRY_X > @west AND GEOMETRY_X < @east AND GEOMETRY_Y > @south AND GEOMETRY_Y < @north")
+	predicate := "SELECT GEOMETRY_X AS \"geometry.X\",GEOMETRY_Y AS \"geometry.Y\",accessdesc,active,comments,creationdate,description,habitat,lastinspectdate,name,nextactiondatescheduled,usetype,waterorigin,zone,globalid FROM FS_PointLocation WHERE GEOMETRY_X > @west AND GEOMETRY_X < @east AND GEOMETRY_Y > @south AND GEOMETRY_Y < @north"
+	// A source has changed when it or any of its inspections or treatments has
+	if q.UpdatedSince != nil {
+		predicate += " AND (updated > @updated_since OR globalid IN (SELECT pointlocid FROM FS_MosquitoInspection WHERE updated > @updated_since) OR globalid IN (SELECT pointlocid FROM FS_Treatment WHERE updated > @updated_since))"
+	}
+	args, query := prepQuery(q, predicate)
 
 	rows, _ := PGInstance.DB.Query(context.Background(), query, args)
 	var locations []*shared.FS_PointLocation
@@ -168,85 +184,199 @@ func NoteImageCreate(ctx context.Context, noteUUID uuid.UUID, payload shared.Not
 	return nil
 }
 
-func NoteUpdate(ctx context.Context, noteUUID uuid.UUID, payload shared.NidusNotePayload) error {
-	args := pgx.NamedArgs{
-		"uuid": noteUUID,
+// ErrNoteAttachmentMissing means a note lists an audio or image note that we don't have.
+// Clients create the audio and image notes before the note they're attached to.
+var ErrNoteAttachmentMissing = errors.New("note attachment does not exist")
+
+// ErrNoteDeleted means the note was deleted. Updating it wouldn't bring it back, so nothing is
+// saved.
+var ErrNoteDeleted = errors.New("note is deleted")
+
+// Create or update a note. Each change to the location or text is saved as a version in
+// history_note. Audio and image notes that are attached to or detached from the note get a
+// new version with note_uuid set or cleared. A nil list of attachments is left as it is, so
+// clients that don't send audio don't detach it.
+func NoteUpdate(ctx context.Context, noteUUID uuid.UUID, payload shared.NidusNotePayload, userID int) error {
+	if PGInstance == nil {
+		return errors.New("You must initialize the DB first")
 	}
-	rows, err := PGInstance.DB.Query(ctx, "SELECT note.latitude,note.longitude,note.text,MAX(history_note.version) AS version_max FROM note INNER JOIN history_note ON note.uuid=history_note.note_uuid WHERE note.uuid=@uuid", args)
+	var options pgx.TxOptions
+	transaction, err := PGInstance.DB.BeginTx(ctx, options)
 	if err != nil {
-		return fmt.Errorf("Failed to query for note: %v\n", err)
+		return fmt.Errorf("Failed to begin transaction: %v", err)
 	}
-	defer rows.Close()
-	for rows.Next() {
-		var (
-			latitude    float64
-			longitude   float64
-			text        string
-			version_max int
-		)
-		if err = rows.Scan(&latitude, &longitude, &text, &version_max); err != nil {
-			return fmt.Errorf("Failed to scan note: %v\n", err)
+	// Does nothing once the transaction is committed
+	defer transaction.Rollback(ctx)
+
+	err = noteUpsert(ctx, transaction, noteUUID.String(), payload, userID)
+	if err != nil {
+		return err
+	}
+	attachmentsChanged := false
+	if payload.Audio != nil {
+		changed, err := noteAttachmentsUpdate(ctx, transaction, "note_audio", noteUUID.String(), payload.Audio, userID)
+		if err != nil {
+			return err
 		}
-		if latitude != payload.Location.Latitude || longitude != payload.Location.Longitude || text != payload.Text {
-			var options pgx.TxOptions
-			transaction, err := PGInstance.DB.BeginTx(ctx, options)
-			if err != nil {
-				return fmt.Errorf("Failed to begin transaction: %v", err)
-			}
-			query := "INSERT INTO history_note created,latitude,longitude,text,version,uuid VALUES (@created,@latitude,@longitude,@text,@version,@uuid)"
-			args = pgx.NamedArgs{
-				"created":   time.Now(),
-				"latitude":  payload.Location.Latitude,
-				"longitude": payload.Location.Longitude,
-				"text":      payload.Text,
-				"version":   version_max + 1,
-				"updated":   time.Now(),
-				"uuid":      payload.UUID,
-			}
-			if _, err := transaction.Exec(ctx, query, args); err != nil {
-				transaction.Rollback(ctx)
-				return fmt.Errorf("Failed to insert note history: %v", err)
-			}
-			query = "UPDATE note SET latitude=@latitude,longitude=@longitude,text=@text,updated=@updated WHERE uuid=@uuid"
-			if _, err := transaction.Exec(ctx, query, args); err != nil {
-				transaction.Rollback(ctx)
-				return fmt.Errorf("Failed to update note : %v", err)
-			}
-			err = transaction.Commit(ctx)
-			if err != nil {
-				return fmt.Errorf("Failed to commit transaction: %v", err)
-			}
+		attachmentsChanged = attachmentsChanged || changed
+	}
+	if payload.Images != nil {
+		changed, err := noteAttachmentsUpdate(ctx, transaction, "note_image", noteUUID.String(), payload.Images, userID)
+		if err != nil {
+			return err
 		}
+		attachmentsChanged = attachmentsChanged || changed
 	}
-
-	args = pgx.NamedArgs{
-		"uuid": noteUUID,
+	// Clients use the updated time to find what changed since they last synced
+	if attachmentsChanged {
+		args := pgx.NamedArgs{
+			"updated": time.Now(),
+			"uuid":    noteUUID.String(),
+		}
+		_, err = transaction.Exec(ctx, "UPDATE note SET updated=@updated WHERE uuid=@uuid", args)
+		if err != nil {
+			return fmt.Errorf("Failed to update note %s: %v", noteUUID, err)
+		}
 	}
-	rows, err = PGInstance.DB.Query(ctx, "SELECT uuid FROM note_audio_recording WHERE note_uuid=@uuid", args)
+	err = transaction.Commit(ctx)
 	if err != nil {
-		return fmt.Errorf("Failed to query for note audio recordings: %v", err)
+		return fmt.Errorf("Failed to commit transaction: %v", err)
 	}
-	var audio_uuids []string
-	if err = pgxscan.ScanAll(&audio_uuids, rows); err != nil {
-		return fmt.Errorf("Failed to scan audio UUIDs: %v", err)
+	return nil
+}
+
+// noteUpsert creates the note or saves a new version of it if the location or text changed.
+// Returns ErrNoteDeleted if the note was deleted.
+func noteUpsert(ctx context.Context, transaction pgx.Tx, noteUUID string, payload shared.NidusNotePayload, userID int) error {
+	args := pgx.NamedArgs{
+		"created":   time.Now(),
+		"creator":   userID,
+		"latitude":  payload.Location.Latitude,
+		"longitude": payload.Location.Longitude,
+		"text":      payload.Text,
+		"uuid":      noteUUID,
+	}
+	query := `
+		SELECT
+			deleted,
+			latitude,
+			longitude,
+			text,
+			(SELECT COALESCE(MAX(version), 0) FROM history_note WHERE uuid = @uuid) AS version
+		FROM note
+		WHERE uuid = @uuid
+		FOR UPDATE
+	`
+	var current []*struct {
+		Deleted   *time.Time `db:"deleted"`
+		Latitude  *float64   `db:"latitude"`
+		Longitude *float64   `db:"longitude"`
+		Text      string     `db:"text"`
+		Version   int        `db:"version"`
+	}
+	if err := pgxscan.Select(ctx, transaction, &current, query, args); err != nil {
+		return fmt.Errorf("Failed to query note %s: %v", noteUUID, err)
+	}
+	if len(current) == 0 {
+		args["created"] = payload.Timestamp
+		args["version"] = 1
+		query = `
+			INSERT INTO note (created, creator, latitude, longitude, text, updated, uuid)
+			VALUES (@created, @creator, @latitude, @longitude, @text, @created, @uuid)
+		`
+		if _, err := transaction.Exec(ctx, query, args); err != nil {
+			return fmt.Errorf("Failed to insert note %s: %v", noteUUID, err)
+		}
+	} else {
+		note := current[0]
+		if note.Deleted != nil {
+			return fmt.Errorf("note %s: %w", noteUUID, ErrNoteDeleted)
+		}
+		if note.Latitude != nil && *note.Latitude == payload.Location.Latitude &&
+			note.Longitude != nil && *note.Longitude == payload.Location.Longitude &&
+			note.Text == payload.Text {
+			return nil
+		}
+		args["version"] = note.Version + 1
+		query = "UPDATE note SET latitude=@latitude, longitude=@longitude, text=@text, updated=@created WHERE uuid=@uuid"
+		if _, err := transaction.Exec(ctx, query, args); err != nil {
+			return fmt.Errorf("Failed to update note %s: %v", noteUUID, err)
+		}
 	}
-	db_audio_set := make(map[string]bool, len(audio_uuids))
-	for _, u := range audio_uuids {
-		db_audio_set[u] = false
+	query = `
+		INSERT INTO history_note (created, latitude, longitude, text, version, uuid)
+		VALUES (@created, @latitude, @longitude, @text, @version, @uuid)
+	`
+	if _, err := transaction.Exec(ctx, query, args); err != nil {
+		return fmt.Errorf("Failed to insert history of note %s: %v", noteUUID, err)
 	}
-	has_audio_update := false
-	for _, v := range db_audio_set {
-		if !v {
-			has_audio_update = true
+	return nil
+}
+
+// noteAttachmentsUpdate makes the audio or image notes attached to a note match the given UUIDs.
+// Returns true if any were attached or detached.
+func noteAttachmentsUpdate(ctx context.Context, transaction pgx.Tx, table string, noteUUID string, attachments []string, userID int) (bool, error) {
+	args := pgx.NamedArgs{
+		"note_uuid": noteUUID,
+	}
+	query := `
+		SELECT uuid
+		FROM (
+			SELECT DISTINCT ON (uuid) note_uuid, uuid
+			FROM ` + table + `
+			ORDER BY uuid, version DESC
+		) latest
+		WHERE note_uuid = @note_uuid
+	`
+	var attached []string
+	if err := pgxscan.Select(ctx, transaction, &attached, query, args); err != nil {
+		return false, fmt.Errorf("Failed to query %s attached to note %s: %v", table, noteUUID, err)
+	}
+	changed := false
+	wanted := make(map[string]bool, len(attachments))
+	for _, a := range attachments {
+		wanted[a] = true
+	}
+	for _, a := range attached {
+		if wanted[a] {
+			delete(wanted, a)
+			continue
+		}
+		if _, err := noteAttachmentVersion(ctx, transaction, table, a, nil, userID); err != nil {
+			return false, err
 		}
+		changed = true
+		log.Printf("Detached %s %s from note %s", table, a, noteUUID)
 	}
-	if has_audio_update {
-		//var options pgx.TxOptions
-		//transaction, err := PGInstance.DB.BeginTx(ctx, options)
-		//query := "INSERT INTO history_note_audio_recording created,
+	added := make([]string, 0, len(wanted))
+	for a := range wanted {
+		added = append(added, a)
 	}
+	sort.Strings(added)
+	for _, a := range added {
+		found, err := noteAttachmentVersion(ctx, transaction, table, a, &noteUUID, userID)
+		if err != nil {
+			return false, err
+		}
+		if !found {
+			return false, fmt.Errorf("%s %s: %w", table, a, ErrNoteAttachmentMissing)
+		}
+		changed = true
+		log.Printf("Attached %s %s to note %s", table, a, noteUUID)
+	}
+	return changed, nil
+}
 
-	return nil
+// noteAttachmentVersion saves a new version of an audio or image note attached to the given
+// note, or to no note if it's nil. Everything else is copied from the latest version, so
+// attaching doesn't undo a review. Returns false if there's no such audio or image note.
+func noteAttachmentVersion(ctx context.Context, transaction pgx.Tx, table string, attachmentUUID string, noteUUID *string, userID int) (bool, error) {
+	set := pgx.NamedArgs{
+		"created":   time.Now(),
+		"creator":   userID,
+		"note_uuid": noteUUID,
+	}
+	return insertNextVersion(ctx, transaction, table, attachmentUUID, set)
 }
 
 // Pretty big function. Given a set of query results we're going to iterate over each of them.
@@ -260,6 +390,9 @@ func SaveOrUpdateDBRecords(ctx context.Context, table string, qr *arcgis.QueryRe
 		sorted_columns = append(sorted_columns, f.Name)
 	}
 	sort.Strings(sorted_columns)
+	if err := saveFields(ctx, table, qr.Fields); err != nil {
+		return inserts, updates, err
+	}
 
 	objectids := make([]int, 0)
 	for _, l := range qr.Features {
@@ -293,6 +426,24 @@ func SaveOrUpdateDBRecords(ctx context.Context, table string, qr *arcgis.QueryRe
 	return inserts, updates, nil
 }
 
+// DeleteMissingRows deletes the rows of a FieldSeeker table that aren't among the objectids
+// FieldSeeker has. Their history is kept, and triggers record the deletions in fs_deleted for
+// clients to catch up on. Returns how many were deleted.
+func DeleteMissingRows(ctx context.Context, table string, objectids []int) (int, error) {
+	if PGInstance == nil {
+		return 0, errors.New("You must initialize the DB first")
+	}
+	args := pgx.NamedArgs{
+		"objectids": objectids,
+	}
+	query := "DELETE FROM " + table + " WHERE NOT (OBJECTID = ANY(@objectids))"
+	result, err := PGInstance.DB.Exec(ctx, query, args)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to delete missing rows from %s: %v", table, err)
+	}
+	return int(result.RowsAffected()), nil
+}
+
 func SaveUser(displayname string, hash string, username string) error {
 	log.Println("Saving new user")
 	query := `INSERT INTO user_ (display_name, password_hash_type, password_hash, username) VALUES (@display_name, @password_hash_type, @password_hash, @username)`
@@ -323,13 +474,37 @@ func ServiceRequestCount() (int, error) {
 	return count, nil
 }
 
+// Get the area the mosquito sources cover. Returns nil if there aren't any.
+func MosquitoSourceExtent(ctx context.Context) (*shared.Bounds, error) {
+	if PGInstance == nil {
+		return nil, errors.New("You must initialize the DB first")
+	}
+	query := `
+		SELECT MAX(geometry_x) AS east, MAX(geometry_y) AS north, MIN(geometry_y) AS south, MIN(geometry_x) AS west
+		FROM FS_PointLocation
+		HAVING COUNT(geometry_x) > 0
+	`
+	var results []*shared.Bounds
+	if err := pgxscan.Select(ctx, PGInstance.DB, &results, query); err != nil {
+		return nil, fmt.Errorf("Failed to query extent of mosquito sources: %v", err)
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+	return results[0], nil
+}
+
 func ServiceRequestQuery(q *DBQuery) ([]shared.ServiceRequest, error) {
 	results := make([]shared.ServiceRequest, 0)
 	if PGInstance == nil {
 		return results, errors.New("You must initialize the DB first")
 	}
 
-	args, query := prepQuery(q, "SELECT GEOMETRY_X AS \"geometry.X\",GEOMETRY_Y AS \"geometry.Y\",ASSIGNEDTECH,CreationDate,DOG,globalid,PRIORITY,REQADDR1,REQCITY,RECDATETIME,REQTARGET,REQZIP,SOURCE,Spanish,STATUS FROM FS_ServiceRequest WHERE GEOMETRY_X > @west AND GEOMETRY_X < @east AND GEOMETRY_Y > @south AND GEOMETRY_Y < @north")
+	predicate := "SELECT GEOMETRY_X AS \"geometry.X\",GEOMETRY_Y AS \"geometry.Y\",ASSIGNEDTECH,CreationDate,DOG,globalid,PRIORITY,REQADDR1,REQCITY,RECDATETIME,REQTARGET,REQZIP,SOURCE,Spanish,STATUS FROM FS_ServiceRequest WHERE GEOMETRY_X > @west AND GEOMETRY_X < @east AND GEOMETRY_Y > @south AND GEOMETRY_Y < @north"
+	if q.UpdatedSince != nil {
+		predicate += " AND updated > @updated_since"
+	}
+	args, query := prepQuery(q, predicate)
 	rows, _ := PGInstance.DB.Query(context.Background(), query, args)
 	var fs_service_requests []*shared.FS_ServiceRequest
 
@@ -350,7 +525,11 @@ func TrapDataQuery(q *DBQuery) ([]shared.TrapData, error) {
 		return results, errors.New("You must initialize the DB first")
 	}
 
-	args, query := prepQuery(q, "SELECT geometry_x AS \"geometry.X\",geometry_y AS \"geometry.Y\",creationdate,globalid,name,description,accessdesc,objectid FROM FS_TrapLocation WHERE geometry_x > @west AND geometry_x < @east AND geometry_y > @south AND geometry_y < @north")
+	predicate := "SELECT geometry_x AS \"geometry.X\",geometry_y AS \"geometry.Y\",creationdate,globalid,name,description,accessdesc,objectid FROM FS_TrapLocation WHERE geometry_x > @west AND geometry_x < @east AND geometry_y > @south AND geometry_y < @north"
+	if q.UpdatedSince != nil {
+		predicate += " AND updated > @updated_since"
+	}
+	args, query := prepQuery(q, predicate)
 	rows, _ := PGInstance.DB.Query(context.Background(), query, args)
 	var fs_trap_locations []*shared.FS_TrapLocation
 
@@ -374,7 +553,7 @@ func ValidateUser(username string, password string) (*shared.User, error) {
 	query := `SELECT display_name,id,password_hash FROM user_ WHERE username=$1`
 	err := PGInstance.DB.QueryRow(context.Background(), query, username).Scan(&display_name, &id, &hash)
 	if err != nil {
-		fmt.Printf("ValidateUser failed for '%s': %w\n", username, err)
+		fmt.Printf("ValidateUser failed for '%s': %v\n", username, err)
 		return nil, NoUserError{}
 	}
 	if !shared.VerifyPassword(password, hash) {
@@ -568,8 +747,22 @@ func insertRowFromFeatureFS(ctx context.Context, transaction pgx.Tx, table strin
 	return nil
 }
 
+// insertRowFromFeatureHistory adds a version of a row to its history. When the feature has only
+// some of the columns, because the layer's export filter asks for fewer out fields, the rest are
+// carried over from the previous version.
 func insertRowFromFeatureHistory(ctx context.Context, transaction pgx.Tx, table string, sorted_columns []string, feature *arcgis.Feature, version int) error {
 	history_table := toHistoryTable(table)
+	args := pgx.NamedArgs{}
+	for k, v := range feature.Attributes {
+		args[k] = v
+	}
+	args["created"] = time.Now()
+	args["geometry_x"] = feature.Geometry.X
+	args["geometry_y"] = feature.Geometry.Y
+	args["objectid"] = int(feature.Attributes["OBJECTID"].(float64))
+	args["previous"] = version - 1
+	args["version"] = version
+
 	var sb strings.Builder
 	sb.WriteString("INSERT INTO ")
 	sb.WriteString(history_table)
@@ -580,26 +773,147 @@ func insertRowFromFeatureHistory(ctx context.Context, transaction pgx.Tx, table
 	}
 	// Specially add the geometry values since they aren't in the fields
 	sb.WriteString("created,geometry_x,geometry_y,version")
-	sb.WriteString(")\nVALUES (")
+	values := make([]string, 0, len(sorted_columns)+4)
 	for _, field := range sorted_columns {
-		sb.WriteString("@")
-		sb.WriteString(field)
-		sb.WriteString(",")
+		values = append(values, "@"+field)
 	}
-	// Specially add the geometry values since they aren't in the fields
-	sb.WriteString("@created,@geometry_x,@geometry_y,@version)")
-	args := pgx.NamedArgs{}
-	for k, v := range feature.Attributes {
-		args[k] = v
+	values = append(values, "@created", "@geometry_x", "@geometry_y", "@version")
+
+	if version > 1 {
+		carried, err := historyCarriedColumns(ctx, transaction, history_table, sorted_columns)
+		if err != nil {
+			return err
+		}
+		var carry strings.Builder
+		carry.WriteString(sb.String())
+		for _, column := range carried {
+			carry.WriteString(",")
+			carry.WriteString(column)
+		}
+		carry.WriteString(")\nSELECT ")
+		carry.WriteString(strings.Join(append(values, carried...), ","))
+		carry.WriteString(" FROM ")
+		carry.WriteString(history_table)
+		carry.WriteString(" WHERE OBJECTID=@objectid AND version=@previous")
+		result, err := transaction.Exec(ctx, carry.String(), args)
+		if err != nil {
+			return fmt.Errorf("Failed to insert history row into %s: %v", table, err)
+		}
+		if result.RowsAffected() > 0 {
+			return nil
+		}
+		// Without a previous version there's nothing to carry over
 	}
-	args["created"] = time.Now()
-	args["version"] = version
+
+	sb.WriteString(")\nVALUES (")
+	sb.WriteString(strings.Join(values, ","))
+	sb.WriteString(")")
 	if _, err := transaction.Exec(ctx, sb.String(), args); err != nil {
 		return fmt.Errorf("Failed to insert history row into %s: %v", table, err)
 	}
 	return nil
 }
 
+// historyCarriedColumns are the columns of a history table a feature with the given fields
+// doesn't have a value for
+func historyCarriedColumns(ctx context.Context, transaction pgx.Tx, history_table string, sorted_columns []string) ([]string, error) {
+	columns, err := tableColumns(ctx, transaction, history_table)
+	if err != nil {
+		return nil, err
+	}
+	fetched := map[string]bool{
+		"created":    true,
+		"geometry_x": true,
+		"geometry_y": true,
+		"version":    true,
+	}
+	for _, field := range sorted_columns {
+		fetched[strings.ToLower(field)] = true
+	}
+	carried := make([]string, 0)
+	for _, column := range columns {
+		if !fetched[column] {
+			carried = append(carried, column)
+		}
+	}
+	return carried, nil
+}
+
+// dbExecutor is a pool or a transaction
+type dbExecutor interface {
+	pgxscan.Querier
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+// insertNextVersion saves a new version of an audio or image note. Every column is copied from
+// the latest version except those in set, which take the given values. Returns false if there's
+// no such note.
+func insertNextVersion(ctx context.Context, db dbExecutor, table string, noteUUID string, set pgx.NamedArgs) (bool, error) {
+	columns, err := tableColumns(ctx, db, table)
+	if err != nil {
+		return false, err
+	}
+	args := pgx.NamedArgs{}
+	for k, v := range set {
+		args[k] = v
+	}
+	args["previous_uuid"] = noteUUID
+	result, err := db.Exec(ctx, nextVersionQuery(table, columns, set), args)
+	if err != nil {
+		return false, fmt.Errorf("Failed to save new version of %s %s: %v", table, noteUUID, err)
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// nextVersionQuery copies the latest version of a note with @previous_uuid into a new version
+func nextVersionQuery(table string, columns []string, set pgx.NamedArgs) string {
+	values := make([]string, 0, len(columns))
+	for _, column := range columns {
+		if _, ok := set[column]; ok {
+			values = append(values, "@"+column)
+		} else if column == "version" {
+			values = append(values, "version + 1")
+		} else {
+			values = append(values, column)
+		}
+	}
+	return "INSERT INTO " + table + " (" + strings.Join(columns, ", ") + ")\n" +
+		"SELECT " + strings.Join(values, ", ") + "\n" +
+		"FROM " + table + "\n" +
+		"WHERE uuid = @previous_uuid\n" +
+		"ORDER BY version DESC\n" +
+		"LIMIT 1"
+}
+
+// The columns of tables, which don't change while we're running
+var tableColumnsCache sync.Map
+
+// tableColumns lists the columns of a table in the order they were added
+func tableColumns(ctx context.Context, db pgxscan.Querier, table string) ([]string, error) {
+	table = strings.ToLower(table)
+	if columns, ok := tableColumnsCache.Load(table); ok {
+		return columns.([]string), nil
+	}
+	args := pgx.NamedArgs{
+		"table_name": table,
+	}
+	query := `
+		SELECT column_name
+		FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = @table_name
+		ORDER BY ordinal_position
+	`
+	var columns []string
+	if err := pgxscan.Select(ctx, db, &columns, query, args); err != nil {
+		return nil, fmt.Errorf("Failed to query columns of %s: %v", table, err)
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("No table %s", table)
+	}
+	tableColumnsCache.Store(table, columns)
+	return columns, nil
+}
+
 func insertRowFromFeature(ctx context.Context, table string, sorted_columns []string, feature *arcgis.Feature) error {
 	var options pgx.TxOptions
 	transaction, err := PGInstance.DB.BeginTx(ctx, options)
@@ -634,7 +948,33 @@ func prepQuery(q *DBQuery, predicate string) (pgx.NamedArgs, string) {
 		"south": q.Bounds.South,
 		"west":  q.Bounds.West,
 	}
+	if q.UpdatedSince != nil {
+		args["updated_since"] = *q.UpdatedSince
+	}
 	query := predicate
+	columns := make([]string, 0, len(q.Equals))
+	for column := range q.Equals {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	for _, column := range columns {
+		args["equals_"+column] = q.Equals[column]
+		query = query + " AND " + column + " = @equals_" + column
+	}
+	// FieldSeeker stores times as milliseconds since the epoch
+	if q.CreatedAfter != nil {
+		args["created_after"] = q.CreatedAfter.UnixMilli()
+		query = query + " AND creationdate >= @created_after"
+	}
+	if q.CreatedBefore != nil {
+		args["created_before"] = q.CreatedBefore.UnixMilli()
+		query = query + " AND creationdate < @created_before"
+	}
+	// FieldSeeker globalids vary in case and braces so they're compared as UUIDs
+	if q.After != nil {
+		args["after"] = *q.After
+		query = query + " AND globalid::uuid > @after ORDER BY globalid::uuid"
+	}
 	if q.Limit > 0 {
 		args["limit"] = q.Limit
 		query = query + " LIMIT @limit"
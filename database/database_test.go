@@ -2,8 +2,10 @@ package database
 
 import (
 	"testing"
+	"time"
 
 	"github.com/Gleipnir-Technology/arcgis-go"
+	"github.com/jackc/pgx/v5"
 )
 
 func TestUpsertFromQueryResult(t *testing.T) {
@@ -33,3 +35,60 @@ DO UPDATE SET
 		t.Errorf("Got wrong query: %v", query)
 	}
 }
+
+func TestExportLayerFilterWhere(t *testing.T) {
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	filter := NewExportLayerFilter("FS_PointLocation")
+	if where := filter.Where(now); where != "1=1" {
+		t.Errorf("Got wrong unfiltered where: %v", where)
+	}
+	if fields := filter.OutFieldList(); fields != "*" {
+		t.Errorf("Got wrong unfiltered fields: %v", fields)
+	}
+
+	clause := "ACTIVE = 1"
+	field := "EditDate"
+	days := 30
+	outFields := "NAME, ACTIVE"
+	filter.WhereClause = &clause
+	filter.DateField = &field
+	filter.DateWindowDays = &days
+	filter.OutFields = &outFields
+	if where := filter.Where(now); where != "(ACTIVE = 1) AND EditDate >= timestamp '2025-05-16 12:00:00'" {
+		t.Errorf("Got wrong filtered where: %v", where)
+	}
+	if fields := filter.OutFieldList(); fields != "OBJECTID,NAME,ACTIVE" {
+		t.Errorf("Got wrong filtered fields: %v", fields)
+	}
+}
+
+func TestJobBackoff(t *testing.T) {
+	cases := map[int]time.Duration{
+		1:  30 * time.Second,
+		2:  time.Minute,
+		5:  8 * time.Minute,
+		20: 6 * time.Hour,
+	}
+	for attempts, expected := range cases {
+		if backoff := JobBackoff(attempts); backoff != expected {
+			t.Errorf("Got backoff %v for %d attempts, expected %v", backoff, attempts, expected)
+		}
+	}
+}
+
+func TestNextVersionQuery(t *testing.T) {
+	columns := []string{"created", "deleted", "deleted_by", "transcription", "version", "uuid", "creator", "needs_further_review"}
+	set := pgx.NamedArgs{
+		"created":       time.Now(),
+		"transcription": "hello",
+	}
+	query := nextVersionQuery("note_audio", columns, set)
+	if query != `INSERT INTO note_audio (created, deleted, deleted_by, transcription, version, uuid, creator, needs_further_review)
+SELECT @created, deleted, deleted_by, @transcription, version + 1, uuid, creator, needs_further_review
+FROM note_audio
+WHERE uuid = @previous_uuid
+ORDER BY version DESC
+LIMIT 1` {
+		t.Errorf("Got wrong query: %v", query)
+	}
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"github.com/Gleipnir-Technology/fieldseeker-sync/shared"
+	"github.com/google/uuid"
+)
+
+// The number of rows the Each functions read at a time
+const eachPageSize = 500
+
+// Call fn with every mosquito source the query matches. Only a page of them is held in memory
+// at a time. The query's Limit and After are ignored.
+func MosquitoSourceEach(q DBQuery, fn func(shared.MosquitoSource) error) error {
+	return each(q, MosquitoSourceQuery, shared.MosquitoSource.ID, fn)
+}
+
+// Call fn with every service request the query matches, a page at a time
+func ServiceRequestEach(q DBQuery, fn func(shared.ServiceRequest) error) error {
+	return each(q, ServiceRequestQuery, shared.ServiceRequest.ID, fn)
+}
+
+// Call fn with every trap the query matches, a page at a time
+func TrapDataEach(q DBQuery, fn func(shared.TrapData) error) error {
+	return each(q, TrapDataQuery, shared.TrapData.ID, fn)
+}
+
+func each[T any](q DBQuery, query func(*DBQuery) ([]T, error), id func(T) uuid.UUID, fn func(T) error) error {
+	first := uuid.Nil
+	q.After = &first
+	q.Limit = eachPageSize
+	for {
+		page, err := query(&q)
+		if err != nil {
+			return err
+		}
+		for _, row := range page {
+			if err := fn(row); err != nil {
+				return err
+			}
+		}
+		if len(page) < eachPageSize {
+			return nil
+		}
+		after := id(page[len(page)-1])
+		q.After = &after
+	}
+}
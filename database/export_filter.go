@@ -0,0 +1,101 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+)
+
+// ExportLayerFilter limits which rows and columns of a FieldSeeker layer the
+// export process downloads. A layer without a filter gets everything.
+type ExportLayerFilter struct {
+	Layer          string  `db:"layer"`
+	DateField      *string `db:"date_field"`
+	DateWindowDays *int    `db:"date_window_days"`
+	OutFields      *string `db:"out_fields"`
+	WhereClause    *string `db:"where_clause"`
+}
+
+// NewExportLayerFilter produces a filter that selects every row and column
+func NewExportLayerFilter(layer string) *ExportLayerFilter {
+	return &ExportLayerFilter{
+		Layer: layer,
+	}
+}
+
+// Get the filter for the given layer, or a filter that selects everything if the layer has none
+func ExportLayerFilterGet(ctx context.Context, layer string) (*ExportLayerFilter, error) {
+	if PGInstance == nil {
+		return nil, errors.New("You must initialize the DB first")
+	}
+	args := pgx.NamedArgs{
+		"layer": layer,
+	}
+	query := "SELECT layer,date_field,date_window_days,out_fields,where_clause FROM export_layer_filter WHERE layer=@layer"
+	var filters []*ExportLayerFilter
+	if err := pgxscan.Select(ctx, PGInstance.DB, &filters, query, args); err != nil {
+		return nil, fmt.Errorf("Failed to query export filter for %s: %v", layer, err)
+	}
+	if len(filters) == 0 {
+		return NewExportLayerFilter(layer), nil
+	}
+	return filters[0], nil
+}
+
+// IsFiltered is true when the filter excludes some rows from the layer
+func (f *ExportLayerFilter) IsFiltered() bool {
+	return f.hasWhereClause() || f.hasDateWindow()
+}
+
+// OutFieldList produces the fields to request from ArcGIS. OBJECTID is always
+// included since we use it to match up rows.
+func (f *ExportLayerFilter) OutFieldList() string {
+	if f.OutFields == nil || strings.TrimSpace(*f.OutFields) == "" {
+		return "*"
+	}
+	fields := make([]string, 0)
+	has_objectid := false
+	for _, field := range strings.Split(*f.OutFields, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if strings.EqualFold(field, "OBJECTID") {
+			has_objectid = true
+		}
+		fields = append(fields, field)
+	}
+	if !has_objectid {
+		fields = append([]string{"OBJECTID"}, fields...)
+	}
+	return strings.Join(fields, ",")
+}
+
+// Where produces the ArcGIS where clause for the filter relative to the given time
+func (f *ExportLayerFilter) Where(now time.Time) string {
+	clauses := make([]string, 0)
+	if f.hasWhereClause() {
+		clauses = append(clauses, "("+*f.WhereClause+")")
+	}
+	if f.hasDateWindow() {
+		start := now.UTC().AddDate(0, 0, -*f.DateWindowDays)
+		clauses = append(clauses, fmt.Sprintf("%s >= timestamp '%s'", *f.DateField, start.Format("2006-01-02 15:04:05")))
+	}
+	if len(clauses) == 0 {
+		return "1=1"
+	}
+	return strings.Join(clauses, " AND ")
+}
+
+func (f *ExportLayerFilter) hasDateWindow() bool {
+	return f.DateField != nil && *f.DateField != "" && f.DateWindowDays != nil && *f.DateWindowDays > 0
+}
+
+func (f *ExportLayerFilter) hasWhereClause() bool {
+	return f.WhereClause != nil && strings.TrimSpace(*f.WhereClause) != ""
+}
@@ -0,0 +1,192 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Gleipnir-Technology/arcgis-go"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+)
+
+// The ArcGIS type of fields that hold dates, which we store as milliseconds since the epoch
+const fieldTypeDate = "esriFieldTypeDate"
+
+// How dates are written as text
+const fieldTimeLayout = "2006-01-02 15:04:05"
+
+// LayerField is what FieldSeeker told us about a column of a layer
+type LayerField struct {
+	Alias string
+	// Names of the codes the column holds, empty if its values aren't coded
+	CodedValues map[string]string
+	IsDate      bool
+}
+
+// saveFields keeps the fields of a query result along with their coded values. Fields and codes
+// FieldSeeker no longer sends are left alone since old rows may still hold them.
+func saveFields(ctx context.Context, table string, fields []arcgis.Field) error {
+	table = strings.ToLower(table)
+	batch := &pgx.Batch{}
+	for _, field := range fields {
+		name := strings.ToLower(field.Name)
+		batch.Queue(`
+			INSERT INTO fs_field (alias, field_type, name, table_name)
+			VALUES (@alias, @field_type, @name, @table_name)
+			ON CONFLICT (table_name, name) DO UPDATE
+			SET alias = EXCLUDED.alias, field_type = EXCLUDED.field_type
+		`, pgx.NamedArgs{
+			"alias":      field.Alias,
+			"field_type": field.Type,
+			"name":       name,
+			"table_name": table,
+		})
+		if field.Domain == nil {
+			continue
+		}
+		for _, value := range field.Domain.CodedValues {
+			batch.Queue(`
+				INSERT INTO fs_coded_value (code, field, name, table_name)
+				VALUES (@code, @field, @name, @table_name)
+				ON CONFLICT (table_name, field, code) DO UPDATE
+				SET name = EXCLUDED.name
+			`, pgx.NamedArgs{
+				"code":       string(value.Code),
+				"field":      name,
+				"name":       value.Name,
+				"table_name": table,
+			})
+		}
+	}
+	if err := PGInstance.DB.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("Failed to save fields of %s: %v", table, err)
+	}
+	return nil
+}
+
+// Get what FieldSeeker told us about the columns of the layer by column name. Columns sync hasn't
+// seen since it started keeping fields are missing.
+func (l Layer) Fields(ctx context.Context) (map[string]LayerField, error) {
+	if PGInstance == nil {
+		return nil, errors.New("You must initialize the DB first")
+	}
+	args := pgx.NamedArgs{
+		"table_name": l.table,
+	}
+	var fields []*struct {
+		Alias     *string `db:"alias"`
+		FieldType string  `db:"field_type"`
+		Name      string  `db:"name"`
+	}
+	query := `SELECT alias, field_type, name FROM fs_field WHERE table_name = @table_name`
+	if err := pgxscan.Select(ctx, PGInstance.DB, &fields, query, args); err != nil {
+		return nil, fmt.Errorf("Failed to query fields of %s: %v", l.table, err)
+	}
+	var codes []*struct {
+		Code  string `db:"code"`
+		Field string `db:"field"`
+		Name  string `db:"name"`
+	}
+	query = `SELECT code, field, name FROM fs_coded_value WHERE table_name = @table_name`
+	if err := pgxscan.Select(ctx, PGInstance.DB, &codes, query, args); err != nil {
+		return nil, fmt.Errorf("Failed to query coded values of %s: %v", l.table, err)
+	}
+
+	results := make(map[string]LayerField, len(fields))
+	for _, field := range fields {
+		result := LayerField{
+			CodedValues: make(map[string]string),
+			IsDate:      field.FieldType == fieldTypeDate,
+		}
+		if field.Alias != nil {
+			result.Alias = *field.Alias
+		}
+		results[field.Name] = result
+	}
+	for _, code := range codes {
+		if field, ok := results[code.Field]; ok {
+			field.CodedValues[code.Code] = code.Name
+		}
+	}
+	return results, nil
+}
+
+// FieldValue turns the value of a column into what it means to people: dates are times in local
+// time and coded values are their names. The result is nil, string, int64, float64, bool or
+// time.Time.
+func FieldValue(column string, value any, fields map[string]LayerField) (any, error) {
+	value, err := driver.DefaultParameterConverter.ConvertValue(value)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to convert %s: %v", column, err)
+	}
+	if value == nil {
+		return nil, nil
+	}
+	if b, ok := value.([]byte); ok {
+		value = string(b)
+	}
+	field, known := fields[column]
+	// Until a sync records the fields of a layer we go by the name
+	isDate := field.IsDate || (!known && strings.Contains(column, "date"))
+	if millis, ok := value.(int64); ok && isDate {
+		return time.UnixMilli(millis).In(time.Local), nil
+	}
+	if name, ok := field.CodedValues[FieldText(value)]; ok {
+		return name, nil
+	}
+	return value, nil
+}
+
+// FieldText writes a value from FieldValue as text
+func FieldText(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format(fieldTimeLayout)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// LayerRowField is a column of a row of a layer with its value written as text
+type LayerRowField struct {
+	// What FieldSeeker calls the column, empty until a sync records the fields of the layer
+	Alias  string
+	Column string
+	Value  string
+}
+
+// RowText writes each column of a row the way a CSV export does, for showing the row to people
+func (l Layer) RowText(ctx context.Context, row LayerRow) ([]LayerRowField, error) {
+	fields, err := l.Fields(ctx)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]LayerRowField, 0, len(l.Columns))
+	for _, column := range l.Columns {
+		value, err := FieldValue(column, row[column], fields)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, LayerRowField{
+			Alias:  fields[column].Alias,
+			Column: column,
+			Value:  FieldText(value),
+		})
+	}
+	return results, nil
+}
@@ -0,0 +1,71 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFieldValue(t *testing.T) {
+	fields := map[string]LayerField{
+		"lastinspectdate": {IsDate: true},
+		"active":          {CodedValues: map[string]string{"0": "No", "1": "Yes"}},
+		"habitat":         {CodedValues: map[string]string{"pond": "Pond"}},
+		// Known not to be a date despite the name
+		"dateflag": {},
+	}
+	millis := time.Date(2025, time.June, 1, 12, 0, 0, 0, time.UTC).UnixMilli()
+	cases := []struct {
+		column   string
+		value    any
+		expected any
+	}{
+		{"lastinspectdate", millis, time.UnixMilli(millis).In(time.Local)},
+		// Until a sync records the fields the name decides
+		{"creationdate", int32(1000), time.UnixMilli(1000).In(time.Local)},
+		{"dateflag", millis, millis},
+		{"active", int64(1), "Yes"},
+		{"active", int16(0), "No"},
+		{"active", int64(2), int64(2)},
+		{"habitat", []byte("pond"), "Pond"},
+		{"habitat", "stream", "stream"},
+		{"comments", []byte("Standing water"), "Standing water"},
+		{"priority", 2.5, 2.5},
+		{"lastinspectdate", nil, nil},
+		{"comments", (*string)(nil), nil},
+	}
+	for _, c := range cases {
+		value, err := FieldValue(c.column, c.value, fields)
+		if err != nil {
+			t.Errorf("%s %v: %v", c.column, c.value, err)
+			continue
+		}
+		if !reflect.DeepEqual(value, c.expected) {
+			t.Errorf("%s %v: got %#v, expected %#v", c.column, c.value, value, c.expected)
+		}
+	}
+	if _, err := FieldValue("comments", struct{}{}, fields); err == nil {
+		t.Error("Got no error for a value that can't be converted")
+	}
+}
+
+func TestFieldText(t *testing.T) {
+	local := time.Date(2025, time.June, 1, 9, 5, 3, 0, time.Local)
+	cases := []struct {
+		value    any
+		expected string
+	}{
+		{nil, ""},
+		{"Pond", "Pond"},
+		{int64(-12), "-12"},
+		// Not in exponent form however big it gets
+		{1234567890.5, "1234567890.5"},
+		{true, "true"},
+		{local, "2025-06-01 09:05:03"},
+	}
+	for _, c := range cases {
+		if text := FieldText(c.value); text != c.expected {
+			t.Errorf("Got %q for %#v, expected %q", text, c.value, c.expected)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+)
+
+type ImageFileProblem string
+
+const (
+	ImageFileProblemCorrupt    ImageFileProblem = "corrupt"
+	ImageFileProblemNotAnImage ImageFileProblem = "not-an-image"
+)
+
+// ImageFile is one of the files for an image note. Variant is "original" for the upload or
+// the size and format of a derivative, such as "thumbnail.webp".
+type ImageFile struct {
+	ContentType   *string           `db:"content_type"`
+	Height        *int              `db:"height"`
+	NoteImageUUID string            `db:"note_image_uuid"`
+	Problem       *ImageFileProblem `db:"problem"`
+	Processed     time.Time         `db:"processed"`
+	Size          int64             `db:"size"`
+	Variant       string            `db:"variant"`
+	Width         *int              `db:"width"`
+}
+
+// ImageExif is the metadata the camera saved in the original upload
+type ImageExif struct {
+	Latitude      *float64   `db:"latitude"`
+	Longitude     *float64   `db:"longitude"`
+	NoteImageUUID string     `db:"note_image_uuid"`
+	Orientation   int        `db:"orientation"`
+	Taken         *time.Time `db:"taken"`
+}
+
+// Save what we know about an image file, replacing anything saved earlier for the same file
+func ImageFileSave(ctx context.Context, file *ImageFile) error {
+	if PGInstance == nil {
+		return errors.New("You must initialize the DB first")
+	}
+	args := pgx.NamedArgs{
+		"content_type":    file.ContentType,
+		"height":          file.Height,
+		"note_image_uuid": file.NoteImageUUID,
+		"problem":         nil,
+		"processed":       file.Processed,
+		"size":            file.Size,
+		"variant":         file.Variant,
+		"width":           file.Width,
+	}
+	if file.Problem != nil {
+		args["problem"] = string(*file.Problem)
+	}
+	query := `
+		INSERT INTO image_file (content_type, height, note_image_uuid, problem, processed, size, variant, width)
+		VALUES (@content_type, @height, @note_image_uuid, @problem, @processed, @size, @variant, @width)
+		ON CONFLICT (note_image_uuid, variant) DO UPDATE SET
+			content_type = EXCLUDED.content_type,
+			height = EXCLUDED.height,
+			problem = EXCLUDED.problem,
+			processed = EXCLUDED.processed,
+			size = EXCLUDED.size,
+			width = EXCLUDED.width
+	`
+	_, err := PGInstance.DB.Exec(ctx, query, args)
+	if err != nil {
+		return fmt.Errorf("Failed to save image file %s %s: %v", file.NoteImageUUID, file.Variant, err)
+	}
+	return nil
+}
+
+// Get the files of an image note
+func ImageFileList(ctx context.Context, uuid string) ([]*ImageFile, error) {
+	results := make([]*ImageFile, 0)
+	if PGInstance == nil {
+		return results, errors.New("You must initialize the DB first")
+	}
+	args := pgx.NamedArgs{
+		"uuid": uuid,
+	}
+	query := `
+		SELECT content_type, height, note_image_uuid, problem, processed, size, variant, width
+		FROM image_file
+		WHERE note_image_uuid = @uuid
+		ORDER BY variant
+	`
+	if err := pgxscan.Select(ctx, PGInstance.DB, &results, query, args); err != nil {
+		return results, fmt.Errorf("Failed to query files of image %s: %v", uuid, err)
+	}
+	return results, nil
+}
+
+// Save the EXIF metadata of an image note, replacing any saved earlier
+func ImageExifSave(ctx context.Context, exif *ImageExif) error {
+	if PGInstance == nil {
+		return errors.New("You must initialize the DB first")
+	}
+	args := pgx.NamedArgs{
+		"latitude":        exif.Latitude,
+		"longitude":       exif.Longitude,
+		"note_image_uuid": exif.NoteImageUUID,
+		"orientation":     exif.Orientation,
+		"taken":           exif.Taken,
+	}
+	query := `
+		INSERT INTO image_exif (latitude, longitude, note_image_uuid, orientation, taken)
+		VALUES (@latitude, @longitude, @note_image_uuid, @orientation, @taken)
+		ON CONFLICT (note_image_uuid) DO UPDATE SET
+			latitude = EXCLUDED.latitude,
+			longitude = EXCLUDED.longitude,
+			orientation = EXCLUDED.orientation,
+			taken = EXCLUDED.taken
+	`
+	_, err := PGInstance.DB.Exec(ctx, query, args)
+	if err != nil {
+		return fmt.Errorf("Failed to save EXIF of image %s: %v", exif.NoteImageUUID, err)
+	}
+	return nil
+}
+
+// Get the EXIF metadata of an image note. Returns nil if it has none.
+func ImageExifGet(ctx context.Context, uuid string) (*ImageExif, error) {
+	if PGInstance == nil {
+		return nil, errors.New("You must initialize the DB first")
+	}
+	args := pgx.NamedArgs{
+		"uuid": uuid,
+	}
+	query := `
+		SELECT latitude, longitude, note_image_uuid, orientation, taken
+		FROM image_exif
+		WHERE note_image_uuid = @uuid
+	`
+	var results []*ImageExif
+	if err := pgxscan.Select(ctx, PGInstance.DB, &results, query, args); err != nil {
+		return nil, fmt.Errorf("Failed to query EXIF of image %s: %v", uuid, err)
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+	return results[0], nil
+}
+
+// NoteImage is an image note along with the dimensions of its upload, which are nil until the
+// upload has been processed
+type NoteImage struct {
+	Created time.Time `db:"created"`
+	Height  *int      `db:"height"`
+	UUID    string    `db:"uuid"`
+	Width   *int      `db:"width"`
+}
+
+// Get every image note, including deleted ones, and whether its latest version is deleted
+func NoteImageDeleted(ctx context.Context) (map[string]bool, error) {
+	results := make(map[string]bool)
+	if PGInstance == nil {
+		return results, errors.New("You must initialize the DB first")
+	}
+	query := `
+		SELECT DISTINCT ON (uuid) deleted IS NOT NULL AS deleted, uuid
+		FROM note_image
+		ORDER BY uuid, version DESC
+	`
+	var rows []*noteDeleted
+	if err := pgxscan.Select(ctx, PGInstance.DB, &rows, query); err != nil {
+		return results, fmt.Errorf("Failed to query image notes: %v", err)
+	}
+	for _, row := range rows {
+		results[row.UUID] = row.Deleted
+	}
+	return results, nil
+}
@@ -0,0 +1,259 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+)
+
+type JobKind string
+
+const (
+	JobKindAudio       JobKind = "audio"
+	JobKindImage       JobKind = "image"
+	JobKindLabelStudio JobKind = "label-studio"
+)
+
+type JobState string
+
+const (
+	JobStatePending  JobState = "pending"
+	JobStateRunning  JobState = "running"
+	JobStateComplete JobState = "complete"
+	JobStateDead     JobState = "dead"
+)
+
+// Job is a unit of background work that survives restarts of the process doing the work.
+type Job struct {
+	ID        int        `db:"id"`
+	Attempts  int        `db:"attempts"`
+	Completed *time.Time `db:"completed"`
+	Created   time.Time  `db:"created"`
+	// Force asks the worker to redo work that looks like it's already been done
+	Force      bool       `db:"force"`
+	Kind       JobKind    `db:"kind"`
+	LastError  *string    `db:"last_error"`
+	LastOutput *string    `db:"last_output"`
+	NextRun    time.Time  `db:"next_run"`
+	Started    *time.Time `db:"started"`
+	State      JobState   `db:"state"`
+	UUID       string     `db:"uuid"`
+}
+
+// Add a job to the queue. If there's already a job waiting to run for the same
+// kind and UUID we don't add another one, though a forced job makes the waiting one forced.
+func JobEnqueue(ctx context.Context, kind JobKind, uuid string, force bool) error {
+	if PGInstance == nil {
+		return errors.New("You must initialize the DB first")
+	}
+	args := pgx.NamedArgs{
+		"created": time.Now(),
+		"force":   force,
+		"kind":    string(kind),
+		"pending": string(JobStatePending),
+		"uuid":    uuid,
+	}
+	query := `
+		WITH updated AS (
+			UPDATE job SET force = force OR @force
+			WHERE kind = @kind AND uuid = @uuid AND state = @pending
+			RETURNING id
+		)
+		INSERT INTO job (attempts, created, force, kind, next_run, state, uuid)
+		SELECT 0, @created, @force, @kind, @created, @pending, @uuid
+		WHERE NOT EXISTS (SELECT 1 FROM updated)
+	`
+	_, err := PGInstance.DB.Exec(ctx, query, args)
+	if err != nil {
+		return fmt.Errorf("Failed to insert job: %v", err)
+	}
+	return nil
+}
+
+// Claim the next job of the given kind that is ready to run. Returns nil if there's nothing to do.
+// The claim is safe to use from multiple workers at once.
+func JobClaim(ctx context.Context, kind JobKind) (*Job, error) {
+	if PGInstance == nil {
+		return nil, errors.New("You must initialize the DB first")
+	}
+	args := pgx.NamedArgs{
+		"kind":    string(kind),
+		"now":     time.Now(),
+		"pending": string(JobStatePending),
+		"running": string(JobStateRunning),
+	}
+	query := `
+		UPDATE job
+		SET attempts = attempts + 1, started = @now, state = @running
+		WHERE id = (
+			SELECT id FROM job
+			WHERE kind = @kind AND state = @pending AND next_run <= @now
+			ORDER BY next_run
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING id, attempts, completed, created, force, kind, last_error, last_output, next_run, started, state, uuid
+	`
+	var jobs []*Job
+	if err := pgxscan.Select(ctx, PGInstance.DB, &jobs, query, args); err != nil {
+		return nil, fmt.Errorf("Failed to claim job: %v", err)
+	}
+	if len(jobs) == 0 {
+		return nil, nil
+	}
+	return jobs[0], nil
+}
+
+// Mark a job as successfully completed
+func JobComplete(ctx context.Context, id int) error {
+	args := pgx.NamedArgs{
+		"completed": time.Now(),
+		"id":        id,
+		"state":     string(JobStateComplete),
+	}
+	query := "UPDATE job SET completed=@completed, last_error=NULL, last_output=NULL, state=@state WHERE id=@id"
+	_, err := PGInstance.DB.Exec(ctx, query, args)
+	if err != nil {
+		return fmt.Errorf("Failed to complete job %d: %v", id, err)
+	}
+	return nil
+}
+
+// The longest we'll wait before retrying a job
+const jobBackoffMax = 6 * time.Hour
+
+// JobBackoff is how long to wait before running a job again after the given number of failed attempts
+func JobBackoff(attempts int) time.Duration {
+	backoff := 30 * time.Second
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= jobBackoffMax {
+			return jobBackoffMax
+		}
+	}
+	return backoff
+}
+
+// Record a failed attempt at a job. The job is scheduled to run again after a backoff
+// unless it has used up its attempts, in which case it goes to the dead state until
+// someone requeues it.
+func JobFail(ctx context.Context, job *Job, maxAttempts int, lastError string, lastOutput string) (JobState, error) {
+	state := JobStatePending
+	if job.Attempts >= maxAttempts {
+		state = JobStateDead
+	}
+	args := pgx.NamedArgs{
+		"id":          job.ID,
+		"last_error":  lastError,
+		"last_output": nil,
+		"next_run":    time.Now().Add(JobBackoff(job.Attempts)),
+		"state":       string(state),
+	}
+	if lastOutput != "" {
+		args["last_output"] = lastOutput
+	}
+	query := "UPDATE job SET last_error=@last_error, last_output=@last_output, next_run=@next_run, state=@state WHERE id=@id"
+	_, err := PGInstance.DB.Exec(ctx, query, args)
+	if err != nil {
+		return state, fmt.Errorf("Failed to fail job %d: %v", job.ID, err)
+	}
+	return state, nil
+}
+
+// Get the jobs that have failed at least once and haven't since succeeded, most recent first
+func JobListFailing(ctx context.Context) ([]*Job, error) {
+	results := make([]*Job, 0)
+	if PGInstance == nil {
+		return results, errors.New("You must initialize the DB first")
+	}
+	args := pgx.NamedArgs{
+		"dead":    string(JobStateDead),
+		"pending": string(JobStatePending),
+	}
+	query := `
+		SELECT id, attempts, completed, created, force, kind, last_error, last_output, next_run, started, state, uuid
+		FROM job
+		WHERE state = @dead OR (state = @pending AND last_error IS NOT NULL)
+		ORDER BY state, created DESC
+	`
+	if err := pgxscan.Select(ctx, PGInstance.DB, &results, query, args); err != nil {
+		return results, fmt.Errorf("Failed to list failing jobs: %v", err)
+	}
+	return results, nil
+}
+
+// Put a job back in the queue to run immediately with a fresh set of attempts
+func JobRequeue(ctx context.Context, id int) (*Job, error) {
+	if PGInstance == nil {
+		return nil, errors.New("You must initialize the DB first")
+	}
+	args := pgx.NamedArgs{
+		"id":       id,
+		"next_run": time.Now(),
+		"pending":  string(JobStatePending),
+		"running":  string(JobStateRunning),
+	}
+	query := `
+		UPDATE job SET attempts=0, next_run=@next_run, state=@pending
+		WHERE id=@id AND state != @running
+		RETURNING id, attempts, completed, created, force, kind, last_error, last_output, next_run, started, state, uuid
+	`
+	var jobs []*Job
+	if err := pgxscan.Select(ctx, PGInstance.DB, &jobs, query, args); err != nil {
+		return nil, fmt.Errorf("Failed to requeue job %d: %v", id, err)
+	}
+	if len(jobs) == 0 {
+		return nil, fmt.Errorf("Job %d doesn't exist or is running", id)
+	}
+	return jobs[0], nil
+}
+
+// Get the number of jobs waiting to run for each kind
+func JobQueueDepth(ctx context.Context) (map[string]int, error) {
+	results := make(map[string]int)
+	if PGInstance == nil {
+		return results, errors.New("You must initialize the DB first")
+	}
+	args := pgx.NamedArgs{
+		"pending": string(JobStatePending),
+	}
+	rows, err := PGInstance.DB.Query(ctx, "SELECT kind::TEXT, COUNT(*) FROM job WHERE state=@pending GROUP BY kind", args)
+	if err != nil {
+		return results, fmt.Errorf("Failed to query job queue depth: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			kind  string
+			count int
+		)
+		if err := rows.Scan(&kind, &count); err != nil {
+			return results, fmt.Errorf("Failed to scan job queue depth: %v", err)
+		}
+		results[kind] = count
+	}
+	return results, rows.Err()
+}
+
+// Put any jobs that were running when the process stopped back in the queue.
+// This should only be called before any workers for the kind have started.
+func JobRequeueInterrupted(ctx context.Context, kind JobKind) (int, error) {
+	if PGInstance == nil {
+		return 0, errors.New("You must initialize the DB first")
+	}
+	args := pgx.NamedArgs{
+		"kind":    string(kind),
+		"pending": string(JobStatePending),
+		"running": string(JobStateRunning),
+	}
+	query := "UPDATE job SET state=@pending WHERE kind=@kind AND state=@running"
+	result, err := PGInstance.DB.Exec(ctx, query, args)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to requeue interrupted jobs: %v", err)
+	}
+	return int(result.RowsAffected()), nil
+}
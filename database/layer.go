@@ -0,0 +1,325 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Gleipnir-Technology/fieldseeker-sync/database/models"
+	"github.com/Gleipnir-Technology/fieldseeker-sync/shared"
+	"github.com/stephenafamo/bob"
+	"github.com/stephenafamo/bob/dialect/psql"
+	"github.com/stephenafamo/bob/dialect/psql/dialect"
+	"github.com/stephenafamo/bob/dialect/psql/sm"
+)
+
+// Layer reads one of the FieldSeeker tables sync keeps through its generated model
+type Layer struct {
+	// The table's columns in the model's order
+	Columns []string
+	query   func(ctx context.Context, mods ...bob.Mod[*dialect.SelectQuery]) ([]LayerRow, error)
+	table   string
+	// The model's type for each column
+	types map[string]reflect.Type
+}
+
+// LayerRow is a row of a layer by column name
+type LayerRow map[string]any
+
+// LayerCursor is where a page of a layer ends. The next page starts after it.
+type LayerCursor struct {
+	ObjectID int32 `json:"id"`
+	// The row's value of the column the layer is sorted by, as text, nil if it's null
+	Value *string `json:"value,omitempty"`
+}
+
+// LayerQuery picks rows of a layer and the order they come in. Empty fields match every row.
+type LayerQuery struct {
+	After  *LayerCursor
+	Bounds *shared.Bounds
+	// Only rows where the column equals the value
+	Filters map[string]string
+	Limit   int
+	// The column to sort by, objectid if empty. Rows with the same value are in objectid order.
+	Sort           string
+	SortDescending bool
+	UpdatedSince   *time.Time
+}
+
+// Layers are the FieldSeeker tables sync keeps, by their name without the FS_ prefix
+var Layers = map[string]Layer{
+	"containerrelate":        newLayer(models.FSContainerrelates.View),
+	"fieldscoutinglog":       newLayer(models.FSFieldscoutinglogs.View),
+	"habitatrelate":          newLayer(models.FSHabitatrelates.View),
+	"inspectionsample":       newLayer(models.FSInspectionsamples.View),
+	"inspectionsampledetail": newLayer(models.FSInspectionsampledetails.View),
+	"linelocation":           newLayer(models.FSLinelocations.View),
+	"locationtracking":       newLayer(models.FSLocationtrackings.View),
+	"mosquitoinspection":     newLayer(models.FSMosquitoinspections.View),
+	"pointlocation":          newLayer(models.FSPointlocations.View),
+	"polygonlocation":        newLayer(models.FSPolygonlocations.View),
+	"pool":                   newLayer(models.FSPools.View),
+	"pooldetail":             newLayer(models.FSPooldetails.View),
+	"proposedtreatmentarea":  newLayer(models.FSProposedtreatmentareas.View),
+	"qamosquitoinspection":   newLayer(models.FSQamosquitoinspections.View),
+	"rodentlocation":         newLayer(models.FSRodentlocations.View),
+	"samplecollection":       newLayer(models.FSSamplecollections.View),
+	"samplelocation":         newLayer(models.FSSamplelocations.View),
+	"servicerequest":         newLayer(models.FSServicerequests.View),
+	"speciesabundance":       newLayer(models.FSSpeciesabundances.View),
+	"stormdrain":             newLayer(models.FSStormdrains.View),
+	"timecard":               newLayer(models.FSTimecards.View),
+	"trapdata":               newLayer(models.FSTrapdata.View),
+	"traplocation":           newLayer(models.FSTraplocations.View),
+	"treatment":              newLayer(models.FSTreatments.View),
+	"treatmentarea":          newLayer(models.FSTreatmentareas.View),
+	"zones":                  newLayer(models.FSZones.View),
+	"zones2":                 newLayer(models.FSZones2s.View),
+}
+
+type layerColumns interface {
+	bob.Expression
+	Names() []string
+}
+
+func newLayer[T any, S ~[]T, C layerColumns](view *psql.View[T, S, C]) Layer {
+	model := reflect.TypeOf((*T)(nil)).Elem()
+	for model.Kind() == reflect.Pointer {
+		model = model.Elem()
+	}
+	types := make(map[string]reflect.Type, model.NumField())
+	for i := 0; i < model.NumField(); i++ {
+		name, _, _ := strings.Cut(model.Field(i).Tag.Get("db"), ",")
+		if name != "" && name != "-" {
+			types[name] = model.Field(i).Type
+		}
+	}
+	return Layer{
+		Columns: view.Columns.Names(),
+		query: func(ctx context.Context, mods ...bob.Mod[*dialect.SelectQuery]) ([]LayerRow, error) {
+			rows, err := view.Query(mods...).All(ctx, PGInstance.BobDB)
+			if err != nil {
+				return nil, err
+			}
+			results := make([]LayerRow, 0, len(rows))
+			for _, row := range rows {
+				results = append(results, newLayerRow(row))
+			}
+			return results, nil
+		},
+		table: view.Alias(),
+		types: types,
+	}
+}
+
+// newLayerRow maps a model's fields to its columns by their db tags
+func newLayerRow(model any) LayerRow {
+	value := reflect.Indirect(reflect.ValueOf(model))
+	row := make(LayerRow, value.NumField())
+	for i := 0; i < value.NumField(); i++ {
+		name, _, _ := strings.Cut(value.Type().Field(i).Tag.Get("db"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		row[name] = value.Field(i).Interface()
+	}
+	return row
+}
+
+// HasColumn reports whether the layer has a column
+func (l Layer) HasColumn(name string) bool {
+	for _, column := range l.Columns {
+		if column == name {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckValue reports whether text can be read as a value of the column, so filters that can't
+// match anything are refused before they get to postgres
+func (l Layer) CheckValue(column string, text string) error {
+	t, ok := l.types[column]
+	if !ok {
+		return fmt.Errorf("No column %s", column)
+	}
+	value := reflect.New(t)
+	if unmarshaler, ok := value.Interface().(encoding.TextUnmarshaler); ok {
+		return unmarshaler.UnmarshalText([]byte(text))
+	}
+	var err error
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		_, err = strconv.ParseInt(text, 10, t.Bits())
+	case reflect.Float32, reflect.Float64:
+		_, err = strconv.ParseFloat(text, t.Bits())
+	case reflect.Bool:
+		_, err = strconv.ParseBool(text)
+	case reflect.String:
+	default:
+		err = fmt.Errorf("Can't filter by a column of type %s", t)
+	}
+	return err
+}
+
+// Get the rows that match the query and the cursor of the next page, which is nil on the last
+// page. Columns in the query must be checked with HasColumn first.
+func (l Layer) List(ctx context.Context, q LayerQuery) ([]LayerRow, *LayerCursor, error) {
+	if PGInstance == nil {
+		return nil, nil, errors.New("You must initialize the DB first")
+	}
+	rows, err := l.query(ctx, q.mods()...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to query layer: %v", err)
+	}
+	if len(rows) <= q.Limit {
+		return rows, nil, nil
+	}
+	rows = rows[:q.Limit]
+	last := rows[len(rows)-1]
+	next := &LayerCursor{}
+	objectID, ok := last["objectid"].(int32)
+	if !ok {
+		return nil, nil, errors.New("Layer rows have no objectid")
+	}
+	next.ObjectID = objectID
+	if sortColumn := q.sortColumn(); sortColumn != "objectid" {
+		next.Value, err = layerValueText(last[sortColumn])
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return rows, next, nil
+}
+
+func (q LayerQuery) sortColumn() string {
+	if q.Sort == "" {
+		return "objectid"
+	}
+	return q.Sort
+}
+
+func (q LayerQuery) mods() []bob.Mod[*dialect.SelectQuery] {
+	sortColumn := q.sortColumn()
+	mods := make([]bob.Mod[*dialect.SelectQuery], 0)
+	// Sorted so the same query always makes the same SQL
+	filterColumns := make([]string, 0, len(q.Filters))
+	for column := range q.Filters {
+		filterColumns = append(filterColumns, column)
+	}
+	sort.Strings(filterColumns)
+	for _, column := range filterColumns {
+		mods = append(mods, sm.Where(psql.Quote(column).EQ(psql.Arg(q.Filters[column]))))
+	}
+	if q.Bounds != nil {
+		mods = append(mods,
+			sm.Where(psql.Quote("geometry_x").Between(psql.Arg(q.Bounds.West), psql.Arg(q.Bounds.East))),
+			sm.Where(psql.Quote("geometry_y").Between(psql.Arg(q.Bounds.South), psql.Arg(q.Bounds.North))),
+		)
+	}
+	if q.UpdatedSince != nil {
+		mods = append(mods, sm.Where(psql.Quote("updated").GT(psql.Arg(*q.UpdatedSince))))
+	}
+	if q.After != nil {
+		mods = append(mods, sm.Where(layerAfter(sortColumn, q.SortDescending, q.After)))
+	}
+	if sortColumn != "objectid" {
+		order := sm.OrderBy(psql.Quote(sortColumn))
+		if q.SortDescending {
+			order = order.Desc()
+		} else {
+			order = order.Asc()
+		}
+		mods = append(mods, order.NullsLast())
+		mods = append(mods, sm.OrderBy(psql.Quote("objectid")).Asc())
+	} else if q.SortDescending {
+		mods = append(mods, sm.OrderBy(psql.Quote("objectid")).Desc())
+	} else {
+		mods = append(mods, sm.OrderBy(psql.Quote("objectid")).Asc())
+	}
+	// One more than the page tells us whether there's another page
+	mods = append(mods, sm.Limit(q.Limit+1))
+	return mods
+}
+
+// Get a row by its globalid. FieldSeeker globalids vary in case and braces so they're compared
+// without them. Returns nil if there's no such row.
+func (l Layer) Get(ctx context.Context, globalID string) (LayerRow, error) {
+	if PGInstance == nil {
+		return nil, errors.New("You must initialize the DB first")
+	}
+	normalized := strings.ToLower(strings.Trim(globalID, "{}"))
+	rows, err := l.query(ctx,
+		sm.Where(psql.Raw("lower(btrim(globalid, '{}'))").EQ(psql.Arg(normalized))),
+		sm.Limit(1),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query layer row %s: %v", globalID, err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return rows[0], nil
+}
+
+// layerAfter is the condition for the rows after a cursor. Nulls sort last whichever way the
+// column is sorted.
+func layerAfter(column string, descending bool, after *LayerCursor) bob.Expression {
+	objectID := psql.Quote("objectid")
+	if column == "objectid" {
+		if descending {
+			return objectID.LT(psql.Arg(after.ObjectID))
+		}
+		return objectID.GT(psql.Arg(after.ObjectID))
+	}
+	sorted := psql.Quote(column)
+	if after.Value == nil {
+		return psql.And(sorted.IsNull(), objectID.GT(psql.Arg(after.ObjectID)))
+	}
+	value := psql.Arg(*after.Value)
+	beyond := sorted.GT(value)
+	if descending {
+		beyond = sorted.LT(value)
+	}
+	return psql.Or(
+		beyond,
+		psql.And(sorted.EQ(value), objectID.GT(psql.Arg(after.ObjectID))),
+		sorted.IsNull(),
+	)
+}
+
+// layerValueText turns a column's value into text postgres can read back as the column's type
+func layerValueText(value any) (*string, error) {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	var decoded any
+	if err := decoder.Decode(&decoded); err != nil {
+		return nil, err
+	}
+	var text string
+	switch v := decoded.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		text = v
+	case json.Number:
+		text = v.String()
+	case bool:
+		text = strconv.FormatBool(v)
+	default:
+		return nil, fmt.Errorf("Can't sort by a value like %s", content)
+	}
+	return &text, nil
+}
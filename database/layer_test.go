@@ -0,0 +1,171 @@
+package database
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aarondl/opt/null"
+	"github.com/stephenafamo/bob"
+	"github.com/stephenafamo/bob/dialect/psql"
+	"github.com/stephenafamo/bob/dialect/psql/dialect"
+	"github.com/stephenafamo/bob/dialect/psql/sm"
+
+	"github.com/Gleipnir-Technology/fieldseeker-sync/shared"
+)
+
+func TestLayerValueText(t *testing.T) {
+	cases := []struct {
+		value    any
+		expected *string
+	}{
+		{int16(3), ptr("3")},
+		{int32(-4), ptr("-4")},
+		{int64(1717243200000), ptr("1717243200000")},
+		{1.5, ptr("1.5")},
+		{"Pond", ptr("Pond")},
+		{true, ptr("true")},
+		{time.Date(2025, time.June, 1, 12, 0, 0, 6, time.UTC), ptr("2025-06-01T12:00:00.000000006Z")},
+		// The models' nullable columns
+		{null.From(int16(2)), ptr("2")},
+		{null.From(int64(1717243200000)), ptr("1717243200000")},
+		{null.From(0.25), ptr("0.25")},
+		{null.From("Pond"), ptr("Pond")},
+		{null.Val[string]{}, nil},
+		{null.Val[int64]{}, nil},
+		{nil, nil},
+	}
+	for _, c := range cases {
+		text, err := layerValueText(c.value)
+		if err != nil {
+			t.Errorf("%#v: %v", c.value, err)
+			continue
+		}
+		if !reflect.DeepEqual(text, c.expected) {
+			t.Errorf("%#v: got %v, expected %v", c.value, deref(text), deref(c.expected))
+		}
+	}
+	if _, err := layerValueText([]int{1}); err == nil {
+		t.Error("Got no error for a value that can't be sorted by")
+	}
+}
+
+func TestLayerQueryMods(t *testing.T) {
+	since := time.Date(2025, time.June, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name  string
+		query LayerQuery
+		sql   string
+		args  []any
+	}{
+		{
+			name:  "first page",
+			query: LayerQuery{Limit: 10},
+			sql:   `SELECT * FROM fs_pointlocation ORDER BY "objectid" ASC LIMIT 11`,
+		},
+		{
+			name:  "objectid descending",
+			query: LayerQuery{After: &LayerCursor{ObjectID: 5}, Limit: 10, SortDescending: true},
+			sql:   `SELECT * FROM fs_pointlocation WHERE ("objectid" < $1) ORDER BY "objectid" DESC LIMIT 11`,
+			args:  []any{int32(5)},
+		},
+		{
+			name:  "objectid ascending",
+			query: LayerQuery{After: &LayerCursor{ObjectID: 5}, Limit: 10},
+			sql:   `SELECT * FROM fs_pointlocation WHERE ("objectid" > $1) ORDER BY "objectid" ASC LIMIT 11`,
+			args:  []any{int32(5)},
+		},
+		{
+			name:  "ascending after a value",
+			query: LayerQuery{After: &LayerCursor{ObjectID: 5, Value: ptr("Pond")}, Limit: 10, Sort: "habitat"},
+			sql: `SELECT * FROM fs_pointlocation ` +
+				`WHERE (("habitat" > $1) OR (("habitat" = $2) AND ("objectid" > $3)) OR ("habitat" IS NULL)) ` +
+				`ORDER BY "habitat" ASC NULLS LAST, "objectid" ASC LIMIT 11`,
+			args: []any{"Pond", "Pond", int32(5)},
+		},
+		{
+			name:  "descending after a value",
+			query: LayerQuery{After: &LayerCursor{ObjectID: 5, Value: ptr("Pond")}, Limit: 10, Sort: "habitat", SortDescending: true},
+			sql: `SELECT * FROM fs_pointlocation ` +
+				`WHERE (("habitat" < $1) OR (("habitat" = $2) AND ("objectid" > $3)) OR ("habitat" IS NULL)) ` +
+				`ORDER BY "habitat" DESC NULLS LAST, "objectid" ASC LIMIT 11`,
+			args: []any{"Pond", "Pond", int32(5)},
+		},
+		{
+			// Nulls are last, so after a null there are only more nulls
+			name:  "after a null",
+			query: LayerQuery{After: &LayerCursor{ObjectID: 5}, Limit: 10, Sort: "habitat", SortDescending: true},
+			sql: `SELECT * FROM fs_pointlocation WHERE (("habitat" IS NULL) AND ("objectid" > $1)) ` +
+				`ORDER BY "habitat" DESC NULLS LAST, "objectid" ASC LIMIT 11`,
+			args: []any{int32(5)},
+		},
+		{
+			name: "filters",
+			query: LayerQuery{
+				Bounds:       &shared.Bounds{East: -119, North: 37, South: 36, West: -120},
+				Filters:      map[string]string{"zone": "North", "active": "1"},
+				Limit:        10,
+				UpdatedSince: &since,
+			},
+			sql: `SELECT * FROM fs_pointlocation WHERE ("active" = $1) AND ("zone" = $2) ` +
+				`AND ("geometry_x" BETWEEN $3 AND $4) AND ("geometry_y" BETWEEN $5 AND $6) AND ("updated" > $7) ` +
+				`ORDER BY "objectid" ASC LIMIT 11`,
+			args: []any{"1", "North", -120.0, -119.0, 36.0, 37.0, since},
+		},
+	}
+	for _, c := range cases {
+		mods := append([]bob.Mod[*dialect.SelectQuery]{sm.From("fs_pointlocation")}, c.query.mods()...)
+		sql, args, err := psql.Select(mods...).Build(context.Background())
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if sql = strings.Join(strings.Fields(sql), " "); sql != c.sql {
+			t.Errorf("%s: got\n%s\nexpected\n%s", c.name, sql, c.sql)
+		}
+		if len(args) != len(c.args) || (len(args) > 0 && !reflect.DeepEqual(args, c.args)) {
+			t.Errorf("%s: got args %#v, expected %#v", c.name, args, c.args)
+		}
+	}
+}
+
+func TestLayerCheckValue(t *testing.T) {
+	layer := Layers["pointlocation"]
+	cases := []struct {
+		column string
+		value  string
+		ok     bool
+	}{
+		{"objectid", "5", true},
+		{"objectid", "abc", false},
+		{"active", "1", true},
+		{"active", "99999", false},
+		{"creationdate", "1717243200000", true},
+		{"creationdate", "yesterday", false},
+		{"x", "-119.5", true},
+		{"x", "west", false},
+		{"habitat", "anything", true},
+		{"updated", "2025-06-01T00:00:00Z", true},
+		{"updated", "June", false},
+		{"nosuchcolumn", "1", false},
+	}
+	for _, c := range cases {
+		err := layer.CheckValue(c.column, c.value)
+		if (err == nil) != c.ok {
+			t.Errorf("%s=%s: got %v", c.column, c.value, err)
+		}
+	}
+}
+
+func ptr(s string) *string {
+	return &s
+}
+
+func deref(s *string) any {
+	if s == nil {
+		return nil
+	}
+	return *s
+}
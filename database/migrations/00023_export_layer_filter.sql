@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE export_layer_filter (
+	layer TEXT NOT NULL,
+	date_field TEXT,
+	date_window_days INT,
+	out_fields TEXT,
+	where_clause TEXT,
+
+	PRIMARY KEY(layer)
+);
+-- +goose Down
+DROP TABLE export_layer_filter;
@@ -0,0 +1,23 @@
+-- +goose Up
+CREATE TYPE JobKind AS ENUM ('audio');
+CREATE TYPE JobState AS ENUM ('pending', 'running', 'complete', 'failed');
+
+CREATE TABLE job (
+	id SERIAL PRIMARY KEY,
+	attempts INTEGER NOT NULL,
+	completed TIMESTAMP WITHOUT TIME ZONE,
+	created TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+	kind JobKind NOT NULL,
+	last_error TEXT,
+	next_run TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+	started TIMESTAMP WITHOUT TIME ZONE,
+	state JobState NOT NULL,
+	uuid TEXT NOT NULL
+);
+
+CREATE INDEX job_claim_idx ON job (kind, state, next_run);
+
+-- +goose Down
+DROP TABLE job;
+DROP TYPE JobKind;
+DROP TYPE JobState;
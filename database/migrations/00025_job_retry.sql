@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TYPE JobKind ADD VALUE 'label-studio';
+ALTER TYPE JobState RENAME VALUE 'failed' TO 'dead';
+ALTER TABLE job ADD COLUMN last_output TEXT;
+-- +goose Down
+-- Postgres can't remove a value from an enum, so 'label-studio' stays
+DELETE FROM job WHERE kind = 'label-studio';
+ALTER TABLE job DROP COLUMN last_output;
+ALTER TYPE JobState RENAME VALUE 'dead' TO 'failed';
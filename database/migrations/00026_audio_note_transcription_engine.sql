@@ -0,0 +1,6 @@
+-- +goose Up
+ALTER TABLE note_audio ADD COLUMN transcription_confidence REAL;
+ALTER TABLE note_audio ADD COLUMN transcription_engine TEXT;
+-- +goose Down
+ALTER TABLE note_audio DROP COLUMN transcription_confidence;
+ALTER TABLE note_audio DROP COLUMN transcription_engine;
@@ -0,0 +1,20 @@
+-- +goose Up
+CREATE TYPE AudioFileProblem AS ENUM ('corrupt', 'duration-mismatch', 'empty');
+
+CREATE TABLE audio_file_probe (
+	channels INTEGER,
+	codec TEXT,
+	duration REAL,
+	note_audio_uuid TEXT NOT NULL,
+	probe_error TEXT,
+	probed TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+	problem AudioFileProblem,
+	sample_rate INTEGER,
+	size BIGINT NOT NULL,
+	variant TEXT NOT NULL,
+	PRIMARY KEY (note_audio_uuid, variant)
+);
+
+-- +goose Down
+DROP TABLE audio_file_probe;
+DROP TYPE AudioFileProblem;
@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE note_audio_segment (
+	end_time REAL NOT NULL,
+	note_audio_uuid TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	start_time REAL NOT NULL,
+	PRIMARY KEY (note_audio_uuid, position)
+);
+
+-- +goose Down
+DROP TABLE note_audio_segment;
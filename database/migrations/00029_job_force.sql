@@ -0,0 +1,4 @@
+-- +goose Up
+ALTER TABLE job ADD COLUMN force BOOLEAN NOT NULL DEFAULT false;
+-- +goose Down
+ALTER TABLE job DROP COLUMN force;
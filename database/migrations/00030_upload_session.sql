@@ -0,0 +1,19 @@
+-- +goose Up
+CREATE TYPE UploadKind AS ENUM ('audio', 'image');
+
+CREATE TABLE upload_session (
+	id TEXT PRIMARY KEY,
+	completed TIMESTAMP WITHOUT TIME ZONE,
+	content_uuid TEXT NOT NULL,
+	created TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+	creator INTEGER NOT NULL REFERENCES user_(id),
+	kind UploadKind NOT NULL,
+	sha256 TEXT NOT NULL,
+	size BIGINT NOT NULL
+);
+
+CREATE INDEX upload_session_content_idx ON upload_session (kind, content_uuid);
+
+-- +goose Down
+DROP TABLE upload_session;
+DROP TYPE UploadKind;
@@ -0,0 +1,32 @@
+-- +goose Up
+ALTER TYPE JobKind ADD VALUE 'image';
+
+CREATE TYPE ImageFileProblem AS ENUM ('corrupt', 'not-an-image');
+
+-- The original upload and each file derived from it
+CREATE TABLE image_file (
+	content_type TEXT,
+	height INTEGER,
+	note_image_uuid TEXT NOT NULL,
+	problem ImageFileProblem,
+	processed TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+	size BIGINT NOT NULL,
+	variant TEXT NOT NULL,
+	width INTEGER,
+	PRIMARY KEY (note_image_uuid, variant)
+);
+
+CREATE TABLE image_exif (
+	latitude DOUBLE PRECISION,
+	longitude DOUBLE PRECISION,
+	note_image_uuid TEXT PRIMARY KEY,
+	orientation INTEGER NOT NULL,
+	taken TIMESTAMP WITHOUT TIME ZONE
+);
+
+-- +goose Down
+DROP TABLE image_exif;
+DROP TABLE image_file;
+DROP TYPE ImageFileProblem;
+-- Postgres can't remove a value from an enum, so 'image' stays
+DELETE FROM job WHERE kind = 'image';
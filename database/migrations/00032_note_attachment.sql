@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE note_audio ADD COLUMN note_uuid TEXT REFERENCES note(uuid);
+ALTER TABLE note_image ADD COLUMN note_uuid TEXT REFERENCES note(uuid);
+CREATE INDEX note_audio_note_uuid ON note_audio (note_uuid);
+CREATE INDEX note_image_note_uuid ON note_image (note_uuid);
+
+-- +goose Down
+ALTER TABLE note_audio DROP COLUMN note_uuid;
+ALTER TABLE note_image DROP COLUMN note_uuid;
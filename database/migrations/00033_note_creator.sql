@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE note ADD COLUMN creator INTEGER REFERENCES user_(id);
+ALTER TABLE note ADD COLUMN deleted_by INTEGER REFERENCES user_(id);
+CREATE INDEX note_updated ON note (updated);
+
+-- +goose Down
+ALTER TABLE note DROP COLUMN creator;
+ALTER TABLE note DROP COLUMN deleted_by;
+DROP INDEX note_updated;
@@ -0,0 +1,42 @@
+-- +goose Up
+-- Rows sync deletes because FieldSeeker no longer has them leave a row here so clients can drop
+-- what they've cached
+CREATE TABLE fs_deleted (
+	deleted TIMESTAMP NOT NULL DEFAULT current_timestamp,
+	globalid TEXT NOT NULL,
+	table_name TEXT NOT NULL
+);
+CREATE INDEX fs_deleted_deleted ON fs_deleted (deleted);
+
+-- +goose StatementBegin
+CREATE FUNCTION fs_deleted_record() RETURNS TRIGGER AS $$
+BEGIN
+	IF OLD.globalid IS NOT NULL THEN
+		INSERT INTO fs_deleted (globalid, table_name) VALUES (OLD.globalid, TG_TABLE_NAME);
+	END IF;
+	RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER fs_pointlocation_deleted AFTER DELETE ON FS_PointLocation FOR EACH ROW EXECUTE FUNCTION fs_deleted_record();
+CREATE TRIGGER fs_servicerequest_deleted AFTER DELETE ON FS_ServiceRequest FOR EACH ROW EXECUTE FUNCTION fs_deleted_record();
+CREATE TRIGGER fs_traplocation_deleted AFTER DELETE ON FS_TrapLocation FOR EACH ROW EXECUTE FUNCTION fs_deleted_record();
+
+CREATE INDEX fs_mosquitoinspection_updated ON FS_MosquitoInspection (updated);
+CREATE INDEX fs_pointlocation_updated ON FS_PointLocation (updated);
+CREATE INDEX fs_servicerequest_updated ON FS_ServiceRequest (updated);
+CREATE INDEX fs_traplocation_updated ON FS_TrapLocation (updated);
+CREATE INDEX fs_treatment_updated ON FS_Treatment (updated);
+
+-- +goose Down
+DROP INDEX fs_mosquitoinspection_updated;
+DROP INDEX fs_pointlocation_updated;
+DROP INDEX fs_servicerequest_updated;
+DROP INDEX fs_traplocation_updated;
+DROP INDEX fs_treatment_updated;
+DROP TRIGGER fs_pointlocation_deleted ON FS_PointLocation;
+DROP TRIGGER fs_servicerequest_deleted ON FS_ServiceRequest;
+DROP TRIGGER fs_traplocation_deleted ON FS_TrapLocation;
+DROP FUNCTION fs_deleted_record;
+DROP TABLE fs_deleted;
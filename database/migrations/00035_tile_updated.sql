@@ -0,0 +1,8 @@
+-- +goose Up
+-- Map tiles of these tables are cached until a sync changes them
+CREATE INDEX fs_treatmentarea_updated ON FS_TreatmentArea (updated);
+CREATE INDEX fs_zones_updated ON FS_Zones (updated);
+
+-- +goose Down
+DROP INDEX fs_treatmentarea_updated;
+DROP INDEX fs_zones_updated;
@@ -0,0 +1,21 @@
+-- +goose Up
+-- The fields FieldSeeker describes with each query result, so exports know which columns are
+-- dates and what coded values mean
+CREATE TABLE fs_field (
+	alias TEXT,
+	field_type TEXT NOT NULL,
+	name TEXT NOT NULL,
+	table_name TEXT NOT NULL,
+	PRIMARY KEY (table_name, name)
+);
+CREATE TABLE fs_coded_value (
+	code TEXT NOT NULL,
+	field TEXT NOT NULL,
+	name TEXT NOT NULL,
+	table_name TEXT NOT NULL,
+	PRIMARY KEY (table_name, field, code)
+);
+
+-- +goose Down
+DROP TABLE fs_coded_value;
+DROP TABLE fs_field;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- Deleting a note saves a version of it, so the history says when it was deleted and by whom
+ALTER TABLE history_note ADD COLUMN deleted TIMESTAMP WITHOUT TIME ZONE;
+ALTER TABLE history_note ADD COLUMN deleted_by INTEGER REFERENCES user_(id);
+
+-- +goose Down
+ALTER TABLE history_note DROP COLUMN deleted;
+ALTER TABLE history_note DROP COLUMN deleted_by;
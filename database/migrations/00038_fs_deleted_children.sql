@@ -0,0 +1,21 @@
+-- +goose Up
+-- Clients get a mosquito source with its inspections and treatments, so deleting one of them
+-- changes the source
+-- +goose StatementBegin
+CREATE FUNCTION fs_deleted_touch_pointlocation() RETURNS TRIGGER AS $$
+BEGIN
+	IF OLD.pointlocid IS NOT NULL THEN
+		UPDATE FS_PointLocation SET updated = current_timestamp WHERE globalid = OLD.pointlocid;
+	END IF;
+	RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER fs_mosquitoinspection_deleted AFTER DELETE ON FS_MosquitoInspection FOR EACH ROW EXECUTE FUNCTION fs_deleted_touch_pointlocation();
+CREATE TRIGGER fs_treatment_deleted AFTER DELETE ON FS_Treatment FOR EACH ROW EXECUTE FUNCTION fs_deleted_touch_pointlocation();
+
+-- +goose Down
+DROP TRIGGER fs_mosquitoinspection_deleted ON FS_MosquitoInspection;
+DROP TRIGGER fs_treatment_deleted ON FS_Treatment;
+DROP FUNCTION fs_deleted_touch_pointlocation;
@@ -0,0 +1,4 @@
+-- +goose Up
+ALTER TABLE note_audio ADD COLUMN no_speech BOOLEAN NOT NULL DEFAULT false;
+-- +goose Down
+ALTER TABLE note_audio DROP COLUMN no_speech;
@@ -0,0 +1,291 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Gleipnir-Technology/fieldseeker-sync/shared"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+)
+
+// Note is a note along with the UUIDs of the audio and image notes attached to it
+type Note struct {
+	Audio     []string   `db:"audio"`
+	Created   *time.Time `db:"created"`
+	Creator   *int       `db:"creator"`
+	Deleted   *time.Time `db:"deleted"`
+	Images    []string   `db:"images"`
+	Latitude  *float64   `db:"latitude"`
+	Longitude *float64   `db:"longitude"`
+	Text      string     `db:"text"`
+	Updated   *time.Time `db:"updated"`
+	UUID      string     `db:"uuid"`
+}
+
+// NoteAudioAttachment is an audio note attached to a note. Created is when it was recorded.
+type NoteAudioAttachment struct {
+	Breadcrumbs   []shared.NoteAudioBreadcrumbPayload `db:"-"`
+	Created       time.Time                           `db:"created"`
+	Duration      *float32                            `db:"duration"`
+	Transcription *string                             `db:"transcription"`
+	UUID          string                              `db:"uuid"`
+}
+
+// NoteFilter picks notes by where they are, who wrote them and when they changed. Empty
+// fields match every note.
+type NoteFilter struct {
+	// Only notes with a UUID after this one, in UUID order, if set
+	After  *string
+	Bounds *shared.Bounds
+	// Only notes taken at or after this time, if set
+	CreatedAfter *time.Time
+	CreatorID    *int
+	// The most notes to get, all of them if zero
+	Limit int
+	// Notes deleted since this time are included so clients can remove them
+	UpdatedSince *time.Time
+}
+
+// The columns of a Note. Attachments are the latest version of each audio and image note that
+// points at the note and isn't deleted.
+const noteColumns = `
+	ARRAY(
+		SELECT uuid FROM (
+			SELECT DISTINCT ON (uuid) deleted, note_uuid, uuid
+			FROM note_audio
+			ORDER BY uuid, version DESC
+		) latest
+		WHERE latest.note_uuid = note.uuid AND latest.deleted IS NULL
+		ORDER BY uuid
+	) AS audio,
+	created,
+	creator,
+	deleted,
+	ARRAY(
+		SELECT uuid FROM (
+			SELECT DISTINCT ON (uuid) deleted, note_uuid, uuid
+			FROM note_image
+			ORDER BY uuid, version DESC
+		) latest
+		WHERE latest.note_uuid = note.uuid AND latest.deleted IS NULL
+		ORDER BY uuid
+	) AS images,
+	latitude,
+	longitude,
+	text,
+	updated,
+	uuid
+`
+
+// Get the notes that match the filter in UUID order. Deleted notes are skipped unless the
+// filter asks for what was updated since a time.
+func NoteList(ctx context.Context, filter NoteFilter) ([]*Note, error) {
+	results := make([]*Note, 0)
+	if PGInstance == nil {
+		return results, errors.New("You must initialize the DB first")
+	}
+	args := pgx.NamedArgs{}
+	conditions := "TRUE"
+	if filter.After != nil {
+		args["after"] = *filter.After
+		conditions += " AND uuid > @after"
+	}
+	if filter.Bounds != nil {
+		args["east"] = filter.Bounds.East
+		args["north"] = filter.Bounds.North
+		args["south"] = filter.Bounds.South
+		args["west"] = filter.Bounds.West
+		conditions += " AND latitude BETWEEN @south AND @north AND longitude BETWEEN @west AND @east"
+	}
+	if filter.CreatedAfter != nil {
+		args["created_after"] = *filter.CreatedAfter
+		conditions += " AND created >= @created_after"
+	}
+	if filter.CreatorID != nil {
+		args["creator"] = *filter.CreatorID
+		conditions += " AND creator = @creator"
+	}
+	if filter.UpdatedSince != nil {
+		args["updated_since"] = *filter.UpdatedSince
+		conditions += " AND updated > @updated_since"
+	} else {
+		conditions += " AND deleted IS NULL"
+	}
+	query := "SELECT " + noteColumns + " FROM note WHERE " + conditions + " ORDER BY uuid"
+	if filter.Limit > 0 {
+		args["limit"] = filter.Limit
+		query += " LIMIT @limit"
+	}
+	if err := pgxscan.Select(ctx, PGInstance.DB, &results, query, args); err != nil {
+		return results, fmt.Errorf("Failed to query notes: %v", err)
+	}
+	return results, nil
+}
+
+// Get a note. Returns nil if there's no such note or it's deleted.
+func NoteGet(ctx context.Context, uuid string) (*Note, error) {
+	if PGInstance == nil {
+		return nil, errors.New("You must initialize the DB first")
+	}
+	args := pgx.NamedArgs{
+		"uuid": uuid,
+	}
+	query := "SELECT " + noteColumns + " FROM note WHERE uuid = @uuid AND deleted IS NULL"
+	var results []*Note
+	if err := pgxscan.Select(ctx, PGInstance.DB, &results, query, args); err != nil {
+		return nil, fmt.Errorf("Failed to query note %s: %v", uuid, err)
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+	return results[0], nil
+}
+
+// Mark a note as deleted and save the deletion as a version in history_note. Returns false if
+// there's no such note or it was already deleted.
+func NoteDelete(ctx context.Context, uuid string, userID int) (bool, error) {
+	if PGInstance == nil {
+		return false, errors.New("You must initialize the DB first")
+	}
+	args := pgx.NamedArgs{
+		"deleted":    time.Now(),
+		"deleted_by": userID,
+		"uuid":       uuid,
+	}
+	query := `
+		WITH deleted AS (
+			UPDATE note
+			SET deleted=@deleted, deleted_by=@deleted_by, updated=@deleted
+			WHERE uuid=@uuid AND deleted IS NULL
+			RETURNING latitude, longitude, text, uuid
+		)
+		INSERT INTO history_note (created, deleted, deleted_by, latitude, longitude, text, version, uuid)
+		SELECT
+			@deleted,
+			@deleted,
+			@deleted_by,
+			latitude,
+			longitude,
+			text,
+			(SELECT COALESCE(MAX(version), 0) + 1 FROM history_note WHERE uuid = @uuid),
+			uuid
+		FROM deleted
+	`
+	result, err := PGInstance.DB.Exec(ctx, query, args)
+	if err != nil {
+		return false, fmt.Errorf("Failed to update note %s to deleted: %v", uuid, err)
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// Get the audio notes attached to a note along with their breadcrumbs, oldest first
+func NoteAudioAttachmentList(ctx context.Context, noteUUID string) ([]*NoteAudioAttachment, error) {
+	results := make([]*NoteAudioAttachment, 0)
+	if PGInstance == nil {
+		return results, errors.New("You must initialize the DB first")
+	}
+	args := pgx.NamedArgs{
+		"note_uuid": noteUUID,
+	}
+	// When it was recorded comes from the first version, everything else from the latest
+	query := `
+		SELECT first.created, latest.duration, latest.transcription, latest.uuid
+		FROM (
+			SELECT DISTINCT ON (uuid) deleted, duration, note_uuid, transcription, uuid
+			FROM note_audio
+			ORDER BY uuid, version DESC
+		) latest
+		JOIN (
+			SELECT DISTINCT ON (uuid) created, uuid
+			FROM note_audio
+			ORDER BY uuid, version ASC
+		) first ON first.uuid = latest.uuid
+		WHERE latest.note_uuid = @note_uuid AND latest.deleted IS NULL
+		ORDER BY first.created
+	`
+	if err := pgxscan.Select(ctx, PGInstance.DB, &results, query, args); err != nil {
+		return results, fmt.Errorf("Failed to query audio attached to note %s: %v", noteUUID, err)
+	}
+	if len(results) == 0 {
+		return results, nil
+	}
+
+	byUUID := make(map[string]*NoteAudioAttachment, len(results))
+	uuids := make([]string, 0, len(results))
+	for _, a := range results {
+		a.Breadcrumbs = make([]shared.NoteAudioBreadcrumbPayload, 0)
+		byUUID[a.UUID] = a
+		uuids = append(uuids, a.UUID)
+	}
+	args = pgx.NamedArgs{
+		"uuids": uuids,
+	}
+	// Breadcrumbs are saved with the version the device uploaded and aren't copied to the
+	// versions we make, so we use the latest version that has any
+	query = `
+		SELECT cell::BIGINT AS cell, created, manually_selected, note_audio_uuid
+		FROM note_audio_breadcrumb breadcrumb
+		WHERE note_audio_uuid = ANY(@uuids)
+			AND note_audio_version = (
+				SELECT MAX(note_audio_version)
+				FROM note_audio_breadcrumb
+				WHERE note_audio_uuid = breadcrumb.note_audio_uuid
+			)
+		ORDER BY note_audio_uuid, position
+	`
+	var breadcrumbs []*struct {
+		Cell             int64     `db:"cell"`
+		Created          time.Time `db:"created"`
+		ManuallySelected bool      `db:"manually_selected"`
+		NoteAudioUUID    string    `db:"note_audio_uuid"`
+	}
+	if err := pgxscan.Select(ctx, PGInstance.DB, &breadcrumbs, query, args); err != nil {
+		return results, fmt.Errorf("Failed to query breadcrumbs of note %s: %v", noteUUID, err)
+	}
+	for _, b := range breadcrumbs {
+		a := byUUID[b.NoteAudioUUID]
+		a.Breadcrumbs = append(a.Breadcrumbs, shared.NoteAudioBreadcrumbPayload{
+			Cell:             shared.H3Cell(b.Cell),
+			Created:          b.Created,
+			ManuallySelected: b.ManuallySelected,
+		})
+	}
+	return results, nil
+}
+
+// Get the image notes attached to a note, oldest first. Images whose upload turned out not to
+// be an image are left out.
+func NoteImageAttachmentList(ctx context.Context, noteUUID string) ([]*NoteImage, error) {
+	results := make([]*NoteImage, 0)
+	if PGInstance == nil {
+		return results, errors.New("You must initialize the DB first")
+	}
+	args := pgx.NamedArgs{
+		"note_uuid": noteUUID,
+	}
+	query := `
+		SELECT first.created, file.height, latest.uuid, file.width
+		FROM (
+			SELECT DISTINCT ON (uuid) deleted, note_uuid, uuid
+			FROM note_image
+			ORDER BY uuid, version DESC
+		) latest
+		JOIN (
+			SELECT DISTINCT ON (uuid) created, uuid
+			FROM note_image
+			ORDER BY uuid, version ASC
+		) first ON first.uuid = latest.uuid
+		LEFT JOIN image_file file ON file.note_image_uuid = latest.uuid AND file.variant = 'original'
+		WHERE latest.note_uuid = @note_uuid
+			AND latest.deleted IS NULL
+			AND file.problem IS NULL
+		ORDER BY first.created
+	`
+	if err := pgxscan.Select(ctx, PGInstance.DB, &results, query, args); err != nil {
+		return results, fmt.Errorf("Failed to query images attached to note %s: %v", noteUUID, err)
+	}
+	return results, nil
+}
@@ -103,6 +103,36 @@ func NoteAudioGetLatest(ctx context.Context, uuid string) (*models.NoteAudio, er
 	).One(ctx, PGInstance.BobDB)
 }
 
+// Get the UUID of the note an audio note is attached to from its latest version. Returns nil
+// if it isn't attached to a note.
+func NoteAudioNoteUUID(ctx context.Context, uuid string) (*string, error) {
+	if PGInstance == nil {
+		return nil, errors.New("You must initialize the DB first")
+	}
+	args := pgx.NamedArgs{
+		"uuid": uuid,
+	}
+	query := `
+		SELECT note_uuid
+		FROM note_audio
+		WHERE uuid = @uuid
+		ORDER BY version DESC
+		LIMIT 1
+	`
+	var results []*struct {
+		NoteUUID *string `db:"note_uuid"`
+	}
+	if err := pgxscan.Select(ctx, PGInstance.DB, &results, query, args); err != nil {
+		return nil, fmt.Errorf("Failed to query the note audio %s is attached to: %v", uuid, err)
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+	return results[0].NoteUUID, nil
+}
+
+// NoteAudioNormalized records that the audio was normalized. New normalized audio hasn't been
+// checked for speech yet.
 func NoteAudioNormalized(uuid string) error {
 	if PGInstance == nil {
 		return errors.New("You must initialize the DB first")
@@ -111,7 +141,7 @@ func NoteAudioNormalized(uuid string) error {
 		"is_audio_normalized": true,
 		"uuid":                uuid,
 	}
-	query := "UPDATE note_audio SET is_audio_normalized=@is_audio_normalized WHERE uuid=@uuid"
+	query := "UPDATE note_audio SET is_audio_normalized=@is_audio_normalized, no_speech=false WHERE uuid=@uuid"
 	_, err := PGInstance.DB.Exec(context.Background(), query, args)
 	return err
 }
@@ -177,39 +207,6 @@ func NoteAudioQueryByVersion(version int) ([]*shared.NoteAudio, error) {
 	}
 	return results, nil
 }
-func NoteAudioToNormalize() ([]*shared.NoteAudio, error) {
-	results := make([]*shared.NoteAudio, 0)
-	if PGInstance == nil {
-		return results, errors.New("You must initialize the DB first")
-	}
-	args := pgx.NamedArgs{}
-	query := "SELECT created, creator, duration, is_audio_normalized, transcription, transcription_user_edited, version, uuid FROM note_audio WHERE is_audio_normalized = FALSE"
-
-	rows, _ := PGInstance.DB.Query(context.Background(), query, args)
-
-	if err := pgxscan.ScanAll(&results, rows); err != nil {
-		log.Println("ScanAll on note_audio error:", err)
-		return results, err
-	}
-	return results, nil
-}
-
-func NoteAudioToTranscodeToOgg() ([]*shared.NoteAudio, error) {
-	results := make([]*shared.NoteAudio, 0)
-	if PGInstance == nil {
-		return results, errors.New("You must initialize the DB first")
-	}
-	args := pgx.NamedArgs{}
-	query := "SELECT created, creator, duration, is_audio_normalized, transcription, transcription_user_edited, version, uuid FROM note_audio WHERE is_transcoded_to_ogg = FALSE"
-
-	rows, _ := PGInstance.DB.Query(context.Background(), query, args)
-
-	if err := pgxscan.ScanAll(&results, rows); err != nil {
-		log.Println("ScanAll on note_audio error:", err)
-		return results, err
-	}
-	return results, nil
-}
 
 func NoteAudioTranscodedToOgg(uuid string) error {
 	if PGInstance == nil {
@@ -280,7 +277,7 @@ func NoteAudioUpdateTranscription(uuid string, transcription string, userUUID in
 			)
 		)
 		INSERT INTO note_audio 
-		(created, creator, deleted, duration, is_audio_normalized, is_transcoded_to_ogg, transcription, transcription_user_edited, version, uuid)
+		(created, creator, deleted, duration, is_audio_normalized, is_transcoded_to_ogg, note_uuid, transcription, transcription_user_edited, version, uuid)
 		SELECT
 			@created,
 			@creator,
@@ -288,6 +285,7 @@ func NoteAudioUpdateTranscription(uuid string, transcription string, userUUID in
 			duration,
 			is_audio_normalized,
 			is_transcoded_to_ogg,
+			note_uuid,
 			@transcription,
 			transcription_user_edited,
 			version + 1,
@@ -310,3 +308,158 @@ func NoteAudioUpdateTranscription(uuid string, transcription string, userUUID in
 	}
 	return nil
 }
+
+// Where the transcription of a version of an audio note came from. A nil engine
+// means the transcription came from the device or a person.
+type NoteAudioTranscriptionSource struct {
+	Confidence          *float32 `db:"transcription_confidence"`
+	Engine              *string  `db:"transcription_engine"`
+	Reviewed            bool     `db:"reviewed"`
+	TranscriptionEdited bool     `db:"transcription_user_edited"`
+	Version             int      `db:"version"`
+}
+
+// Get the source of the transcription on the latest version of an audio note
+func NoteAudioTranscriptionSourceGet(ctx context.Context, uuid string) (*NoteAudioTranscriptionSource, error) {
+	if PGInstance == nil {
+		return nil, errors.New("You must initialize the DB first")
+	}
+	args := pgx.NamedArgs{
+		"uuid": uuid,
+	}
+	query := `
+		SELECT
+			transcription_confidence,
+			transcription_engine,
+			EXISTS (
+				SELECT 1 FROM task_audio_review
+				WHERE note_audio_uuid = @uuid AND completed_by IS NOT NULL
+			) AS reviewed,
+			transcription_user_edited,
+			version
+		FROM note_audio
+		WHERE uuid = @uuid
+		ORDER BY version DESC
+		LIMIT 1
+	`
+	var results []*NoteAudioTranscriptionSource
+	if err := pgxscan.Select(ctx, PGInstance.DB, &results, query, args); err != nil {
+		return nil, fmt.Errorf("Failed to query transcription source for %s: %v", uuid, err)
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("No audio note %s", uuid)
+	}
+	return results[0], nil
+}
+
+// Save a machine transcription of an audio note as a new version so that the
+// original transcription from the device is kept.
+func NoteAudioUpdateMachineTranscription(ctx context.Context, uuid string, transcription string, engine string, confidence float32) error {
+	if PGInstance == nil {
+		return errors.New("You must initialize the DB first")
+	}
+	_, err := insertNextVersion(ctx, PGInstance.DB, "note_audio", uuid, pgx.NamedArgs{
+		"created":                   time.Now(),
+		"transcription":             transcription,
+		"transcription_confidence":  confidence,
+		"transcription_engine":      engine,
+		"transcription_user_edited": false,
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to save machine transcription of %s: %v", uuid, err)
+	}
+	return nil
+}
+
+// NoteAudioFilter picks audio notes by when and by whom they were recorded. Empty fields match every note.
+type NoteAudioFilter struct {
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	CreatorID     *int
+	UUIDs         []string
+}
+
+// Get the UUIDs of the audio notes that match the filter, oldest first. Deleted notes are skipped.
+func NoteAudioUUIDList(ctx context.Context, filter NoteAudioFilter) ([]string, error) {
+	results := make([]string, 0)
+	if PGInstance == nil {
+		return results, errors.New("You must initialize the DB first")
+	}
+	args := pgx.NamedArgs{}
+	conditions := "version_rank = 1 AND deleted IS NULL"
+	// Later versions are created by whoever edited the note, so we use the first version
+	if filter.CreatedAfter != nil {
+		args["created_after"] = *filter.CreatedAfter
+		conditions += " AND created >= @created_after"
+	}
+	if filter.CreatedBefore != nil {
+		args["created_before"] = *filter.CreatedBefore
+		conditions += " AND created < @created_before"
+	}
+	if filter.CreatorID != nil {
+		args["creator"] = *filter.CreatorID
+		conditions += " AND creator = @creator"
+	}
+	if len(filter.UUIDs) > 0 {
+		args["uuids"] = filter.UUIDs
+		conditions += " AND uuid = ANY(@uuids)"
+	}
+	query := `
+		SELECT uuid
+		FROM (
+			SELECT created, creator, deleted, uuid, ROW_NUMBER() OVER (PARTITION BY uuid ORDER BY version ASC) as version_rank
+			FROM note_audio
+		) ranked_rows
+		WHERE ` + conditions + `
+		ORDER BY created
+	`
+	if err := pgxscan.Select(ctx, PGInstance.DB, &results, query, args); err != nil {
+		return results, fmt.Errorf("Failed to query audio notes: %v", err)
+	}
+	return results, nil
+}
+
+// noteDeleted is whether the latest version of a note is deleted
+type noteDeleted struct {
+	Deleted bool   `db:"deleted"`
+	UUID    string `db:"uuid"`
+}
+
+// Get every audio note, including deleted ones, and whether its latest version is deleted
+func NoteAudioDeleted(ctx context.Context) (map[string]bool, error) {
+	results := make(map[string]bool)
+	if PGInstance == nil {
+		return results, errors.New("You must initialize the DB first")
+	}
+	query := `
+		SELECT DISTINCT ON (uuid) deleted IS NOT NULL AS deleted, uuid
+		FROM note_audio
+		ORDER BY uuid, version DESC
+	`
+	var rows []*noteDeleted
+	if err := pgxscan.Select(ctx, PGInstance.DB, &rows, query); err != nil {
+		return results, fmt.Errorf("Failed to query audio notes: %v", err)
+	}
+	for _, row := range rows {
+		results[row.UUID] = row.Deleted
+	}
+	return results, nil
+}
+
+// Set whether the normalized and OGG files of an audio note exist
+func NoteAudioFileFlagsSet(ctx context.Context, uuid string, isAudioNormalized bool, isTranscodedToOgg bool) error {
+	if PGInstance == nil {
+		return errors.New("You must initialize the DB first")
+	}
+	args := pgx.NamedArgs{
+		"is_audio_normalized":  isAudioNormalized,
+		"is_transcoded_to_ogg": isTranscodedToOgg,
+		"uuid":                 uuid,
+	}
+	query := "UPDATE note_audio SET is_audio_normalized=@is_audio_normalized, is_transcoded_to_ogg=@is_transcoded_to_ogg WHERE uuid=@uuid"
+	_, err := PGInstance.DB.Exec(ctx, query, args)
+	if err != nil {
+		return fmt.Errorf("Failed to update file flags of audio note %s: %v", uuid, err)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+)
+
+// NoteAudioSegment is a stretch of speech within an audio note, in seconds from the start
+type NoteAudioSegment struct {
+	End      float32 `db:"end_time"`
+	Position int     `db:"position"`
+	Start    float32 `db:"start_time"`
+}
+
+// Get the speech segments of an audio note in order
+func NoteAudioSegmentList(ctx context.Context, uuid string) ([]*NoteAudioSegment, error) {
+	results := make([]*NoteAudioSegment, 0)
+	if PGInstance == nil {
+		return results, errors.New("You must initialize the DB first")
+	}
+	args := pgx.NamedArgs{
+		"uuid": uuid,
+	}
+	query := "SELECT end_time, position, start_time FROM note_audio_segment WHERE note_audio_uuid=@uuid ORDER BY position"
+	if err := pgxscan.Select(ctx, PGInstance.DB, &results, query, args); err != nil {
+		return results, fmt.Errorf("Failed to query segments of %s: %v", uuid, err)
+	}
+	return results, nil
+}
+
+// NoteAudioNoSpeech is true when the audio note was checked for speech and had none
+func NoteAudioNoSpeech(ctx context.Context, uuid string) (bool, error) {
+	if PGInstance == nil {
+		return false, errors.New("You must initialize the DB first")
+	}
+	var noSpeech bool
+	err := PGInstance.DB.QueryRow(ctx, "SELECT no_speech FROM note_audio WHERE uuid=@uuid ORDER BY version DESC LIMIT 1", pgx.NamedArgs{
+		"uuid": uuid,
+	}).Scan(&noSpeech)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("Failed to query speech of %s: %v", uuid, err)
+	}
+	return noSpeech, nil
+}
+
+// Replace the speech segments of an audio note
+func NoteAudioSegmentsSave(ctx context.Context, uuid string, segments []*NoteAudioSegment) error {
+	if PGInstance == nil {
+		return errors.New("You must initialize the DB first")
+	}
+	var options pgx.TxOptions
+	transaction, err := PGInstance.DB.BeginTx(ctx, options)
+	if err != nil {
+		return fmt.Errorf("Failed to begin transaction: %v", err)
+	}
+	defer transaction.Rollback(ctx)
+
+	args := pgx.NamedArgs{
+		"uuid": uuid,
+	}
+	_, err = transaction.Exec(ctx, "DELETE FROM note_audio_segment WHERE note_audio_uuid=@uuid", args)
+	if err != nil {
+		return fmt.Errorf("Failed to delete segments of %s: %v", uuid, err)
+	}
+	// Without segments there's no trimmed audio to tell that it's been checked, so we keep that
+	_, err = transaction.Exec(ctx, "UPDATE note_audio SET no_speech=@no_speech WHERE uuid=@uuid", pgx.NamedArgs{
+		"no_speech": len(segments) == 0,
+		"uuid":      uuid,
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to update speech of %s: %v", uuid, err)
+	}
+	rows := make([][]interface{}, 0, len(segments))
+	for i, s := range segments {
+		rows = append(rows, []interface{}{
+			s.End,
+			uuid,
+			i,
+			s.Start,
+		})
+	}
+	_, err = transaction.CopyFrom(
+		ctx,
+		pgx.Identifier{"note_audio_segment"},
+		[]string{"end_time", "note_audio_uuid", "position", "start_time"},
+		pgx.CopyFromRows(rows),
+	)
+	if err != nil {
+		return fmt.Errorf("Failed to insert segments of %s: %v", uuid, err)
+	}
+	err = transaction.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to commit transaction: %v", err)
+	}
+	return nil
+}
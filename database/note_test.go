@@ -0,0 +1,188 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Gleipnir-Technology/fieldseeker-sync/shared"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// connectTestDB connects to the migrated database in FIELDSEEKER_SYNC_TEST_DATABASE_URL. Tests
+// that need it are skipped when it isn't set. What they write is left for them to clean up.
+func connectTestDB(t *testing.T) {
+	url := os.Getenv("FIELDSEEKER_SYNC_TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("FIELDSEEKER_SYNC_TEST_DATABASE_URL isn't set")
+	}
+	if err := ConnectDB(context.Background(), url); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNoteAttachmentRoundTrip(t *testing.T) {
+	connectTestDB(t)
+	ctx := context.Background()
+
+	var userID int
+	err := PGInstance.DB.QueryRow(ctx, "INSERT INTO user_ (display_name, username) VALUES ('Test', @username) RETURNING id", pgx.NamedArgs{
+		"username": "test-" + uuid.NewString(),
+	}).Scan(&userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	audioUUID := uuid.New()
+	noteUUID := uuid.New()
+	t.Cleanup(func() {
+		args := pgx.NamedArgs{"audio": audioUUID.String(), "note": noteUUID.String(), "user": userID}
+		for _, query := range []string{
+			"DELETE FROM note_audio WHERE uuid = @audio",
+			"DELETE FROM history_note WHERE uuid = @note",
+			"DELETE FROM note WHERE uuid = @note",
+			"DELETE FROM user_ WHERE id = @user",
+		} {
+			if _, err := PGInstance.DB.Exec(ctx, query, args); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+
+	transcription := "Larvae in the standpipe"
+	err = NoteAudioCreate(ctx, audioUUID, shared.NoteAudioPayload{
+		Created:       time.Now(),
+		Duration:      12,
+		Transcription: &transcription,
+		UUID:          audioUUID.String(),
+		Version:       1,
+	}, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Reviewed, with a machine transcription and processed files
+	_, err = PGInstance.DB.Exec(ctx, `
+		UPDATE note_audio
+		SET has_been_reviewed = true,
+			is_audio_normalized = true,
+			is_transcoded_to_ogg = true,
+			needs_further_review = true,
+			transcription_confidence = 0.9,
+			transcription_engine = 'test',
+			transcription_internally_edited = true
+		WHERE uuid = @uuid
+	`, pgx.NamedArgs{"uuid": audioUUID.String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := shared.NidusNotePayload{
+		Audio:     []string{audioUUID.String()},
+		Location:  shared.Location{Latitude: 36.3, Longitude: -119.3},
+		Text:      "Check the standpipe",
+		Timestamp: time.Now(),
+		UUID:      noteUUID.String(),
+	}
+	if err := NoteUpdate(ctx, noteUUID, payload, userID); err != nil {
+		t.Fatal(err)
+	}
+	payload.Audio = []string{}
+	if err := NoteUpdate(ctx, noteUUID, payload, userID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only who made the version, when and the note it's attached to change
+	query := `
+		SELECT
+			note_uuid,
+			(to_jsonb(note_audio) - 'created' - 'creator' - 'note_uuid' - 'version')::TEXT AS rest,
+			version
+		FROM note_audio
+		WHERE uuid = @uuid
+		ORDER BY version
+	`
+	var versions []*struct {
+		NoteUUID *string `db:"note_uuid"`
+		Rest     string  `db:"rest"`
+		Version  int     `db:"version"`
+	}
+	if err := pgxscan.Select(ctx, PGInstance.DB, &versions, query, pgx.NamedArgs{"uuid": audioUUID.String()}); err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 3 {
+		t.Fatalf("Got %d versions, expected 3", len(versions))
+	}
+	for i, v := range versions {
+		if v.Version != i+1 {
+			t.Errorf("Got version %d at %d", v.Version, i)
+		}
+		if v.Rest != versions[0].Rest {
+			t.Errorf("Version %d changed from %s to %s", v.Version, versions[0].Rest, v.Rest)
+		}
+	}
+	if versions[0].NoteUUID != nil || versions[2].NoteUUID != nil {
+		t.Errorf("Got attached before attaching or after detaching")
+	}
+	if versions[1].NoteUUID == nil || *versions[1].NoteUUID != noteUUID.String() {
+		t.Errorf("Got %v attached, expected %s", versions[1].NoteUUID, noteUUID)
+	}
+}
+
+func TestNoteUpdateDeleted(t *testing.T) {
+	connectTestDB(t)
+	ctx := context.Background()
+
+	var userID int
+	err := PGInstance.DB.QueryRow(ctx, "INSERT INTO user_ (display_name, username) VALUES ('Test', @username) RETURNING id", pgx.NamedArgs{
+		"username": "test-" + uuid.NewString(),
+	}).Scan(&userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	noteUUID := uuid.New()
+	t.Cleanup(func() {
+		args := pgx.NamedArgs{"note": noteUUID.String(), "user": userID}
+		for _, query := range []string{
+			"DELETE FROM history_note WHERE uuid = @note",
+			"DELETE FROM note WHERE uuid = @note",
+			"DELETE FROM user_ WHERE id = @user",
+		} {
+			if _, err := PGInstance.DB.Exec(ctx, query, args); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+
+	payload := shared.NidusNotePayload{
+		Location:  shared.Location{Latitude: 36.3, Longitude: -119.3},
+		Text:      "Check the standpipe",
+		Timestamp: time.Now(),
+		UUID:      noteUUID.String(),
+	}
+	if err := NoteUpdate(ctx, noteUUID, payload, userID); err != nil {
+		t.Fatal(err)
+	}
+	if deleted, err := NoteDelete(ctx, noteUUID.String(), userID); err != nil || !deleted {
+		t.Fatalf("Got deleted %v: %v", deleted, err)
+	}
+	payload.Text = "Standpipe is dry"
+	if err := NoteUpdate(ctx, noteUUID, payload, userID); !errors.Is(err, ErrNoteDeleted) {
+		t.Fatalf("Got %v updating a deleted note", err)
+	}
+
+	// The edit isn't saved, not even as history
+	var text string
+	var versions int
+	err = PGInstance.DB.QueryRow(ctx, "SELECT text, (SELECT COUNT(*) FROM history_note WHERE uuid = @uuid) FROM note WHERE uuid = @uuid", pgx.NamedArgs{
+		"uuid": noteUUID.String(),
+	}).Scan(&text, &versions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "Check the standpipe" || versions != 2 {
+		t.Errorf("Got %q with %d versions, expected the text before the deletion and 2", text, versions)
+	}
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Gleipnir-Technology/fieldseeker-sync/shared"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+)
+
+// TilePoint is a row of an FS_ table drawn on a map tile
+type TilePoint struct {
+	Properties map[string]any
+	X          float64
+	Y          float64
+}
+
+// Get the points of a FieldSeeker table inside the bounds with the given columns as their
+// properties. The table and columns are put in the query as they are, so they must not come
+// from the user.
+func TilePointsQuery(ctx context.Context, table string, columns []string, bounds shared.Bounds) ([]TilePoint, error) {
+	results := make([]TilePoint, 0)
+	if PGInstance == nil {
+		return results, errors.New("You must initialize the DB first")
+	}
+	args := pgx.NamedArgs{
+		"east":  bounds.East,
+		"north": bounds.North,
+		"south": bounds.South,
+		"west":  bounds.West,
+	}
+	query := fmt.Sprintf("SELECT geometry_x,geometry_y,%s FROM %s WHERE geometry_x BETWEEN @west AND @east AND geometry_y BETWEEN @south AND @north", strings.Join(columns, ","), table)
+	rows, err := PGInstance.DB.Query(ctx, query, args)
+	if err != nil {
+		return results, fmt.Errorf("Failed to query %s: %v", table, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return results, fmt.Errorf("Failed to read %s: %v", table, err)
+		}
+		x, xOK := values[0].(float64)
+		y, yOK := values[1].(float64)
+		if !xOK || !yOK {
+			continue
+		}
+		point := TilePoint{
+			Properties: make(map[string]any, len(columns)),
+			X:          x,
+			Y:          y,
+		}
+		for i, column := range columns {
+			if values[i+2] != nil {
+				point.Properties[column] = values[i+2]
+			}
+		}
+		results = append(results, point)
+	}
+	if err := rows.Err(); err != nil {
+		return results, fmt.Errorf("Failed to read %s: %v", table, err)
+	}
+	return results, nil
+}
+
+// Get the time a FieldSeeker table last changed. Sync sets updated on every row it writes, so
+// it changes whenever a sync changes the table.
+func TileGeneration(ctx context.Context, table string) (time.Time, error) {
+	if PGInstance == nil {
+		return time.Time{}, errors.New("You must initialize the DB first")
+	}
+	query := fmt.Sprintf("SELECT GREATEST((SELECT MAX(updated) FROM %s), (SELECT MAX(deleted) FROM fs_deleted)) AS generation", table)
+	var results []*struct {
+		Generation *time.Time `db:"generation"`
+	}
+	if err := pgxscan.Select(ctx, PGInstance.DB, &results, query); err != nil {
+		return time.Time{}, fmt.Errorf("Failed to query when %s changed: %v", table, err)
+	}
+	if len(results) == 0 || results[0].Generation == nil {
+		return time.Time{}, nil
+	}
+	return *results[0].Generation, nil
+}
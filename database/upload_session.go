@@ -0,0 +1,147 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+type UploadKind string
+
+const (
+	UploadKindAudio UploadKind = "audio"
+	UploadKindImage UploadKind = "image"
+)
+
+// UploadSession tracks a file being uploaded in chunks. The chunks are kept outside the
+// database, the session records what the finished file should be.
+type UploadSession struct {
+	ID          string     `db:"id"`
+	Completed   *time.Time `db:"completed"`
+	ContentUUID string     `db:"content_uuid"`
+	Created     time.Time  `db:"created"`
+	Creator     int        `db:"creator"`
+	Kind        UploadKind `db:"kind"`
+	// SHA256 is the hex checksum the client says the finished file has
+	SHA256 string `db:"sha256"`
+	Size   int64  `db:"size"`
+}
+
+// Start an upload session, or get the existing one if the client already started uploading
+// the same content. A session for different content replaces an unfinished one.
+func UploadSessionCreate(ctx context.Context, kind UploadKind, contentUUID string, creator int, sha256 string, size int64) (*UploadSession, error) {
+	if PGInstance == nil {
+		return nil, errors.New("You must initialize the DB first")
+	}
+	existing, err := UploadSessionLatest(ctx, kind, contentUUID, creator)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.SHA256 == sha256 && existing.Size == size {
+		return existing, nil
+	}
+	session := &UploadSession{
+		ID:          uuid.New().String(),
+		ContentUUID: contentUUID,
+		Created:     time.Now(),
+		Creator:     creator,
+		Kind:        kind,
+		SHA256:      sha256,
+		Size:        size,
+	}
+	args := pgx.NamedArgs{
+		"content_uuid": session.ContentUUID,
+		"created":      session.Created,
+		"creator":      session.Creator,
+		"id":           session.ID,
+		"kind":         string(session.Kind),
+		"sha256":       session.SHA256,
+		"size":         session.Size,
+	}
+	query := `
+		INSERT INTO upload_session (id, content_uuid, created, creator, kind, sha256, size)
+		VALUES (@id, @content_uuid, @created, @creator, @kind, @sha256, @size)
+	`
+	_, err = PGInstance.DB.Exec(ctx, query, args)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to insert upload session for %s %s: %v", kind, contentUUID, err)
+	}
+	return session, nil
+}
+
+// Get an upload session. Returns nil if there is no such session.
+func UploadSessionGet(ctx context.Context, id string) (*UploadSession, error) {
+	if PGInstance == nil {
+		return nil, errors.New("You must initialize the DB first")
+	}
+	args := pgx.NamedArgs{
+		"id": id,
+	}
+	query := `
+		SELECT id, completed, content_uuid, created, creator, kind, sha256, size
+		FROM upload_session
+		WHERE id = @id
+	`
+	var results []*UploadSession
+	if err := pgxscan.Select(ctx, PGInstance.DB, &results, query, args); err != nil {
+		return nil, fmt.Errorf("Failed to query upload session %s: %v", id, err)
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+	return results[0], nil
+}
+
+// Get the most recent upload session the user started for some content. Returns nil if
+// there isn't one.
+func UploadSessionLatest(ctx context.Context, kind UploadKind, contentUUID string, creator int) (*UploadSession, error) {
+	if PGInstance == nil {
+		return nil, errors.New("You must initialize the DB first")
+	}
+	args := pgx.NamedArgs{
+		"content_uuid": contentUUID,
+		"creator":      creator,
+		"kind":         string(kind),
+	}
+	query := `
+		SELECT id, completed, content_uuid, created, creator, kind, sha256, size
+		FROM upload_session
+		WHERE kind = @kind AND content_uuid = @content_uuid AND creator = @creator
+		ORDER BY created DESC
+		LIMIT 1
+	`
+	var results []*UploadSession
+	if err := pgxscan.Select(ctx, PGInstance.DB, &results, query, args); err != nil {
+		return nil, fmt.Errorf("Failed to query upload session for %s %s: %v", kind, contentUUID, err)
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+	return results[0], nil
+}
+
+// Mark an upload session complete. Returns false if it was already complete, which means
+// whoever completed it first has already handled the finished file.
+func UploadSessionComplete(ctx context.Context, id string) (bool, error) {
+	if PGInstance == nil {
+		return false, errors.New("You must initialize the DB first")
+	}
+	args := pgx.NamedArgs{
+		"completed": time.Now(),
+		"id":        id,
+	}
+	query := `
+		UPDATE upload_session SET completed = @completed
+		WHERE id = @id AND completed IS NULL
+	`
+	tag, err := PGInstance.DB.Exec(ctx, query, args)
+	if err != nil {
+		return false, fmt.Errorf("Failed to complete upload session %s: %v", id, err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
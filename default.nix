@@ -11,6 +11,7 @@ pkgs.buildGoModule rec {
 		"cmd/convert-completed-tasks"
 		"cmd/download-schema"
 		"cmd/dump"
+		"cmd/fssync"
 		"cmd/full-export"
 		"cmd/login"
 		"cmd/migrate"
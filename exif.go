@@ -0,0 +1,422 @@
+package fssync
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Exif is the part of a photo's EXIF metadata that we use
+type Exif struct {
+	Latitude  *float64
+	Longitude *float64
+	// Orientation is how the image has to be rotated and flipped to display upright, from 1 to 8
+	Orientation int
+	// Taken is when the photo was taken in the camera's local time
+	Taken *time.Time
+}
+
+// The EXIF tags we read
+const (
+	exifTagDateTime         = 0x0132
+	exifTagDateTimeOriginal = 0x9003
+	exifTagExifIFD          = 0x8769
+	exifTagGPSIFD           = 0x8825
+	exifTagGPSLatitude      = 0x0002
+	exifTagGPSLatitudeRef   = 0x0001
+	exifTagGPSLongitude     = 0x0004
+	exifTagGPSLongitudeRef  = 0x0003
+	exifTagOrientation      = 0x0112
+)
+
+const (
+	exifTypeASCII    = 2
+	exifTypeShort    = 3
+	exifTypeLong     = 4
+	exifTypeRational = 5
+)
+
+var errNoExif = errors.New("no EXIF metadata")
+
+// exifEntry is a single tag in an image file directory. Value is the raw bytes of the value
+// wherever they're stored.
+type exifEntry struct {
+	count int
+	kind  uint16
+	value []byte
+}
+
+// parseJPEGExif reads the EXIF metadata from the APP1 segment of a JPEG. It returns errNoExif
+// if there isn't any.
+func parseJPEGExif(data []byte) (*Exif, error) {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return nil, errors.New("not a JPEG")
+	}
+	i := 2
+	for i+4 <= len(data) {
+		if data[i] != 0xff {
+			return nil, errors.New("corrupt JPEG segment")
+		}
+		marker := data[i+1]
+		// Start of scan, the metadata segments all come before this
+		if marker == 0xda {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return nil, errors.New("corrupt JPEG segment")
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return parseTIFFExif(segment[6:])
+		}
+		i += 2 + length
+	}
+	return nil, errNoExif
+}
+
+// parseTIFFExif reads EXIF metadata in TIFF layout, which is how it's stored inside a JPEG
+func parseTIFFExif(data []byte) (*Exif, error) {
+	if len(data) < 8 {
+		return nil, errors.New("EXIF is too short")
+	}
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, errors.New("EXIF has an unknown byte order")
+	}
+	ifd0, err := readExifIFD(data, order, order.Uint32(data[4:]))
+	if err != nil {
+		return nil, err
+	}
+	result := &Exif{Orientation: 1}
+	if orientation, ok := exifShort(ifd0[exifTagOrientation], order); ok && orientation >= 1 && orientation <= 8 {
+		result.Orientation = int(orientation)
+	}
+
+	taken := ifd0[exifTagDateTime]
+	if offset, ok := exifLong(ifd0[exifTagExifIFD], order); ok {
+		exifIFD, err := readExifIFD(data, order, offset)
+		if err == nil {
+			if original, ok := exifIFD[exifTagDateTimeOriginal]; ok {
+				taken = original
+			}
+		}
+	}
+	if taken != nil && taken.kind == exifTypeASCII {
+		value := strings.TrimRight(string(taken.value), "\x00 ")
+		if t, err := time.Parse("2006:01:02 15:04:05", value); err == nil {
+			result.Taken = &t
+		}
+	}
+
+	if offset, ok := exifLong(ifd0[exifTagGPSIFD], order); ok {
+		gps, err := readExifIFD(data, order, offset)
+		if err == nil {
+			result.Latitude = exifCoordinate(gps[exifTagGPSLatitude], gps[exifTagGPSLatitudeRef], "S", order)
+			result.Longitude = exifCoordinate(gps[exifTagGPSLongitude], gps[exifTagGPSLongitudeRef], "W", order)
+		}
+	}
+	return result, nil
+}
+
+// exifCoordinate converts degrees, minutes and seconds to decimal degrees, negative
+// when the reference is the given hemisphere
+func exifCoordinate(value *exifEntry, ref *exifEntry, negative string, order binary.ByteOrder) *float64 {
+	if value == nil || value.kind != exifTypeRational || value.count != 3 || len(value.value) < 24 {
+		return nil
+	}
+	var parts [3]float64
+	for i := range parts {
+		numerator := order.Uint32(value.value[i*8:])
+		denominator := order.Uint32(value.value[i*8+4:])
+		if denominator == 0 {
+			return nil
+		}
+		parts[i] = float64(numerator) / float64(denominator)
+	}
+	result := parts[0] + parts[1]/60 + parts[2]/3600
+	if ref != nil && strings.HasPrefix(string(ref.value), negative) {
+		result = -result
+	}
+	return &result
+}
+
+// exifShort is the first value of a SHORT entry. It's false if there isn't one.
+func exifShort(entry *exifEntry, order binary.ByteOrder) (uint16, bool) {
+	if entry == nil || entry.kind != exifTypeShort || entry.count < 1 || len(entry.value) < 2 {
+		return 0, false
+	}
+	return order.Uint16(entry.value), true
+}
+
+// exifLong is the first value of a LONG entry. It's false if there isn't one.
+func exifLong(entry *exifEntry, order binary.ByteOrder) (uint32, bool) {
+	if entry == nil || entry.kind != exifTypeLong || entry.count < 1 || len(entry.value) < 4 {
+		return 0, false
+	}
+	return order.Uint32(entry.value), true
+}
+
+// readExifIFD reads the entries of the image file directory at the offset
+func readExifIFD(data []byte, order binary.ByteOrder, offset uint32) (map[uint16]*exifEntry, error) {
+	if int(offset)+2 > len(data) {
+		return nil, errors.New("EXIF directory is out of bounds")
+	}
+	count := int(order.Uint16(data[offset:]))
+	start := int(offset) + 2
+	if start+count*12 > len(data) {
+		return nil, errors.New("EXIF directory is out of bounds")
+	}
+	sizes := map[uint16]int{
+		exifTypeASCII:    1,
+		exifTypeShort:    2,
+		exifTypeLong:     4,
+		exifTypeRational: 8,
+	}
+	entries := make(map[uint16]*exifEntry, count)
+	for i := 0; i < count; i++ {
+		raw := data[start+i*12 : start+i*12+12]
+		tag := order.Uint16(raw)
+		kind := order.Uint16(raw[2:])
+		n := int(order.Uint32(raw[4:]))
+		size, ok := sizes[kind]
+		if !ok {
+			continue
+		}
+		length := size * n
+		// Values of four bytes or less are stored in place of the offset
+		value := raw[8:12]
+		if length > 4 {
+			valueOffset := int(order.Uint32(raw[8:]))
+			if valueOffset < 0 || valueOffset+length > len(data) {
+				continue
+			}
+			value = data[valueOffset : valueOffset+length]
+		} else {
+			value = value[:length]
+		}
+		entries[tag] = &exifEntry{count: n, kind: kind, value: value}
+	}
+	return entries, nil
+}
+
+// isoBox is a box of an ISO media file, like HEIC or MP4
+type isoBox struct {
+	kind    string
+	content []byte
+}
+
+// readISOBoxes splits the boxes inside data
+func readISOBoxes(data []byte) ([]isoBox, error) {
+	boxes := make([]isoBox, 0)
+	for i := 0; i < len(data); {
+		if i+8 > len(data) {
+			return nil, errors.New("corrupt ISO media box")
+		}
+		size := uint64(binary.BigEndian.Uint32(data[i:]))
+		kind := string(data[i+4 : i+8])
+		header := 8
+		switch size {
+		case 0:
+			// The box runs to the end of the file
+			size = uint64(len(data) - i)
+		case 1:
+			if i+16 > len(data) {
+				return nil, errors.New("corrupt ISO media box")
+			}
+			size = binary.BigEndian.Uint64(data[i+8:])
+			header = 16
+		}
+		if size < uint64(header) || size > uint64(len(data)-i) {
+			return nil, errors.New("corrupt ISO media box")
+		}
+		boxes = append(boxes, isoBox{
+			kind:    kind,
+			content: data[i+header : i+int(size)],
+		})
+		i += int(size)
+	}
+	return boxes, nil
+}
+
+func findISOBox(boxes []isoBox, kind string) *isoBox {
+	for i := range boxes {
+		if boxes[i].kind == kind {
+			return &boxes[i]
+		}
+	}
+	return nil
+}
+
+// isoReader reads the big endian fields of a box, noting when it runs out
+type isoReader struct {
+	data []byte
+	err  error
+}
+
+func (r *isoReader) uint(size int) uint64 {
+	if r.err != nil {
+		return 0
+	}
+	if size > len(r.data) {
+		r.err = errors.New("ISO media box is too short")
+		return 0
+	}
+	var value uint64
+	for _, b := range r.data[:size] {
+		value = value<<8 | uint64(b)
+	}
+	r.data = r.data[size:]
+	return value
+}
+
+// parseHEICExif reads the EXIF metadata from the Exif item of a HEIC image. It returns
+// errNoExif if there isn't one.
+func parseHEICExif(data []byte) (*Exif, error) {
+	boxes, err := readISOBoxes(data)
+	if err != nil {
+		return nil, err
+	}
+	meta := findISOBox(boxes, "meta")
+	if meta == nil || len(meta.content) < 4 {
+		return nil, errNoExif
+	}
+	// meta is a full box, its children come after the version and flags
+	children, err := readISOBoxes(meta.content[4:])
+	if err != nil {
+		return nil, err
+	}
+	iinf := findISOBox(children, "iinf")
+	iloc := findISOBox(children, "iloc")
+	if iinf == nil || iloc == nil {
+		return nil, errNoExif
+	}
+	itemID, err := heicExifItem(iinf.content)
+	if err != nil {
+		return nil, err
+	}
+	item, err := heicItemData(data, iloc.content, itemID)
+	if err != nil {
+		return nil, err
+	}
+	// The item starts with the offset of the TIFF header from the end of the offset
+	if len(item) < 4 {
+		return nil, errors.New("EXIF item is too short")
+	}
+	tiffOffset := uint64(binary.BigEndian.Uint32(item)) + 4
+	if tiffOffset > uint64(len(item)) {
+		return nil, errors.New("EXIF item is too short")
+	}
+	return parseTIFFExif(item[tiffOffset:])
+}
+
+// heicExifItem finds the ID of the Exif item in an item information box
+func heicExifItem(iinf []byte) (uint64, error) {
+	r := &isoReader{data: iinf}
+	version := r.uint(1)
+	r.uint(3)
+	if version == 0 {
+		r.uint(2)
+	} else {
+		r.uint(4)
+	}
+	if r.err != nil {
+		return 0, r.err
+	}
+	entries, err := readISOBoxes(r.data)
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		if entry.kind != "infe" {
+			continue
+		}
+		e := &isoReader{data: entry.content}
+		version := e.uint(1)
+		e.uint(3)
+		// Earlier versions don't have item types
+		if version < 2 {
+			continue
+		}
+		var id uint64
+		if version == 2 {
+			id = e.uint(2)
+		} else {
+			id = e.uint(4)
+		}
+		e.uint(2)
+		// The item type is "Exif"
+		kind := e.uint(4)
+		if e.err == nil && kind == 0x45786966 {
+			return id, nil
+		}
+	}
+	return 0, errNoExif
+}
+
+// heicItemData finds the content of an item from the item location box. Only items stored in
+// the file itself are supported.
+func heicItemData(data []byte, iloc []byte, itemID uint64) ([]byte, error) {
+	r := &isoReader{data: iloc}
+	version := r.uint(1)
+	r.uint(3)
+	sizes := r.uint(2)
+	offsetSize := int(sizes >> 12 & 0xf)
+	lengthSize := int(sizes >> 8 & 0xf)
+	baseOffsetSize := int(sizes >> 4 & 0xf)
+	indexSize := 0
+	if version == 1 || version == 2 {
+		indexSize = int(sizes & 0xf)
+	}
+	var count uint64
+	if version < 2 {
+		count = r.uint(2)
+	} else {
+		count = r.uint(4)
+	}
+	for i := uint64(0); i < count && r.err == nil; i++ {
+		var id uint64
+		if version < 2 {
+			id = r.uint(2)
+		} else {
+			id = r.uint(4)
+		}
+		method := uint64(0)
+		if version == 1 || version == 2 {
+			method = r.uint(2) & 0xf
+		}
+		r.uint(2)
+		base := r.uint(baseOffsetSize)
+		extents := r.uint(2)
+		var content []byte
+		for j := uint64(0); j < extents && r.err == nil; j++ {
+			r.uint(indexSize)
+			offset := base + r.uint(offsetSize)
+			length := r.uint(lengthSize)
+			if id != itemID {
+				continue
+			}
+			if method != 0 {
+				return nil, errors.New("EXIF item isn't stored in the file")
+			}
+			if offset > uint64(len(data)) || length > uint64(len(data))-offset {
+				return nil, errors.New("EXIF item is out of bounds")
+			}
+			content = append(content, data[offset:offset+length]...)
+		}
+		if r.err == nil && id == itemID {
+			return content, nil
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return nil, errNoExif
+}
@@ -0,0 +1,329 @@
+package fssync
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+)
+
+// testExifEntry is an entry of a test image file directory. When ifd is set the entry is a LONG
+// pointing at that directory.
+type testExifEntry struct {
+	tag   uint16
+	kind  uint16
+	count uint32
+	value []byte
+	ifd   int
+}
+
+// testTIFF lays out image file directories one after another with the values that don't fit in
+// an entry after them. The first directory is IFD0.
+func testTIFF(order binary.ByteOrder, ifds ...[]testExifEntry) []byte {
+	offsets := make([]int, len(ifds))
+	end := 8
+	for i, entries := range ifds {
+		offsets[i] = end
+		end += 2 + 12*len(entries) + 4
+	}
+	data := make([]byte, end)
+	if order == binary.LittleEndian {
+		copy(data, "II")
+	} else {
+		copy(data, "MM")
+	}
+	order.PutUint16(data[2:], 42)
+	order.PutUint32(data[4:], uint32(offsets[0]))
+	for i, entries := range ifds {
+		at := offsets[i]
+		order.PutUint16(data[at:], uint16(len(entries)))
+		for j, entry := range entries {
+			raw := data[at+2+j*12:]
+			order.PutUint16(raw, entry.tag)
+			if entry.ifd > 0 {
+				order.PutUint16(raw[2:], exifTypeLong)
+				order.PutUint32(raw[4:], 1)
+				order.PutUint32(raw[8:], uint32(offsets[entry.ifd]))
+				continue
+			}
+			order.PutUint16(raw[2:], entry.kind)
+			order.PutUint32(raw[4:], entry.count)
+			if len(entry.value) <= 4 {
+				copy(raw[8:12], entry.value)
+				continue
+			}
+			order.PutUint32(raw[8:], uint32(len(data)))
+			data = append(data, entry.value...)
+		}
+	}
+	return data
+}
+
+// testJPEG wraps EXIF in the segments of a JPEG
+func testJPEG(tiff []byte) []byte {
+	data := []byte{0xff, 0xd8, 0xff, 0xe1, 0, 0}
+	binary.BigEndian.PutUint16(data[4:], uint16(2+6+len(tiff)))
+	data = append(data, "Exif\x00\x00"...)
+	data = append(data, tiff...)
+	return append(data, 0xff, 0xda, 0, 2)
+}
+
+func testShort(order binary.ByteOrder, value uint16) []byte {
+	b := make([]byte, 2)
+	order.PutUint16(b, value)
+	return b
+}
+
+func testRationals(order binary.ByteOrder, values ...uint32) []byte {
+	b := make([]byte, 4*len(values))
+	for i, v := range values {
+		order.PutUint32(b[i*4:], v)
+	}
+	return b
+}
+
+func testExifComplete(order binary.ByteOrder) []byte {
+	return testTIFF(order,
+		[]testExifEntry{
+			{tag: exifTagOrientation, kind: exifTypeShort, count: 1, value: testShort(order, 6)},
+			{tag: exifTagDateTime, kind: exifTypeASCII, count: 20, value: []byte("2024:05:01 10:00:00\x00")},
+			{tag: exifTagExifIFD, ifd: 1},
+			{tag: exifTagGPSIFD, ifd: 2},
+		},
+		[]testExifEntry{
+			{tag: exifTagDateTimeOriginal, kind: exifTypeASCII, count: 20, value: []byte("2024:05:01 09:30:00\x00")},
+		},
+		[]testExifEntry{
+			{tag: exifTagGPSLatitudeRef, kind: exifTypeASCII, count: 2, value: []byte("N\x00")},
+			{tag: exifTagGPSLatitude, kind: exifTypeRational, count: 3, value: testRationals(order, 40, 1, 26, 1, 4614, 100)},
+			{tag: exifTagGPSLongitudeRef, kind: exifTypeASCII, count: 2, value: []byte("W\x00")},
+			{tag: exifTagGPSLongitude, kind: exifTypeRational, count: 3, value: testRationals(order, 79, 1, 58, 1, 5616, 100)},
+		},
+	)
+}
+
+func TestParseJPEGExif(t *testing.T) {
+	le := binary.LittleEndian
+	taken := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	dateTime := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	latitude := 40 + 26.0/60 + 46.14/3600
+	longitude := -(79 + 58.0/60 + 56.16/3600)
+	complete := testJPEG(testExifComplete(le))
+	cases := []struct {
+		name        string
+		data        []byte
+		err         bool
+		orientation int
+		taken       *time.Time
+		latitude    *float64
+		longitude   *float64
+	}{
+		{
+			name:        "little endian",
+			data:        complete,
+			orientation: 6,
+			taken:       &taken,
+			latitude:    &latitude,
+			longitude:   &longitude,
+		},
+		{
+			name:        "big endian",
+			data:        testJPEG(testExifComplete(binary.BigEndian)),
+			orientation: 6,
+			taken:       &taken,
+			latitude:    &latitude,
+			longitude:   &longitude,
+		},
+		{
+			name: "pointers with a count of 0",
+			data: testJPEG(testTIFF(le, []testExifEntry{
+				{tag: exifTagDateTime, kind: exifTypeASCII, count: 20, value: []byte("2024:05:01 10:00:00\x00")},
+				{tag: exifTagExifIFD, kind: exifTypeLong, count: 0},
+				{tag: exifTagGPSIFD, kind: exifTypeLong, count: 0},
+				{tag: exifTagOrientation, kind: exifTypeShort, count: 0},
+			})),
+			orientation: 1,
+			taken:       &dateTime,
+		},
+		{
+			name: "pointers out of bounds",
+			data: testJPEG(testTIFF(le, []testExifEntry{
+				{tag: exifTagExifIFD, kind: exifTypeLong, count: 1, value: []byte{0xff, 0xff, 0xff, 0x7f}},
+				{tag: exifTagGPSIFD, kind: exifTypeLong, count: 1, value: []byte{0xf0, 0xff, 0xff, 0xff}},
+			})),
+			orientation: 1,
+		},
+		{
+			name: "pointer of the wrong type",
+			data: testJPEG(testTIFF(le, []testExifEntry{
+				{tag: exifTagGPSIFD, kind: exifTypeShort, count: 1, value: testShort(le, 8)},
+			})),
+			orientation: 1,
+		},
+		{
+			name: "coordinates with too few parts",
+			data: testJPEG(testTIFF(le,
+				[]testExifEntry{{tag: exifTagGPSIFD, ifd: 1}},
+				[]testExifEntry{
+					{tag: exifTagGPSLatitude, kind: exifTypeRational, count: 2, value: testRationals(le, 40, 1, 26, 1)},
+					{tag: exifTagGPSLongitude, kind: exifTypeRational, count: 3, value: testRationals(le, 79, 1, 58, 0, 5616, 100)},
+				},
+			)),
+			orientation: 1,
+		},
+		{
+			name: "value past the end",
+			data: testJPEG(testTIFF(le, []testExifEntry{
+				{tag: exifTagDateTime, kind: exifTypeASCII, count: 1000, value: []byte{0, 0, 1, 0}},
+			})),
+			orientation: 1,
+		},
+		{
+			name: "directory past the end",
+			data: testJPEG([]byte("II\x2a\x00\x08\x00\x00\x00\xff\x00")),
+			err:  true,
+		},
+		{
+			name: "unknown byte order",
+			data: testJPEG([]byte("XX\x2a\x00\x08\x00\x00\x00\x00\x00")),
+			err:  true,
+		},
+		{
+			name: "EXIF too short",
+			data: testJPEG([]byte("II\x2a\x00")),
+			err:  true,
+		},
+		{
+			name: "segment past the end",
+			data: complete[:40],
+			err:  true,
+		},
+		{
+			name: "not a JPEG",
+			data: []byte("\x89PNG\r\n\x1a\n"),
+			err:  true,
+		},
+		{
+			name: "no EXIF",
+			data: []byte{0xff, 0xd8, 0xff, 0xe0, 0, 4, 0, 0, 0xff, 0xda, 0, 2},
+			err:  true,
+		},
+	}
+	for _, c := range cases {
+		exif, err := parseJPEGExif(c.data)
+		if c.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", c.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: got error %v", c.name, err)
+			continue
+		}
+		if exif.Orientation != c.orientation {
+			t.Errorf("%s: got orientation %d, expected %d", c.name, exif.Orientation, c.orientation)
+		}
+		if (exif.Taken == nil) != (c.taken == nil) || (exif.Taken != nil && !exif.Taken.Equal(*c.taken)) {
+			t.Errorf("%s: got taken %v, expected %v", c.name, exif.Taken, c.taken)
+		}
+		for _, coordinate := range []struct {
+			name          string
+			got, expected *float64
+		}{{"latitude", exif.Latitude, c.latitude}, {"longitude", exif.Longitude, c.longitude}} {
+			if (coordinate.got == nil) != (coordinate.expected == nil) || (coordinate.got != nil && math.Abs(*coordinate.got-*coordinate.expected) > 1e-9) {
+				t.Errorf("%s: got %s %v, expected %v", c.name, coordinate.name, coordinate.got, coordinate.expected)
+			}
+		}
+	}
+}
+
+// Every truncation of a photo's metadata is an error or less metadata, never a panic
+func TestParseJPEGExifTruncated(t *testing.T) {
+	tiff := testExifComplete(binary.LittleEndian)
+	for i := range tiff {
+		exif, err := parseJPEGExif(testJPEG(tiff[:i]))
+		if exif == nil && err == nil {
+			t.Errorf("Truncated to %d bytes: got no metadata and no error", i)
+		}
+	}
+	complete := testJPEG(tiff)
+	for i := range complete {
+		parseJPEGExif(complete[:i])
+	}
+}
+
+func testISOBox(kind string, content ...[]byte) []byte {
+	size := 8
+	for _, c := range content {
+		size += len(c)
+	}
+	box := binary.BigEndian.AppendUint32(nil, uint32(size))
+	box = append(box, kind...)
+	for _, c := range content {
+		box = append(box, c...)
+	}
+	return box
+}
+
+// testHEIC lays out a HEIC with an image item and an Exif item whose content is exif
+func testHEIC(exif []byte) []byte {
+	infe := func(id uint16, kind string) []byte {
+		content := []byte{2, 0, 0, 0}
+		content = binary.BigEndian.AppendUint16(content, id)
+		content = append(content, 0, 0)
+		content = append(content, kind...)
+		return testISOBox("infe", content)
+	}
+	iinf := testISOBox("iinf", []byte{0, 0, 0, 0, 0, 2}, infe(1, "hvc1"), infe(2, "Exif"))
+	ftyp := testISOBox("ftyp", []byte("heic\x00\x00\x00\x00mif1heic"))
+	image := []byte("not really HEVC")
+	// The item locations depend on the size of the meta box, which doesn't depend on their values
+	iloc := func(imageOffset, exifOffset int) []byte {
+		content := []byte{0, 0, 0, 0, 0x44, 0x00, 0, 2}
+		for _, item := range []struct{ id, offset, length int }{{1, imageOffset, len(image)}, {2, exifOffset, len(exif)}} {
+			content = binary.BigEndian.AppendUint16(content, uint16(item.id))
+			content = append(content, 0, 0, 0, 1)
+			content = binary.BigEndian.AppendUint32(content, uint32(item.offset))
+			content = binary.BigEndian.AppendUint32(content, uint32(item.length))
+		}
+		return testISOBox("iloc", content)
+	}
+	meta := testISOBox("meta", []byte{0, 0, 0, 0}, iinf, iloc(0, 0))
+	start := len(ftyp) + len(meta) + 8
+	meta = testISOBox("meta", []byte{0, 0, 0, 0}, iinf, iloc(start, start+len(image)))
+	return append(append(ftyp, meta...), testISOBox("mdat", image, exif)...)
+}
+
+func TestParseHEICExif(t *testing.T) {
+	tiff := testExifComplete(binary.BigEndian)
+	// Apple puts the JPEG APP1 header before the TIFF header
+	item := append([]byte{0, 0, 0, 6}, "Exif\x00\x00"...)
+	item = append(item, tiff...)
+	heic := testHEIC(item)
+	if sniffImage(heic) != "image/heic" {
+		t.Fatalf("Test HEIC sniffed as %s", sniffImage(heic))
+	}
+	exif, err := parseHEICExif(heic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	taken := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	if exif.Orientation != 6 || exif.Taken == nil || !exif.Taken.Equal(taken) || exif.Latitude == nil || exif.Longitude == nil {
+		t.Errorf("Got %+v", exif)
+	}
+
+	// Without a TIFF header offset
+	if _, err := parseHEICExif(testHEIC(append([]byte{0, 0, 0, 0}, tiff...))); err != nil {
+		t.Errorf("Got %v without an offset", err)
+	}
+	if _, err := parseHEICExif(testHEIC([]byte{0, 0, 1, 0})); err == nil {
+		t.Errorf("Expected an error for an offset past the item")
+	}
+	if _, err := parseHEICExif(testISOBox("ftyp", []byte("heic"))); err != errNoExif {
+		t.Errorf("Got %v without a meta box", err)
+	}
+	for i := range heic {
+		parseHEICExif(heic[:i])
+	}
+}
@@ -0,0 +1,131 @@
+package fssync
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+
+	"github.com/Gleipnir-Technology/fieldseeker-sync/database"
+)
+
+// How many rows of a layer are read at a time while exporting it
+const exportPageSize = 1000
+
+// ExportFormat is a kind of file layers can be exported as
+type ExportFormat struct {
+	ContentType string
+	// Extension is used in file names and in the /export/{layer}.{extension} route
+	Extension string
+	newWriter func(w io.Writer, name string) (exportWriter, error)
+}
+
+// ExportFormats lists every format layers can be exported as
+var ExportFormats = []ExportFormat{
+	{
+		ContentType: "text/csv; charset=utf-8",
+		Extension:   "csv",
+		newWriter:   newCSVExport,
+	},
+	{
+		ContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		Extension:   "xlsx",
+		newWriter:   newXLSXExport,
+	},
+}
+
+// exportWriter writes rows of values that are nil, string, int64, float64, bool or time.Time
+type exportWriter interface {
+	Write(values []any) error
+	Close() error
+}
+
+func ExportFormatByExtension(extension string) (*ExportFormat, error) {
+	for _, format := range ExportFormats {
+		if format.Extension == extension {
+			return &format, nil
+		}
+	}
+	return nil, fmt.Errorf("No export format with extension %s", extension)
+}
+
+// ExportLayer writes the rows of a layer that match the query, a page at a time so the whole
+// layer is never in memory. The query's cursor and limit are ignored. Nil columns exports all of
+// them. Dates are in local time and coded values are replaced with their names.
+func ExportLayer(ctx context.Context, w io.Writer, format *ExportFormat, name string, columns []string, q database.LayerQuery) error {
+	layer, ok := database.Layers[name]
+	if !ok {
+		return fmt.Errorf("No such layer %s", name)
+	}
+	if columns == nil {
+		columns = layer.Columns
+	}
+	fields, err := layer.Fields(ctx)
+	if err != nil {
+		return err
+	}
+	out, err := format.newWriter(w, name)
+	if err != nil {
+		return fmt.Errorf("Failed to start export: %v", err)
+	}
+	header := make([]any, 0, len(columns))
+	for _, column := range columns {
+		header = append(header, column)
+	}
+	if err := out.Write(header); err != nil {
+		return fmt.Errorf("Failed to write header: %v", err)
+	}
+
+	q.After = nil
+	q.Limit = exportPageSize
+	values := make([]any, len(columns))
+	for {
+		rows, next, err := layer.List(ctx, q)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			for i, column := range columns {
+				values[i], err = database.FieldValue(column, row[column], fields)
+				if err != nil {
+					return err
+				}
+			}
+			if err := out.Write(values); err != nil {
+				return fmt.Errorf("Failed to write row: %v", err)
+			}
+		}
+		if next == nil {
+			break
+		}
+		q.After = next
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("Failed to finish export: %v", err)
+	}
+	return nil
+}
+
+type csvExport struct {
+	record []string
+	writer *csv.Writer
+}
+
+func newCSVExport(w io.Writer, name string) (exportWriter, error) {
+	return &csvExport{
+		writer: csv.NewWriter(w),
+	}, nil
+}
+
+func (e *csvExport) Write(values []any) error {
+	e.record = e.record[:0]
+	for _, value := range values {
+		e.record = append(e.record, database.FieldText(value))
+	}
+	return e.writer.Write(e.record)
+}
+
+func (e *csvExport) Close() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
@@ -7,6 +7,8 @@ toolchain go1.24.3
 require github.com/Gleipnir-Technology/arcgis-go v0.0.2 // explicit
 
 require (
+	github.com/Gleipnir-Technology/fieldseeker-sync/label-studio v0.0.0-00010101000000-000000000000
+	github.com/Gleipnir-Technology/fieldseeker-sync/minio v0.0.0-00010101000000-000000000000
 	github.com/Gleipnir-Technology/fieldseeker-sync/shared v0.0.0
 	github.com/aarondl/opt v0.0.0-20250607033636-982744e1bd65
 	github.com/alexedwards/scs/pgxstore v0.0.0-20250417082927-ab20b3feb5e9
@@ -21,6 +23,7 @@ require (
 	github.com/google/uuid v1.6.0
 	github.com/jackc/pgx/v5 v5.7.5
 	github.com/jaswdr/faker/v2 v2.8.0
+	github.com/klauspost/compress v1.18.0
 	github.com/lib/pq v1.10.9
 	github.com/pressly/goose/v3 v3.24.3
 	github.com/shopspring/decimal v1.4.0
@@ -30,8 +33,6 @@ require (
 )
 
 require (
-	github.com/Gleipnir-Technology/fieldseeker-sync/label-studio v0.0.0-00010101000000-000000000000 // indirect
-	github.com/Gleipnir-Technology/fieldseeker-sync/minio v0.0.0-00010101000000-000000000000 // indirect
 	github.com/MakeNowJust/heredoc v1.0.0 // indirect
 	github.com/ajg/form v1.5.1 // indirect
 	github.com/alessio/shellescape v1.4.1 // indirect
@@ -60,7 +61,6 @@ require (
 	github.com/jackc/puddle/v2 v2.2.2 // indirect
 	github.com/kaptinlin/go-i18n v0.1.3 // indirect
 	github.com/kaptinlin/jsonschema v0.2.3 // indirect
-	github.com/klauspost/compress v1.18.0 // indirect
 	github.com/klauspost/cpuid/v2 v2.2.11 // indirect
 	github.com/knadh/koanf/maps v0.1.2 // indirect
 	github.com/knadh/koanf/parsers/json v1.0.0 // indirect
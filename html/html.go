@@ -18,7 +18,11 @@ import (
 var embeddedFiles embed.FS
 var (
 	index           = newBuiltTemplate("index", "base")
+	jobs            = newBuiltTemplate("jobs", "base")
+	layerRow        = newBuiltTemplate("layer-row", "base")
 	login           = newBuiltTemplate("login", "base")
+	mapPage         = newBuiltTemplate("map", "base")
+	note            = newBuiltTemplate("note", "base")
 	processAudio    = newBuiltTemplate("process-audio", "base")
 	processAudioId  = newBuiltTemplate("process-audio-id", "base")
 	serviceRequests = newBuiltTemplate("service-requests", "base")
@@ -48,6 +52,14 @@ func Index(w io.Writer, d ContentIndex) error {
 	return index.ExecuteTemplate(w, d)
 }
 
+func Jobs(w io.Writer, d ContentJobs) error {
+	return jobs.ExecuteTemplate(w, d)
+}
+
+func LayerRow(w io.Writer, d ContentLayerRow) error {
+	return layerRow.ExecuteTemplate(w, d)
+}
+
 func Login(w io.Writer, next string) error {
 	d := ContentLogin{
 		Next:  next,
@@ -57,6 +69,14 @@ func Login(w io.Writer, next string) error {
 	return login.ExecuteTemplate(w, d)
 }
 
+func Map(w io.Writer, d ContentMap) error {
+	return mapPage.ExecuteTemplate(w, d)
+}
+
+func Note(w io.Writer, d ContentNote) error {
+	return note.ExecuteTemplate(w, d)
+}
+
 func ProcessAudio(w io.Writer, d ContentProcessAudio) error {
 	return processAudio.ExecuteTemplate(w, d)
 }
@@ -69,6 +89,20 @@ func ServiceRequests(w io.Writer, sr ContentServiceRequests) error {
 	return serviceRequests.ExecuteTemplate(w, sr)
 }
 
+// clock formats seconds into the audio as minutes:seconds
+func clock(seconds float32) string {
+	s := int(seconds)
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
+
+// coordinates formats a location as latitude, longitude or is empty if there isn't one
+func coordinates(latitude *float64, longitude *float64) string {
+	if latitude == nil || longitude == nil {
+		return ""
+	}
+	return fmt.Sprintf("%.6f, %.6f", *latitude, *longitude)
+}
+
 func geocode(geo shared.LatLong) string {
 	return "foo"
 }
@@ -100,7 +134,11 @@ func newBuiltTemplate(files ...string) BuiltTemplate {
 
 func makeFuncMap() template.FuncMap {
 	funcMap := template.FuncMap{
+		"clock":       clock,
+		"coordinates": coordinates,
 		"geocode":     geocode,
+		"percent":     percent,
+		"seconds":     seconds,
 		"timeElapsed": timeElapsed,
 		"timeSince":   timeSince,
 	}
@@ -159,6 +197,20 @@ func timeElapsed(seconds null.Val[float32]) string {
 	}
 }
 
+func percent(f *float32) string {
+	if f == nil {
+		return ""
+	}
+	return fmt.Sprintf("%.0f%%", *f*100)
+}
+
+func seconds(f *float32) string {
+	if f == nil {
+		return "none"
+	}
+	return fmt.Sprintf("%.1f seconds", *f)
+}
+
 func timeSince(t time.Time) string {
 	now := time.Now()
 	diff := now.Sub(t)
@@ -1,6 +1,7 @@
 package html
 
 import (
+	"github.com/Gleipnir-Technology/fieldseeker-sync/database"
 	"github.com/Gleipnir-Technology/fieldseeker-sync/database/models"
 	"github.com/Gleipnir-Technology/fieldseeker-sync/database/sql"
 	"github.com/Gleipnir-Technology/fieldseeker-sync/shared"
@@ -12,12 +13,46 @@ type ContentIndex struct {
 	User                *shared.User
 }
 
+type ContentJobs struct {
+	Jobs []*database.Job
+	User *shared.User
+}
+
+type ContentLayerRow struct {
+	Fields []database.LayerRowField
+	Layer  string
+	User   *shared.User
+}
+
 type ContentLogin struct {
 	Next  string
 	Title string
 	User  *shared.User
 }
 
+type ContentMap struct {
+	// URLs of the audio have {uuid} in place of the audio note's UUID
+	AudioSources []AudioSource
+	// Where the map starts, nil if there's nothing on it yet
+	Extent *shared.Bounds
+	User   *shared.User
+}
+
+type ContentNote struct {
+	Audio []NoteAudioPlayer
+	// Who wrote the note, nil if we don't know
+	Creator *shared.User
+	Images  []*database.NoteImage
+	Note    *database.Note
+	User    *shared.User
+}
+
+// NoteAudioPlayer is audio attached to a note along with the forms it can be played in
+type NoteAudioPlayer struct {
+	*database.NoteAudioAttachment
+	Sources []AudioSource
+}
+
 type ContentProcessAudio struct {
 	Rows      []sql.TaskAudioReviewOutstandingRow
 	SortField string
@@ -26,14 +61,30 @@ type ContentProcessAudio struct {
 	User      *shared.User
 }
 
+// AudioSource is one of the forms the audio player can load a note's audio in
+type AudioSource struct {
+	ContentType  string
+	LowBandwidth bool
+	URL          string
+}
+
 type ContentProcessAudioId struct {
-	NoteAudio *models.NoteAudio
-	Task      *models.TaskAudioReview
-	UsersById map[int]*shared.User
-	User      *shared.User
+	AudioFileProbes []*database.AudioFileProbe
+	AudioSources    []AudioSource
+	Images          []*database.NoteImage
+	NoteAudio       *models.NoteAudio
+	// The note the audio is attached to, nil if it isn't attached to one
+	NoteUUID            *string
+	Segments            []*database.NoteAudioSegment
+	Task                *models.TaskAudioReview
+	TranscriptionSource *database.NoteAudioTranscriptionSource
+	UsersById           map[int]*shared.User
+	User                *shared.User
 }
 
 type ContentServiceRequests struct {
+	// The next page of service requests, empty on the last page
+	NextURL         string
 	ServiceRequests []shared.ServiceRequest
 	User            *shared.User
 }
@@ -0,0 +1,345 @@
+package fssync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/Gleipnir-Technology/fieldseeker-sync/database"
+	"github.com/google/uuid"
+)
+
+// ImageJob represents a job to process an uploaded photo
+type ImageJob struct {
+	ImageUUID uuid.UUID
+	// Force regenerates files that are already up to date
+	Force bool
+}
+
+// ImageFormat is a format we produce derivatives in
+type ImageFormat struct {
+	// Args are the ffmpeg encoder options
+	Args        []string
+	ContentType string
+	Extension   string
+}
+
+// ImageSize is a size we produce derivatives at
+type ImageSize struct {
+	// MaxDimension is the most pixels the width or height can be. Smaller images aren't enlarged.
+	MaxDimension int
+	// Name is used in file names and in the /image/{uuid}/{size} route
+	Name string
+}
+
+// ImageFormats are in the order we prefer to serve them
+var ImageFormats = []ImageFormat{
+	{
+		Args:        []string{"-c:v", "libwebp", "-quality", "80"},
+		ContentType: "image/webp",
+		Extension:   "webp",
+	},
+	{
+		Args:        []string{"-q:v", "3"},
+		ContentType: "image/jpeg",
+		Extension:   "jpg",
+	},
+}
+
+var ImageSizes = []ImageSize{
+	{MaxDimension: 320, Name: "thumbnail"},
+	{MaxDimension: 1600, Name: "web"},
+}
+
+// How much of a file we need to look at to tell what type of image it is
+const imageSniffLength = 512
+
+// The image types we accept. Anything else is flagged as not being an image.
+var imageContentTypes = []string{"image/gif", "image/heic", "image/jpeg", "image/png", "image/webp"}
+
+// The ffmpeg filters that display an image upright for each EXIF orientation. We apply these
+// ourselves since derivatives don't keep the orientation tag.
+var exifOrientationFilters = map[int]string{
+	2: "hflip",
+	3: "hflip,vflip",
+	4: "vflip",
+	5: "transpose=0",
+	6: "transpose=1",
+	7: "transpose=3",
+	8: "transpose=2",
+}
+
+// StartImageWorker starts the pool of worker goroutines that process image jobs from the job table.
+func StartImageWorker(ctx context.Context) {
+	startJobWorker(ctx, database.JobKindImage, config.Images.Workers, config.Images.JobTimeout, func(ctx context.Context, job *database.Job) error {
+		imageUUID, err := uuid.Parse(job.UUID)
+		if err != nil {
+			return fmt.Errorf("Failed to parse image UUID '%s': %v", job.UUID, err)
+		}
+		return processImageFile(ctx, imageUUID, job.Force)
+	})
+}
+
+// EnqueueImageJob saves an image processing job and wakes the worker.
+func EnqueueImageJob(job ImageJob) error {
+	err := enqueueJob(database.JobKindImage, job.ImageUUID.String(), job.Force)
+	if err != nil {
+		return fmt.Errorf("Failed to enqueue image job for %s: %v", job.ImageUUID, err)
+	}
+	return nil
+}
+
+// ImageSizeByName finds the size served at /image/{uuid}/{size}
+func ImageSizeByName(name string) (*ImageSize, error) {
+	for i := range ImageSizes {
+		if ImageSizes[i].Name == name {
+			return &ImageSizes[i], nil
+		}
+	}
+	return nil, fmt.Errorf("No image size '%s'", name)
+}
+
+// ImageFormatByContentType is the format we serve as a content type, nil if there's none
+func ImageFormatByContentType(contentType string) *ImageFormat {
+	for i := range ImageFormats {
+		if ImageFormats[i].ContentType == contentType {
+			return &ImageFormats[i]
+		}
+	}
+	return nil
+}
+
+// ImageFileContentKeyDerivative is the key of a resized copy of an image
+func ImageFileContentKeyDerivative(imageUUID string, size *ImageSize, format *ImageFormat) string {
+	return fmt.Sprintf("%s-%s.%s", imageUUID, size.Name, format.Extension)
+}
+
+// ImageVariant names a derivative in the image_file table
+func ImageVariant(size *ImageSize, format *ImageFormat) string {
+	return fmt.Sprintf("%s.%s", size.Name, format.Extension)
+}
+
+// ImageDerivativesMissing lists the resized copies of an image that don't exist or are older
+// than the upload. Images without an upload, or whose upload isn't a usable image, have nothing
+// missing since there's nothing to produce the copies from.
+func ImageDerivativesMissing(ctx context.Context, stat StatFunc, imageUUID string) ([]string, error) {
+	missing := make([]string, 0)
+	raw := ImageFileContentKeyRaw(imageUUID)
+	if stat(raw) == nil {
+		return missing, nil
+	}
+	files, err := database.ImageFileList(ctx, imageUUID)
+	if err != nil {
+		return missing, err
+	}
+	for _, file := range files {
+		if file.Variant == "original" && file.Problem != nil {
+			return missing, nil
+		}
+	}
+	for i := range ImageSizes {
+		for j := range ImageFormats {
+			key := ImageFileContentKeyDerivative(imageUUID, &ImageSizes[i], &ImageFormats[j])
+			if !isUpToDateIn(stat, key, raw) {
+				missing = append(missing, key)
+			}
+		}
+	}
+	return missing, nil
+}
+
+// processImageFile checks the upload is an image, saves its EXIF metadata and produces the
+// resized copies we serve. Derivatives are re-encoded without any metadata so they don't
+// reveal where the photo was taken. Uploads that aren't images are flagged and not retried.
+func processImageFile(ctx context.Context, imageUUID uuid.UUID, force bool) error {
+	source := ImageFileContentKeyRaw(imageUUID.String())
+	info, err := userFiles.Stat(ctx, source)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("%s doesn't exist, skipping image processing", source)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	file, err := userFiles.Get(ctx, source)
+	if err != nil {
+		return err
+	}
+	content, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		return fmt.Errorf("Failed to read %s: %w", source, err)
+	}
+
+	original := &database.ImageFile{
+		NoteImageUUID: imageUUID.String(),
+		Processed:     time.Now(),
+		Size:          info.Size,
+		Variant:       "original",
+	}
+	contentType := sniffImage(content)
+	if contentType == "" {
+		log.Printf("%s is not an image", source)
+		problem := database.ImageFileProblemNotAnImage
+		original.Problem = &problem
+		return database.ImageFileSave(ctx, original)
+	}
+	original.ContentType = &contentType
+
+	ws, err := newWorkspace()
+	if err != nil {
+		return err
+	}
+	defer ws.Close()
+	input, err := ws.Fetch(ctx, source)
+	if err != nil {
+		return err
+	}
+	err = probeImage(ctx, input, original)
+	if ctx.Err() != nil {
+		return err
+	} else if err != nil {
+		log.Printf("%s is corrupt: %v", source, err)
+		problem := database.ImageFileProblemCorrupt
+		original.Problem = &problem
+		return database.ImageFileSave(ctx, original)
+	}
+	err = database.ImageFileSave(ctx, original)
+	if err != nil {
+		return err
+	}
+
+	orientation := 1
+	var exif *Exif
+	switch contentType {
+	case "image/heic":
+		exif, err = parseHEICExif(content)
+	case "image/jpeg":
+		exif, err = parseJPEGExif(content)
+	default:
+		err = errNoExif
+	}
+	if err == nil {
+		orientation = exif.Orientation
+		err = database.ImageExifSave(ctx, &database.ImageExif{
+			Latitude:      exif.Latitude,
+			Longitude:     exif.Longitude,
+			NoteImageUUID: imageUUID.String(),
+			Orientation:   exif.Orientation,
+			Taken:         exif.Taken,
+		})
+		if err != nil {
+			return err
+		}
+	} else if !errors.Is(err, errNoExif) {
+		log.Printf("Failed to read EXIF from %s: %v", source, err)
+	}
+
+	for i := range ImageSizes {
+		for j := range ImageFormats {
+			err = resizeImage(ctx, ws, imageUUID, input, orientation, &ImageSizes[i], &ImageFormats[j], force)
+			if err != nil {
+				return fmt.Errorf("failed to make %s %s of image %s: %w", ImageSizes[i].Name, ImageFormats[j].Extension, imageUUID, err)
+			}
+		}
+	}
+	log.Printf("Processed image %s", imageUUID)
+	return nil
+}
+
+// resizeImage produces one derivative of the original image and records its dimensions
+func resizeImage(ctx context.Context, ws *workspace, imageUUID uuid.UUID, input string, orientation int, size *ImageSize, format *ImageFormat, force bool) error {
+	source := ImageFileContentKeyRaw(imageUUID.String())
+	destination := ImageFileContentKeyDerivative(imageUUID.String(), size, format)
+	if !force && isUpToDate(ctx, destination, source) {
+		log.Printf("%s is up to date, skipping resizing", destination)
+		return nil
+	}
+	filter := fmt.Sprintf("scale='min(iw,%d)':'min(ih,%d)':force_original_aspect_ratio=decrease", size.MaxDimension, size.MaxDimension)
+	if rotate, ok := exifOrientationFilters[orientation]; ok {
+		filter = rotate + "," + filter
+	}
+	args := []string{"-y", "-noautorotate", "-i", input, "-vf", filter, "-frames:v", "1", "-update", "1", "-map_metadata", "-1"}
+	args = append(args, format.Args...)
+	output := ws.Path(destination)
+	args = append(args, output)
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		log.Printf("FFmpeg output for resizing: %s", out)
+		return &commandError{fmt.Errorf("ffmpeg resizing failed: %v", err), out}
+	}
+	err = ws.Save(ctx, destination)
+	if err != nil {
+		return err
+	}
+
+	derivative := &database.ImageFile{
+		ContentType:   &format.ContentType,
+		NoteImageUUID: imageUUID.String(),
+		Processed:     time.Now(),
+		Variant:       ImageVariant(size, format),
+	}
+	stat, err := os.Stat(output)
+	if err != nil {
+		return fmt.Errorf("Failed to stat %s: %v", output, err)
+	}
+	derivative.Size = stat.Size()
+	if err := probeImage(ctx, output, derivative); err != nil {
+		return err
+	}
+	return database.ImageFileSave(ctx, derivative)
+}
+
+// probeImage sets the dimensions of an image file using ffprobe
+func probeImage(ctx context.Context, path string, file *database.ImageFile) error {
+	cmd := exec.CommandContext(ctx, "ffprobe", "-v", "error", "-select_streams", "v:0", "-show_entries", "stream=width,height", "-print_format", "json", path)
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return &commandError{fmt.Errorf("ffprobe failed: %v", err), exitErr.Stderr}
+		}
+		return fmt.Errorf("ffprobe failed: %v", err)
+	}
+	var output struct {
+		Streams []struct {
+			Height int `json:"height"`
+			Width  int `json:"width"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(out, &output); err != nil {
+		return fmt.Errorf("Failed to parse ffprobe output: %v", err)
+	}
+	if len(output.Streams) == 0 || output.Streams[0].Width == 0 || output.Streams[0].Height == 0 {
+		return errors.New("no image stream")
+	}
+	file.Height = &output.Streams[0].Height
+	file.Width = &output.Streams[0].Width
+	return nil
+}
+
+// sniffImage finds the type of an image from its content. Returns an empty string if the
+// content isn't a type of image we accept.
+func sniffImage(content []byte) string {
+	// iPhones save photos as HEIC, which is an ISO media file like MP4
+	if len(content) >= 12 && string(content[4:8]) == "ftyp" {
+		switch string(content[8:12]) {
+		case "heic", "heix", "heim", "heis", "mif1", "msf1":
+			return "image/heic"
+		}
+	}
+	contentType := http.DetectContentType(content)
+	for _, t := range imageContentTypes {
+		if contentType == t {
+			return contentType
+		}
+	}
+	return ""
+}
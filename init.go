@@ -16,6 +16,11 @@ func ensureConfig() error {
 	if len(config.Database.URL) == 0 {
 		return errors.New("You must specify a database URL")
 	}
+	storage, err := NewStorage(config)
+	if err != nil {
+		return fmt.Errorf("Failed to create user file storage: %v", err)
+	}
+	userFiles = storage
 	return nil
 }
 
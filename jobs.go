@@ -0,0 +1,219 @@
+package fssync
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/Gleipnir-Technology/fieldseeker-sync/database"
+	"github.com/Gleipnir-Technology/fieldseeker-sync/label-studio"
+)
+
+// jobPollInterval is how often a worker checks the job table when it hasn't been woken up.
+const jobPollInterval = 30 * time.Second
+
+// jobHandler does the work for a single job. Returning an error causes the job to be retried.
+type jobHandler func(ctx context.Context, job *database.Job) error
+
+// jobWorker processes every job of a single kind from the job table using a pool of goroutines.
+type jobWorker struct {
+	handler jobHandler
+	kind    database.JobKind
+	timeout time.Duration
+	wake    chan struct{}
+}
+
+var (
+	jobWorkers     = make(map[database.JobKind]*jobWorker)
+	jobWorkersLock sync.Mutex
+	jobWorkersWait sync.WaitGroup
+)
+
+// jobMetrics are published at /debug/vars, keyed by "<kind>.<metric>"
+var jobMetrics = expvar.NewMap("jobs")
+
+func init() {
+	expvar.Publish("job_queue_depth", expvar.Func(func() any {
+		depth, err := database.JobQueueDepth(context.Background())
+		if err != nil {
+			return err.Error()
+		}
+		return depth
+	}))
+}
+
+// commandError captures the output of an external command that failed so it can be saved with the job.
+type commandError struct {
+	err    error
+	output []byte
+}
+
+func (e *commandError) Error() string {
+	return e.err.Error()
+}
+
+func (e *commandError) Unwrap() error {
+	return e.err
+}
+
+// startJobWorker starts a pool of goroutines that process jobs of the given kind until the context
+// is cancelled. Each job gets its own context that is cancelled after the timeout.
+func startJobWorker(ctx context.Context, kind database.JobKind, workers int, timeout time.Duration, handler jobHandler) {
+	worker := &jobWorker{
+		handler: handler,
+		kind:    kind,
+		timeout: timeout,
+		wake:    make(chan struct{}, workers),
+	}
+	jobWorkersLock.Lock()
+	jobWorkers[kind] = worker
+	jobWorkersLock.Unlock()
+
+	requeued, err := database.JobRequeueInterrupted(ctx, kind)
+	if err != nil {
+		log.Printf("Failed to requeue interrupted %s jobs: %v", kind, err)
+	} else if requeued > 0 {
+		log.Printf("Requeued %d interrupted %s jobs", requeued, kind)
+	}
+	log.Printf("Started %d %s workers polling every %s with a %s timeout", workers, kind, jobPollInterval, timeout)
+	for i := 0; i < workers; i++ {
+		jobWorkersWait.Add(1)
+		go func() {
+			defer jobWorkersWait.Done()
+			ticker := time.NewTicker(jobPollInterval)
+			defer ticker.Stop()
+			for {
+				worker.processJobs(ctx)
+				select {
+				case <-ctx.Done():
+					log.Printf("%s worker %d shutting down.", kind, i)
+					return
+				case <-worker.wake:
+				case <-ticker.C:
+				}
+			}
+		}()
+	}
+}
+
+// WaitForJobWorkers blocks until every job worker has stopped after its context was cancelled.
+func WaitForJobWorkers() {
+	jobWorkersWait.Wait()
+}
+
+// enqueueJob saves a job and wakes the worker for its kind, if there is one in this process.
+// Workers in other processes pick the job up the next time they poll.
+func enqueueJob(kind database.JobKind, uuid string, force bool) error {
+	err := database.JobEnqueue(context.Background(), kind, uuid, force)
+	if err != nil {
+		return err
+	}
+	log.Printf("Enqueued %s job for UUID: %s", kind, uuid)
+	wakeJobWorker(kind)
+	return nil
+}
+
+// RequeueJob puts a failed job back in the queue to run immediately.
+func RequeueJob(ctx context.Context, id int) error {
+	job, err := database.JobRequeue(ctx, id)
+	if err != nil {
+		return err
+	}
+	log.Printf("Requeued %s job %d for UUID: %s", job.Kind, job.ID, job.UUID)
+	wakeJobWorker(job.Kind)
+	return nil
+}
+
+func wakeJobWorker(kind database.JobKind) {
+	jobWorkersLock.Lock()
+	worker, ok := jobWorkers[kind]
+	jobWorkersLock.Unlock()
+	if !ok {
+		return
+	}
+	select {
+	case worker.wake <- struct{}{}:
+	default:
+		// The worker already has a pending wake up
+	}
+}
+
+// jobOutput extracts any captured command output or HTTP response from a job error.
+func jobOutput(err error) string {
+	var cmdErr *commandError
+	if errors.As(err, &cmdErr) {
+		return string(cmdErr.output)
+	}
+	var apiErr *labelstudio.APIError
+	if errors.As(err, &apiErr) {
+		return fmt.Sprintf("HTTP %d\n%s", apiErr.StatusCode, apiErr.Body)
+	}
+	return ""
+}
+
+// runJob calls the handler for a job. A panic fails the job with the stack as its output
+// rather than taking down the whole process.
+func (w *jobWorker) runJob(ctx context.Context, job *database.Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &commandError{fmt.Errorf("panic: %v", r), debug.Stack()}
+		}
+	}()
+	return w.handler(ctx, job)
+}
+
+// processJobs works through every job that is ready to run
+func (w *jobWorker) processJobs(ctx context.Context) {
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+		job, err := database.JobClaim(ctx, w.kind)
+		if err != nil {
+			log.Printf("Failed to claim %s job: %v", w.kind, err)
+			return
+		}
+		if job == nil {
+			return
+		}
+		log.Printf("Processing %s job %d (attempt %d) for UUID: %s", w.kind, job.ID, job.Attempts, job.UUID)
+		start := time.Now()
+		jobCtx, cancel := context.WithTimeout(ctx, w.timeout)
+		err = w.runJob(jobCtx, job)
+		cancel()
+		elapsed := time.Since(start)
+		jobMetrics.AddFloat(string(w.kind)+".processing_seconds_total", elapsed.Seconds())
+		last := new(expvar.Float)
+		last.Set(elapsed.Seconds())
+		jobMetrics.Set(string(w.kind)+".processing_seconds_last", last)
+		if ctx.Err() != nil {
+			// We're shutting down, the job will be requeued when we start again
+			log.Printf("%s job %d for %s interrupted by shutdown", w.kind, job.ID, job.UUID)
+			return
+		}
+		if err == nil {
+			jobMetrics.Add(string(w.kind)+".completed", 1)
+			log.Printf("Completed %s job %d for %s in %s", w.kind, job.ID, job.UUID, elapsed)
+			if err := database.JobComplete(ctx, job.ID); err != nil {
+				log.Printf("Failed to mark %s job %d as complete: %v", w.kind, job.ID, err)
+			}
+			continue
+		}
+		jobMetrics.Add(string(w.kind)+".failed", 1)
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("timed out after %s: %w", w.timeout, err)
+		}
+		log.Printf("Error processing %s job %d for %s: %v", w.kind, job.ID, job.UUID, err)
+		state, err := database.JobFail(ctx, job, config.Jobs.MaxAttempts, err.Error(), jobOutput(err))
+		if err != nil {
+			log.Printf("Failed to record failure of %s job %d: %v", w.kind, job.ID, err)
+		} else if state == database.JobStateDead {
+			log.Printf("%s job %d for %s failed %d times, giving up", w.kind, job.ID, job.UUID, job.Attempts)
+		}
+	}
+}
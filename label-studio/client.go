@@ -18,6 +18,21 @@ type Client struct {
 	HTTPClient  *http.Client
 }
 
+// APIError is returned when Label Studio responds with an error status
+type APIError struct {
+	Body       string
+	StatusCode int
+}
+
+func (e *APIError) Error() string {
+	// Try to read error message
+	var errorResp map[string]interface{}
+	if err := json.Unmarshal([]byte(e.Body), &errorResp); err == nil {
+		return fmt.Sprintf("API returned JSON error %d: %v", e.StatusCode, errorResp)
+	}
+	return fmt.Sprintf("API returned error status %d: %s", e.StatusCode, e.Body)
+}
+
 // NewClient creates a new Label Studio client
 func NewClient(baseURL string, apiKey string) *Client {
 	return &Client{
@@ -115,13 +130,10 @@ func (c *Client) makeRequest(method string, path string, payload []byte) (*http.
 		if err != nil {
 			return nil, fmt.Errorf("Got status code %d and failed to read response body: %v", resp.StatusCode, err)
 		}
-		bodyString := string(bodyBytes)
-		// Try to read error message
-		var errorResp map[string]interface{}
-		if err := json.Unmarshal(bodyBytes, &errorResp); err == nil {
-			return nil, fmt.Errorf("API returned JSON error %d: %v", resp.StatusCode, errorResp)
+		return nil, &APIError{
+			Body:       string(bodyBytes),
+			StatusCode: resp.StatusCode,
 		}
-		return nil, fmt.Errorf("API returned error status %d: %s: ", resp.Status, bodyString)
 	}
 
 
@@ -60,7 +60,7 @@ func (c *Client) ImportTasks(projectID int, tasks interface{}) (*TaskImportRespo
 	path := fmt.Sprintf("/api/projects/%d/import", projectID)
 	resp, err := c.makeRequest("POST", path, taskJSON)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to POST %s: %v", path, err)
+		return nil, fmt.Errorf("Failed to POST %s: %w", path, err)
 	}
 	defer resp.Body.Close()
 
@@ -129,7 +129,7 @@ func (c *Client) ListTasks(options *TasksListOptions) (*TasksListResponse, error
 	// Create request
 	resp, err := c.makeRequest("GET", path, nil)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to request %s: %v", path, err)
+		return nil, fmt.Errorf("Failed to request %s: %w", path, err)
 	}
 	defer resp.Body.Close()
 
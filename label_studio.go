@@ -19,18 +19,17 @@ type LabelStudioJob struct {
 	UUID uuid.UUID
 }
 
-var labelJobChannel chan LabelStudioJob
-
-func EnqueueLabelStudioJob(job LabelStudioJob) {
-	select {
-	case labelJobChannel <- job:
-		log.Printf("Enqueued label job for UUID: %s", job.UUID)
-	default:
-		log.Printf("Label job channel is full, dropping job for UUID: %s", job.UUID)
+// EnqueueLabelStudioJob saves a job to create a Label Studio task and wakes the worker.
+func EnqueueLabelStudioJob(job LabelStudioJob) error {
+	err := enqueueJob(database.JobKindLabelStudio, job.UUID.String(), false)
+	if err != nil {
+		return fmt.Errorf("Failed to enqueue label job for %s: %v", job.UUID, err)
 	}
+	return nil
 }
 
 func StartLabelStudioWorker(ctx context.Context) error {
+	config := ReadConfig()
 	// Initialize the minio client
 	minioBucket := os.Getenv("S3_BUCKET")
 
@@ -47,33 +46,18 @@ func StartLabelStudioWorker(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("Failed to create minio client: %v", err)
 	}
-	buffer := 100
-	labelJobChannel = make(chan LabelStudioJob, buffer) // Buffered channel to prevent blocking
-	log.Printf("Started label studio worker with buffer depth %d", buffer)
-	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				log.Println("Audio worker shutting down.")
-				return
-			case job := <-labelJobChannel:
-				log.Printf("Processing label job for UUID: %s", job.UUID)
-				err := processLabelTask(ctx, minioClient, minioBucket, labelStudioClient, project, job)
-				if err != nil {
-					log.Printf("Error processing label job for audio file %s: %v", job.UUID, err)
-				}
-			}
+	startJobWorker(ctx, database.JobKindLabelStudio, 1, config.LabelStudio.JobTimeout, func(ctx context.Context, job *database.Job) error {
+		noteUUID, err := uuid.Parse(job.UUID)
+		if err != nil {
+			return fmt.Errorf("Failed to parse note UUID '%s': %v", job.UUID, err)
 		}
-	}()
+		return processLabelTask(ctx, minioClient, minioBucket, labelStudioClient, project, LabelStudioJob{UUID: noteUUID})
+	})
 	return nil
 }
 
 func createMinioClient() (*minio.Client, error) {
-	baseUrl := os.Getenv("S3_BASE_URL")
-	accessKeyID := os.Getenv("S3_ACCESS_KEY_ID")
-	secretAccessKey := os.Getenv("S3_SECRET_ACCESS_KEY")
-
-	client, err := minio.NewClient(baseUrl, accessKeyID, secretAccessKey)
+	client, err := minio.NewClient(config.S3.BaseURL, config.S3.AccessKeyID, config.S3.SecretAccessKey)
 	if err != nil {
 		return nil, err
 	}
@@ -105,36 +89,45 @@ func processLabelTask(ctx context.Context, minioClient *minio.Client, minioBucke
 	}
 	note, err := database.NoteAudioGetLatest(ctx, job.UUID.String())
 	if err != nil {
-		return errors.New(fmt.Sprintf("Failed to get note %s", note.UUID))
+		return fmt.Errorf("Failed to get note %s: %v", job.UUID, err)
 	}
 
-	if note.Version != 1 {
-		return errors.New(fmt.Sprintf("Got version %d of %s", note.Version, note.UUID))
+	// The latest version may be a machine transcription, which is sent as the draft
+	source, err := database.NoteAudioTranscriptionSourceGet(ctx, job.UUID.String())
+	if err != nil {
+		return fmt.Errorf("Failed to get transcription source of %s: %v", job.UUID, err)
 	}
 	task, err := findMatchingTask(labelStudioClient, project, customer, note)
 	if err != nil {
-		return errors.New(fmt.Sprintf("Failed to search for a task: %v", err))
+		return fmt.Errorf("Failed to search for a task: %w", err)
 	}
 	// We already have a task, nothing to do.
 	if task != nil {
 		return nil
 	}
 
-	err = createTask(labelStudioClient, project, minioClient, minioBucket, customer, note)
+	err = createTask(ctx, labelStudioClient, project, minioClient, minioBucket, customer, note, source)
 	if err != nil {
-		return errors.New(fmt.Sprintf("Failed to create a task: %v", err))
+		return fmt.Errorf("Failed to create a task: %w", err)
 	}
 	return nil
 }
 
-func createTask(client *labelstudio.Client, project *labelstudio.Project, minioClient *minio.Client, bucket string, customer string, note *models.NoteAudio) error {
-	config := ReadConfig()
-	audioRef := fmt.Sprintf("s3://%s/%s-normalized.m4a", bucket, note.UUID)
-	audioFile := fmt.Sprintf("%s/%s-normalized.m4a", config.UserFiles.Directory, note.UUID)
-	uploadPath := fmt.Sprintf("%s-normalized.m4a", note.UUID)
+func createTask(ctx context.Context, client *labelstudio.Client, project *labelstudio.Project, minioClient *minio.Client, bucket string, customer string, note *models.NoteAudio, source *database.NoteAudioTranscriptionSource) error {
+	uploadPath := AudioFileContentKeyNormalized(note.UUID)
+	audioRef := fmt.Sprintf("s3://%s/%s", bucket, uploadPath)
 
 	if !minioClient.ObjectExists(bucket, uploadPath) {
-		err := minioClient.UploadFile(bucket, audioFile, uploadPath)
+		info, err := userFiles.Stat(ctx, uploadPath)
+		if err != nil {
+			return fmt.Errorf("Failed to find audio: %w", err)
+		}
+		audio, err := userFiles.Get(ctx, uploadPath)
+		if err != nil {
+			return fmt.Errorf("Failed to open audio: %w", err)
+		}
+		defer audio.Close()
+		err = minioClient.PutObject(ctx, bucket, uploadPath, audio, info.Size)
 		if err != nil {
 			return fmt.Errorf("Failed to upload audio: %v", err)
 		}
@@ -143,12 +136,22 @@ func createTask(client *labelstudio.Client, project *labelstudio.Project, minioC
 	if note.Transcription.IsValue() {
 		transcription = note.Transcription.MustGet()
 	}
+	var transcriptionEngine string = ""
+	var transcriptionConfidence string = ""
+	if source.Engine != nil {
+		transcriptionEngine = *source.Engine
+	}
+	if source.Confidence != nil {
+		transcriptionConfidence = fmt.Sprintf("%.2f", *source.Confidence)
+	}
 	simpleTasks := []map[string]interface{}{
 		{
 			"data": map[string]string{
-				"audio":         audioRef,
-				"note_uuid":     note.UUID,
-				"transcription": transcription,
+				"audio":                    audioRef,
+				"note_uuid":                note.UUID,
+				"transcription":            transcription,
+				"transcription_confidence": transcriptionConfidence,
+				"transcription_engine":     transcriptionEngine,
 			},
 			"meta": map[string]string{
 				"customer":  customer,
@@ -158,7 +161,7 @@ func createTask(client *labelstudio.Client, project *labelstudio.Project, minioC
 	}
 	_, err := client.ImportTasks(project.ID, simpleTasks)
 	if err != nil {
-		log.Fatalf("Failed to import tasks: %v", err)
+		return fmt.Errorf("Failed to import tasks: %w", err)
 	}
 	log.Printf("Created task for note audio %s", note.UUID)
 	return nil
@@ -210,7 +213,7 @@ func findMatchingTask(client *labelstudio.Client, project *labelstudio.Project,
 	}
 	tasksResponse, err := client.ListTasks(options)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to get tasks: %v", err)
+		return nil, fmt.Errorf("Failed to get tasks: %w", err)
 	}
 	if len(tasksResponse.Tasks) == 0 {
 		return nil, nil
@@ -3,6 +3,7 @@ package minio
 import (
 	"context"
 	"fmt"
+	"io"
 	"log"
 	"net/url"
 	"os"
@@ -75,3 +76,99 @@ func (minioClient *Client) UploadFile(bucketName string, filePath string, upload
 	}
 	return nil
 }
+
+// ObjectInfo is the metadata of a stored object
+type ObjectInfo struct {
+	LastModified time.Time
+	Size         int64
+}
+
+// isNotExist is true when the error from S3 means there is no such object
+func isNotExist(err error) bool {
+	code := minio.ToErrorResponse(err).Code
+	return code == "NoSuchKey" || code == "NoSuchObject"
+}
+
+// GetObject opens an object for reading. Missing objects return an error wrapping os.ErrNotExist.
+func (minioClient *Client) GetObject(ctx context.Context, bucket string, path string) (io.ReadSeekCloser, error) {
+	object, err := minioClient.client.GetObject(ctx, bucket, path, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get object %s/%s: %w", bucket, path, err)
+	}
+	// GetObject doesn't make a request until the first read, this makes sure the object exists
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		if isNotExist(err) {
+			return nil, fmt.Errorf("Object %s/%s: %w", bucket, path, os.ErrNotExist)
+		}
+		return nil, fmt.Errorf("Failed to get object %s/%s: %w", bucket, path, err)
+	}
+	return object, nil
+}
+
+// ListObjects calls fn with the path and metadata of every object in the bucket
+func (minioClient *Client) ListObjects(ctx context.Context, bucket string, fn func(path string, info *ObjectInfo) error) error {
+	// Stops the listing if fn returns early
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for object := range minioClient.client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Recursive: true}) {
+		if object.Err != nil {
+			return fmt.Errorf("Failed to list objects in %s: %w", bucket, object.Err)
+		}
+		err := fn(object.Key, &ObjectInfo{
+			LastModified: object.LastModified,
+			Size:         object.Size,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PresignGet creates a URL anyone can use to download the object until it expires. The object
+// is served with the given content type if it isn't empty.
+func (minioClient *Client) PresignGet(ctx context.Context, bucket string, path string, contentType string, expiry time.Duration) (*url.URL, error) {
+	reqParams := make(url.Values)
+	if contentType != "" {
+		reqParams.Set("response-content-type", contentType)
+	}
+	presignedURL, err := minioClient.client.PresignedGetObject(ctx, bucket, path, expiry, reqParams)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to presign %s/%s: %w", bucket, path, err)
+	}
+	return presignedURL, nil
+}
+
+// PutObject uploads the content of the reader. Size can be -1 if it isn't known.
+func (minioClient *Client) PutObject(ctx context.Context, bucket string, path string, body io.Reader, size int64) error {
+	_, err := minioClient.client.PutObject(ctx, bucket, path, body, size, minio.PutObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("Failed to put object %s/%s: %w", bucket, path, err)
+	}
+	return nil
+}
+
+// RemoveObject deletes an object. Removing an object that doesn't exist isn't an error.
+func (minioClient *Client) RemoveObject(ctx context.Context, bucket string, path string) error {
+	err := minioClient.client.RemoveObject(ctx, bucket, path, minio.RemoveObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("Failed to remove object %s/%s: %w", bucket, path, err)
+	}
+	return nil
+}
+
+// StatObject gets the metadata of an object. Missing objects return an error wrapping os.ErrNotExist.
+func (minioClient *Client) StatObject(ctx context.Context, bucket string, path string) (*ObjectInfo, error) {
+	info, err := minioClient.client.StatObject(ctx, bucket, path, minio.StatObjectOptions{})
+	if err != nil {
+		if isNotExist(err) {
+			return nil, fmt.Errorf("Object %s/%s: %w", bucket, path, os.ErrNotExist)
+		}
+		return nil, fmt.Errorf("Failed to stat object %s/%s: %w", bucket, path, err)
+	}
+	return &ObjectInfo{
+		LastModified: info.LastModified,
+		Size:         info.Size,
+	}, nil
+}
@@ -0,0 +1,156 @@
+package fssync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Gleipnir-Technology/fieldseeker-sync/database"
+	"github.com/google/uuid"
+)
+
+// How much audio to keep on either side of speech so we don't clip the start and end of words
+const segmentPadding = 0.25
+
+var (
+	silenceDurationRegexp = regexp.MustCompile(`Duration: (\d+):(\d+):(\d+(?:\.\d+)?)`)
+	silenceEndRegexp      = regexp.MustCompile(`silence_end: (-?\d+(?:\.\d+)?)`)
+	silenceStartRegexp    = regexp.MustCompile(`silence_start: (-?\d+(?:\.\d+)?)`)
+)
+
+// silence is a stretch of audio without speech, in seconds from the start
+type silence struct {
+	end   float64
+	start float64
+}
+
+// segmentAudio finds the speech in the normalized audio, saves where it is and writes a copy
+// of the audio with the silence between speech removed.
+func segmentAudio(ctx context.Context, ws *workspace, audioUUID uuid.UUID, force bool) error {
+	source := AudioFileContentKeyNormalized(audioUUID.String())
+	_, err := userFiles.Stat(ctx, source)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("%s doesn't exist, skipping segmentation", source)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	destination := AudioFileContentKeyTrimmed(audioUUID.String())
+	if !force && isUpToDate(ctx, destination, source) {
+		log.Printf("%s is up to date, skipping segmentation", destination)
+		return nil
+	}
+	if !force {
+		noSpeech, err := database.NoteAudioNoSpeech(ctx, audioUUID.String())
+		if err != nil {
+			return err
+		}
+		if noSpeech {
+			log.Printf("%s has no speech, skipping segmentation", source)
+			return nil
+		}
+	}
+	log.Printf("Detecting speech in %s", source)
+	input, err := ws.Fetch(ctx, source)
+	if err != nil {
+		return err
+	}
+	filter := fmt.Sprintf("silencedetect=noise=-%ddB:d=%.2f", config.Audio.SilenceDecibels, config.Audio.SilenceMinimum.Seconds())
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-i", input, "-af", filter, "-f", "null", "-")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		log.Printf("FFmpeg output for silence detection: %s", out)
+		return &commandError{fmt.Errorf("ffmpeg silence detection failed: %v", err), out}
+	}
+	silences, duration, err := parseSilenceDetect(string(out))
+	if err != nil {
+		return &commandError{err, out}
+	}
+	segments := speechSegments(silences, duration)
+	err = database.NoteAudioSegmentsSave(ctx, audioUUID.String(), segments)
+	if err != nil {
+		return err
+	}
+	log.Printf("Found %d speech segments in %s", len(segments), audioUUID)
+	if len(segments) == 0 {
+		return nil
+	}
+
+	selections := make([]string, 0, len(segments))
+	for _, s := range segments {
+		selections = append(selections, fmt.Sprintf("between(t,%.3f,%.3f)", s.Start, s.End))
+	}
+	filter = fmt.Sprintf("aselect='%s',asetpts=N/SR/TB", strings.Join(selections, "+"))
+	cmd = exec.CommandContext(ctx, "ffmpeg", "-y", "-i", input, "-vn", "-af", filter, "-c:a", "aac", ws.Path(destination))
+	out, err = cmd.CombinedOutput()
+	if err != nil {
+		log.Printf("FFmpeg output for trimming: %s", out)
+		return &commandError{fmt.Errorf("ffmpeg trimming failed: %v", err), out}
+	}
+	err = ws.Save(ctx, destination)
+	if err != nil {
+		return err
+	}
+	log.Printf("Trimmed silence from audio to %s", destination)
+	return nil
+}
+
+// parseSilenceDetect reads the silences and the total duration from the log output of ffmpeg's
+// silencedetect filter. A silence that runs to the end of the audio ends at the duration, so
+// it's an error if the duration isn't there.
+func parseSilenceDetect(output string) ([]silence, float64, error) {
+	match := silenceDurationRegexp.FindStringSubmatch(output)
+	if match == nil {
+		return nil, 0, errors.New("no duration in the ffmpeg silence detection output")
+	}
+	hours, _ := strconv.ParseFloat(match[1], 64)
+	minutes, _ := strconv.ParseFloat(match[2], 64)
+	seconds, _ := strconv.ParseFloat(match[3], 64)
+	duration := hours*3600 + minutes*60 + seconds
+	silences := make([]silence, 0)
+	var current *silence
+	for _, line := range strings.Split(output, "\n") {
+		if match := silenceStartRegexp.FindStringSubmatch(line); match != nil {
+			start, _ := strconv.ParseFloat(match[1], 64)
+			current = &silence{start: math.Max(start, 0)}
+		} else if match := silenceEndRegexp.FindStringSubmatch(line); match != nil && current != nil {
+			current.end, _ = strconv.ParseFloat(match[1], 64)
+			silences = append(silences, *current)
+			current = nil
+		}
+	}
+	if current != nil {
+		current.end = duration
+		silences = append(silences, *current)
+	}
+	return silences, duration, nil
+}
+
+// speechSegments is everything between the silences, padded a little on either side
+func speechSegments(silences []silence, duration float64) []*database.NoteAudioSegment {
+	segments := make([]*database.NoteAudioSegment, 0)
+	add := func(start, end float64) {
+		if end <= start {
+			return
+		}
+		segments = append(segments, &database.NoteAudioSegment{
+			End:      float32(math.Min(end+segmentPadding, duration)),
+			Position: len(segments),
+			Start:    float32(math.Max(start-segmentPadding, 0)),
+		})
+	}
+	cursor := 0.0
+	for _, s := range silences {
+		add(cursor, s.start)
+		cursor = s.end
+	}
+	add(cursor, duration)
+	return segments
+}
@@ -0,0 +1,125 @@
+package fssync
+
+import (
+	"math"
+	"testing"
+)
+
+// Captured from ffmpeg -i input.wav -af silencedetect=noise=-35dB:d=1 -f null -
+const silenceDetectOutput = `Input #0, wav, from 'input.wav':
+  Duration: 00:00:12.50, bitrate: 256 kb/s
+  Stream #0:0: Audio: pcm_s16le ([1][0][0][0] / 0x0001), 16000 Hz, 1 channels, s16, 256 kb/s
+Stream mapping:
+  Stream #0:0 -> #0:0 (pcm_s16le (native) -> pcm_s16le (native))
+Output #0, null, to 'pipe:':
+[silencedetect @ 0x55d0c8a3c700] silence_start: -0.00133333
+[silencedetect @ 0x55d0c8a3c700] silence_end: 1.2 | silence_duration: 1.20133
+[silencedetect @ 0x55d0c8a3c700] silence_start: 4.5
+[silencedetect @ 0x55d0c8a3c700] silence_end: 7.25 | silence_duration: 2.75
+[silencedetect @ 0x55d0c8a3c700] silence_start: 10.8
+size=N/A time=00:00:12.50 bitrate=N/A speed= 512x
+`
+
+func TestParseSilenceDetect(t *testing.T) {
+	cases := []struct {
+		name     string
+		output   string
+		duration float64
+		silences []silence
+	}{
+		{
+			name:     "negative start and silence to the end",
+			output:   silenceDetectOutput,
+			duration: 12.5,
+			silences: []silence{{start: 0, end: 1.2}, {start: 4.5, end: 7.25}, {start: 10.8, end: 12.5}},
+		},
+		{
+			name:     "no silence",
+			output:   "  Duration: 01:02:03.5, start: 0.000000, bitrate: 256 kb/s\n",
+			duration: 3723.5,
+			silences: []silence{},
+		},
+		{
+			name:     "end without a start",
+			output:   "  Duration: 00:00:05.00\n[silencedetect @ 0x1] silence_end: 2 | silence_duration: 2\n",
+			duration: 5,
+			silences: []silence{},
+		},
+	}
+	for _, c := range cases {
+		silences, duration, err := parseSilenceDetect(c.output)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if duration != c.duration {
+			t.Errorf("%s: got duration %v, expected %v", c.name, duration, c.duration)
+		}
+		if len(silences) != len(c.silences) {
+			t.Errorf("%s: got silences %v, expected %v", c.name, silences, c.silences)
+			continue
+		}
+		for i := range silences {
+			if silences[i] != c.silences[i] {
+				t.Errorf("%s: got silence %d %v, expected %v", c.name, i, silences[i], c.silences[i])
+			}
+		}
+	}
+}
+
+func TestParseSilenceDetectNoDuration(t *testing.T) {
+	// Without the duration there's nowhere for the trailing silence to end
+	_, _, err := parseSilenceDetect("[silencedetect @ 0x1] silence_start: 3\n")
+	if err == nil {
+		t.Error("Got no error without a duration")
+	}
+}
+
+func TestSpeechSegments(t *testing.T) {
+	cases := []struct {
+		name     string
+		silences []silence
+		duration float64
+		segments [][2]float64
+	}{
+		{
+			name:     "captured output",
+			silences: []silence{{start: 0, end: 1.2}, {start: 4.5, end: 7.25}, {start: 10.8, end: 12.5}},
+			duration: 12.5,
+			segments: [][2]float64{{0.95, 4.75}, {7, 11.05}},
+		},
+		{
+			name:     "padding clamped to the duration",
+			silences: []silence{},
+			duration: 3,
+			segments: [][2]float64{{0, 3}},
+		},
+		{
+			name:     "speech to the end",
+			silences: []silence{{start: 0, end: 1}},
+			duration: 2,
+			segments: [][2]float64{{0.75, 2}},
+		},
+		{
+			name:     "all silence",
+			silences: []silence{{start: 0, end: 4}},
+			duration: 4,
+			segments: [][2]float64{},
+		},
+	}
+	for _, c := range cases {
+		segments := speechSegments(c.silences, c.duration)
+		if len(segments) != len(c.segments) {
+			t.Errorf("%s: got %d segments, expected %d", c.name, len(segments), len(c.segments))
+			continue
+		}
+		for i, segment := range segments {
+			if segment.Position != i {
+				t.Errorf("%s: got position %d for segment %d", c.name, segment.Position, i)
+			}
+			if math.Abs(float64(segment.Start)-c.segments[i][0]) > 1e-6 || math.Abs(float64(segment.End)-c.segments[i][1]) > 1e-6 {
+				t.Errorf("%s: got segment %d %v-%v, expected %v", c.name, i, segment.Start, segment.End, c.segments[i])
+			}
+		}
+	}
+}
@@ -600,6 +600,7 @@ type NoteAudioBreadcrumbPayload struct {
 type NidusNotePayload struct {
 	UUID      string    `json:"uuid"`
 	Timestamp time.Time `json:"timestamp"`
+	Audio     []string  `json:"audio"`
 	Images    []string  `json:"images"`
 	Location  Location  `json:"location"`
 	Text      string    `json:"text"`
@@ -0,0 +1,263 @@
+package fssync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Storage holds the files users upload and the files we produce from them. Keys are
+// slash-separated paths relative to the root of the storage, like "<uuid>-normalized.m4a".
+type Storage interface {
+	// Delete removes a file. Deleting a file that doesn't exist isn't an error.
+	Delete(ctx context.Context, key string) error
+	// Get opens a file for reading. Missing files return an error wrapping os.ErrNotExist.
+	Get(ctx context.Context, key string) (io.ReadSeekCloser, error)
+	// List calls fn with the key and metadata of every file. Hidden files, which are in-progress
+	// writes and uploads, are left out.
+	List(ctx context.Context, fn func(key string, info *StorageInfo) error) error
+	// PresignGet creates a URL that serves the file without authentication until it expires.
+	// Storage that can't do this returns ErrPresignUnsupported.
+	PresignGet(ctx context.Context, key string, contentType string, expiry time.Duration) (string, error)
+	// Put writes a file, replacing any file with the same key
+	Put(ctx context.Context, key string, body io.Reader) error
+	// Stat gets the size and modification time of a file. Missing files return an error
+	// wrapping os.ErrNotExist.
+	Stat(ctx context.Context, key string) (*StorageInfo, error)
+}
+
+type StorageInfo struct {
+	ModTime time.Time
+	Size    int64
+}
+
+// StatFunc gets the size and modification time of a file, nil if it doesn't exist
+type StatFunc func(key string) *StorageInfo
+
+// StatStorage looks files up in storage one at a time
+func StatStorage(ctx context.Context, storage Storage) StatFunc {
+	return func(key string) *StorageInfo {
+		info, err := storage.Stat(ctx, key)
+		if err != nil {
+			return nil
+		}
+		return info
+	}
+}
+
+// StatListed looks files up in what was listed from storage, which saves asking storage about
+// each file when we're going to look at most of them
+func StatListed(files map[string]*StorageInfo) StatFunc {
+	return func(key string) *StorageInfo {
+		return files[key]
+	}
+}
+
+// ErrPresignUnsupported means the file has to be served by us rather than by the storage
+var ErrPresignUnsupported = errors.New("Storage does not support presigned URLs")
+
+var userFiles Storage
+
+// NewStorage creates the storage selected in the config
+func NewStorage(c *Config) (Storage, error) {
+	switch c.UserFiles.Backend {
+	case "", "local":
+		return NewLocalStorage(c.UserFiles.Directory), nil
+	case "s3":
+		return NewS3Storage(c.S3, c.UserFiles.Bucket)
+	default:
+		return nil, fmt.Errorf("Unknown user files backend '%s'", c.UserFiles.Backend)
+	}
+}
+
+// UserFiles is the storage for user files. It's available once the config has been read.
+func UserFiles() Storage {
+	return userFiles
+}
+
+// LocalStorage keeps files in a directory on disk
+type LocalStorage struct {
+	directory string
+}
+
+func NewLocalStorage(directory string) *LocalStorage {
+	return &LocalStorage{directory: directory}
+}
+
+// Path is where the file for a key is on disk
+func (s *LocalStorage) Path(key string) string {
+	return filepath.Join(s.directory, filepath.FromSlash(path.Clean("/"+key)))
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	err := os.Remove(s.Path(key))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("Failed to delete %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *LocalStorage) Get(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	file, err := os.Open(s.Path(key))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open %s: %w", key, err)
+	}
+	return file, nil
+}
+
+func (s *LocalStorage) List(ctx context.Context, fn func(key string, info *StorageInfo) error) error {
+	return s.Walk(func(key string, info os.FileInfo) error {
+		return fn(key, &StorageInfo{
+			ModTime: info.ModTime(),
+			Size:    info.Size(),
+		})
+	})
+}
+
+func (s *LocalStorage) PresignGet(ctx context.Context, key string, contentType string, expiry time.Duration) (string, error) {
+	return "", ErrPresignUnsupported
+}
+
+// Put writes to a temporary file that replaces the existing file once it's complete so readers
+// never see part of a file.
+func (s *LocalStorage) Put(ctx context.Context, key string, body io.Reader) error {
+	destination := s.Path(key)
+	err := os.MkdirAll(filepath.Dir(destination), 0755)
+	if err != nil {
+		return fmt.Errorf("Failed to create directory for %s: %w", key, err)
+	}
+	file, err := os.CreateTemp(filepath.Dir(destination), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("Failed to create file for %s: %w", key, err)
+	}
+	defer os.Remove(file.Name())
+	_, err = io.Copy(file, body)
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("Failed to write %s: %w", key, err)
+	}
+	err = file.Close()
+	if err != nil {
+		return fmt.Errorf("Failed to write %s: %w", key, err)
+	}
+	err = os.Chmod(file.Name(), 0644)
+	if err != nil {
+		return fmt.Errorf("Failed to set permissions of %s: %w", key, err)
+	}
+	err = os.Rename(file.Name(), destination)
+	if err != nil {
+		return fmt.Errorf("Failed to save %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *LocalStorage) Stat(ctx context.Context, key string) (*StorageInfo, error) {
+	info, err := os.Stat(s.Path(key))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to stat %s: %w", key, err)
+	}
+	return &StorageInfo{
+		ModTime: info.ModTime(),
+		Size:    info.Size(),
+	}, nil
+}
+
+// Walk calls fn with the key of every file in the storage
+func (s *LocalStorage) Walk(fn func(key string, info os.FileInfo) error) error {
+	return filepath.Walk(s.directory, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// Hidden files are in-progress writes and uploads
+		if p != s.directory && strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		relative, err := filepath.Rel(s.directory, p)
+		if err != nil {
+			return err
+		}
+		return fn(filepath.ToSlash(relative), info)
+	})
+}
+
+// isHiddenKey is true for keys with a path segment starting with a dot
+func isHiddenKey(key string) bool {
+	for _, segment := range strings.Split(key, "/") {
+		if strings.HasPrefix(segment, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// workspace is a scratch directory for running tools like ffmpeg that need files on disk.
+// Files in local storage are used where they are, anything else is downloaded first.
+type workspace struct {
+	dir string
+}
+
+func newWorkspace() (*workspace, error) {
+	dir, err := os.MkdirTemp("", "fssync-")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create workspace: %v", err)
+	}
+	return &workspace{dir: dir}, nil
+}
+
+// Close removes the workspace and everything in it
+func (w *workspace) Close() {
+	os.RemoveAll(w.dir)
+}
+
+// Fetch gets a path on disk with the content of a stored file
+func (w *workspace) Fetch(ctx context.Context, key string) (string, error) {
+	if local, ok := userFiles.(*LocalStorage); ok {
+		return local.Path(key), nil
+	}
+	destination := w.Path(key)
+	if _, err := os.Stat(destination); err == nil {
+		return destination, nil
+	}
+	source, err := userFiles.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer source.Close()
+	file, err := os.Create(destination)
+	if err != nil {
+		return "", fmt.Errorf("Failed to create %s: %v", destination, err)
+	}
+	defer file.Close()
+	if _, err := io.Copy(file, source); err != nil {
+		return "", fmt.Errorf("Failed to download %s: %w", key, err)
+	}
+	return destination, nil
+}
+
+// Path is where a tool should write a file that will be saved under the key. The file name
+// keeps the extension of the key since ffmpeg picks the format from it.
+func (w *workspace) Path(key string) string {
+	return filepath.Join(w.dir, path.Base(key))
+}
+
+// Save stores the file written to Path(key)
+func (w *workspace) Save(ctx context.Context, key string) error {
+	file, err := os.Open(w.Path(key))
+	if err != nil {
+		return fmt.Errorf("Failed to open output for %s: %v", key, err)
+	}
+	defer file.Close()
+	return userFiles.Put(ctx, key, file)
+}
@@ -0,0 +1,78 @@
+package fssync
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"time"
+
+	"github.com/Gleipnir-Technology/fieldseeker-sync/minio"
+)
+
+// S3Storage keeps files in a bucket on S3 or anything compatible with it, like MinIO
+type S3Storage struct {
+	bucket string
+	client *minio.Client
+}
+
+func NewS3Storage(c ConfigS3, bucket string) (*S3Storage, error) {
+	if bucket == "" {
+		return nil, errors.New("You must specify a bucket for user files stored in S3")
+	}
+	client, err := minio.NewClient(c.BaseURL, c.AccessKeyID, c.SecretAccessKey)
+	if err != nil {
+		return nil, err
+	}
+	return &S3Storage{
+		bucket: bucket,
+		client: client,
+	}, nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.bucket, s.objectPath(key))
+}
+
+func (s *S3Storage) Get(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	return s.client.GetObject(ctx, s.bucket, s.objectPath(key))
+}
+
+func (s *S3Storage) List(ctx context.Context, fn func(key string, info *StorageInfo) error) error {
+	return s.client.ListObjects(ctx, s.bucket, func(key string, info *minio.ObjectInfo) error {
+		if isHiddenKey(key) {
+			return nil
+		}
+		return fn(key, &StorageInfo{
+			ModTime: info.LastModified,
+			Size:    info.Size,
+		})
+	})
+}
+
+func (s *S3Storage) PresignGet(ctx context.Context, key string, contentType string, expiry time.Duration) (string, error) {
+	u, err := s.client.PresignGet(ctx, s.bucket, s.objectPath(key), contentType, expiry)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+func (s *S3Storage) Put(ctx context.Context, key string, body io.Reader) error {
+	return s.client.PutObject(ctx, s.bucket, s.objectPath(key), body, -1)
+}
+
+func (s *S3Storage) Stat(ctx context.Context, key string) (*StorageInfo, error) {
+	info, err := s.client.StatObject(ctx, s.bucket, s.objectPath(key))
+	if err != nil {
+		return nil, err
+	}
+	return &StorageInfo{
+		ModTime: info.LastModified,
+		Size:    info.Size,
+	}, nil
+}
+
+func (s *S3Storage) objectPath(key string) string {
+	return path.Clean("/" + key)[1:]
+}
@@ -0,0 +1,128 @@
+package fssync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Transcript is the text a Transcriber heard in an audio file.
+type Transcript struct {
+	// Confidence is between 0 and 1
+	Confidence float32
+	Text       string
+}
+
+// Transcriber turns speech in an audio file into text.
+type Transcriber interface {
+	// Name identifies the engine in the note_audio table
+	Name() string
+	Transcribe(ctx context.Context, path string) (*Transcript, error)
+}
+
+// NewTranscriber creates the transcriber selected in the configuration. It returns nil if
+// machine transcription is disabled.
+func NewTranscriber(c ConfigTranscriber) (Transcriber, error) {
+	switch c.Engine {
+	case "":
+		return nil, nil
+	case "whisper":
+		if c.WhisperModel == "" {
+			return nil, fmt.Errorf("You must set FIELDSEEKER_SYNC_WHISPER_MODEL to use whisper")
+		}
+		return &whisperTranscriber{
+			binary:   c.WhisperBinary,
+			language: c.Language,
+			model:    c.WhisperModel,
+		}, nil
+	default:
+		return nil, fmt.Errorf("Unknown transcriber '%s'", c.Engine)
+	}
+}
+
+// whisperTranscriber runs the whisper.cpp command line tool.
+type whisperTranscriber struct {
+	binary   string
+	language string
+	model    string
+}
+
+// The parts of whisper.cpp's full JSON output that we use
+type whisperOutput struct {
+	Transcription []struct {
+		Text   string `json:"text"`
+		Tokens []struct {
+			P    float32 `json:"p"`
+			Text string  `json:"text"`
+		} `json:"tokens"`
+	} `json:"transcription"`
+}
+
+func (t *whisperTranscriber) Name() string {
+	return "whisper.cpp"
+}
+
+func (t *whisperTranscriber) Transcribe(ctx context.Context, path string) (*Transcript, error) {
+	dir, err := os.MkdirTemp("", "whisper")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// whisper.cpp only reads 16kHz WAV files
+	wav := filepath.Join(dir, "input.wav")
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-y", "-i", path, "-ar", "16000", "-ac", "1", "-c:a", "pcm_s16le", wav)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		log.Printf("FFmpeg output for whisper conversion: %s", out)
+		return nil, &commandError{fmt.Errorf("ffmpeg conversion to WAV failed: %v", err), out}
+	}
+
+	prefix := filepath.Join(dir, "output")
+	cmd = exec.CommandContext(ctx, t.binary, "-m", t.model, "-l", t.language, "-f", wav, "-ojf", "-of", prefix, "-np")
+	out, err = cmd.CombinedOutput()
+	if err != nil {
+		return nil, &commandError{fmt.Errorf("whisper failed: %v", err), out}
+	}
+	content, err := os.ReadFile(prefix + ".json")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read whisper output: %v", err)
+	}
+	var output whisperOutput
+	if err := json.Unmarshal(content, &output); err != nil {
+		return nil, fmt.Errorf("Failed to parse whisper output: %v", err)
+	}
+	return output.transcript(), nil
+}
+
+// transcript joins the segments and averages the probability of every token that
+// isn't one of whisper's special tokens like [_BEG_].
+func (o *whisperOutput) transcript() *Transcript {
+	var (
+		count int
+		parts []string
+		total float32
+	)
+	for _, segment := range o.Transcription {
+		parts = append(parts, strings.TrimSpace(segment.Text))
+		for _, token := range segment.Tokens {
+			if strings.HasPrefix(token.Text, "[_") {
+				continue
+			}
+			count++
+			total += token.P
+		}
+	}
+	result := &Transcript{
+		Text: strings.TrimSpace(strings.Join(parts, " ")),
+	}
+	if count > 0 {
+		result.Confidence = total / float32(count)
+	}
+	return result
+}
@@ -0,0 +1,211 @@
+package fssync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+
+	"github.com/Gleipnir-Technology/fieldseeker-sync/database"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrUploadChecksum means the finished file isn't what the client sent. The chunks are
+	// thrown away and the client has to upload the file again.
+	ErrUploadChecksum = errors.New("uploaded file does not match its checksum")
+	// ErrUploadIncomplete means the upload can't be completed until the rest of the file is sent
+	ErrUploadIncomplete = errors.New("upload is missing part of the file")
+	// ErrUploadOffset means a chunk starts after the end of what we've received so far
+	ErrUploadOffset = errors.New("chunk does not start where the upload left off")
+	// ErrUploadTooLarge means the file is bigger than FIELDSEEKER_SYNC_UPLOADS_MAX_MEGABYTES
+	ErrUploadTooLarge = errors.New("upload is too large")
+)
+
+var sha256Regexp = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Chunks for the same upload are written one at a time. Clients shouldn't send them in
+// parallel but will retry a chunk when they don't hear back in time.
+var uploadLocks sync.Map
+
+func uploadLock(id string) func() {
+	lock, _ := uploadLocks.LoadOrStore(id, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	return lock.(*sync.Mutex).Unlock
+}
+
+// UploadStart begins a resumable upload of the content for an audio or image note. Starting
+// an upload of the same file again gets the existing session so the client can resume it.
+func UploadStart(ctx context.Context, kind database.UploadKind, contentUUID uuid.UUID, creator int, checksum string, size int64) (*database.UploadSession, error) {
+	if !sha256Regexp.MatchString(checksum) {
+		return nil, fmt.Errorf("Invalid SHA-256 '%s', it should be 64 lowercase hex digits", checksum)
+	}
+	if size <= 0 {
+		return nil, fmt.Errorf("Invalid upload size %d", size)
+	}
+	if size > config.Uploads.MaxBytes {
+		return nil, ErrUploadTooLarge
+	}
+	return database.UploadSessionCreate(ctx, kind, contentUUID.String(), creator, checksum, size)
+}
+
+// UploadOffset is how much of the file we have. Clients resume from here.
+func UploadOffset(session *database.UploadSession) (int64, error) {
+	if session.Completed != nil {
+		return session.Size, nil
+	}
+	info, err := os.Stat(uploadPath(session.ID))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("Failed to stat upload %s: %v", session.ID, err)
+	}
+	return info.Size(), nil
+}
+
+// UploadAppend adds a chunk starting at the given offset in the file and returns the new
+// offset. The part of a chunk that we already have is skipped, so retrying a chunk is safe.
+// A chunk that starts past the end of what we have returns ErrUploadOffset.
+func UploadAppend(ctx context.Context, session *database.UploadSession, start int64, body io.Reader) (int64, error) {
+	unlock := uploadLock(session.ID)
+	defer unlock()
+
+	offset, err := UploadOffset(session)
+	if err != nil {
+		return 0, err
+	}
+	if start > offset {
+		return offset, ErrUploadOffset
+	}
+	if session.Completed != nil {
+		return offset, nil
+	}
+	if _, err := io.CopyN(io.Discard, body, offset-start); err != nil {
+		return offset, nil
+	}
+	if err := os.MkdirAll(config.Uploads.Directory, 0755); err != nil {
+		return offset, fmt.Errorf("Failed to create upload directory: %v", err)
+	}
+	file, err := os.OpenFile(uploadPath(session.ID), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return offset, fmt.Errorf("Failed to open upload %s: %v", session.ID, err)
+	}
+	defer file.Close()
+	// Anything past the size the client told us about is ignored
+	written, err := io.Copy(file, io.LimitReader(body, session.Size-offset))
+	offset += written
+	if err != nil {
+		// Keep what we got, the client can resume from there
+		log.Printf("Upload %s interrupted at %d of %d bytes: %v", session.ID, offset, session.Size, err)
+		return offset, nil
+	}
+	return offset, nil
+}
+
+// UploadComplete checks the uploaded file against its checksum, saves it and starts processing
+// it. Completing an upload again does nothing, so clients can retry if they don't get a response.
+func UploadComplete(ctx context.Context, id string) error {
+	unlock := uploadLock(id)
+	defer unlock()
+
+	// Re-read the session in case another request completed it while we waited for the lock
+	session, err := database.UploadSessionGet(ctx, id)
+	if err != nil {
+		return err
+	}
+	if session == nil {
+		return fmt.Errorf("No upload session %s", id)
+	}
+	file, err := uploadCheck(session)
+	if err != nil {
+		return err
+	}
+	if file == nil {
+		return nil
+	}
+	defer file.Close()
+	path := uploadPath(session.ID)
+
+	contentUUID, err := uuid.Parse(session.ContentUUID)
+	if err != nil {
+		return fmt.Errorf("Failed to parse content UUID '%s': %v", session.ContentUUID, err)
+	}
+	switch session.Kind {
+	case database.UploadKindAudio:
+		err = AudioFileContentWrite(ctx, contentUUID, file)
+	case database.UploadKindImage:
+		err = ImageFileContentWrite(ctx, contentUUID, file)
+	default:
+		err = fmt.Errorf("Unknown upload kind '%s'", session.Kind)
+	}
+	if errors.Is(err, ErrNotAnImage) {
+		os.Remove(path)
+		return err
+	} else if err != nil {
+		return err
+	}
+	first, err := database.UploadSessionComplete(ctx, session.ID)
+	if err != nil {
+		return err
+	}
+	if first && session.Kind == database.UploadKindAudio {
+		err = EnqueueAudioJob(AudioJob{AudioUUID: contentUUID})
+	} else if first && session.Kind == database.UploadKindImage {
+		err = EnqueueImageJob(ImageJob{ImageUUID: contentUUID})
+	}
+	if err != nil {
+		return err
+	}
+	os.Remove(path)
+	uploadLocks.Delete(session.ID)
+	log.Printf("Completed upload %s of %s %s", session.ID, session.Kind, session.ContentUUID)
+	return nil
+}
+
+// uploadCheck opens an upload once all of it has been received and it matches its checksum.
+// An upload that doesn't match is thrown away. Returns nil if it was completed already.
+func uploadCheck(session *database.UploadSession) (*os.File, error) {
+	if session.Completed != nil {
+		return nil, nil
+	}
+	offset, err := UploadOffset(session)
+	if err != nil {
+		return nil, err
+	}
+	if offset != session.Size {
+		return nil, ErrUploadIncomplete
+	}
+
+	path := uploadPath(session.ID)
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open upload %s: %v", session.ID, err)
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("Failed to read upload %s: %v", session.ID, err)
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != session.SHA256 {
+		log.Printf("Upload %s doesn't match its checksum, discarding it", session.ID)
+		file.Close()
+		os.Remove(path)
+		return nil, ErrUploadChecksum
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("Failed to read upload %s: %v", session.ID, err)
+	}
+	return file, nil
+}
+
+func uploadPath(id string) string {
+	return filepath.Join(config.Uploads.Directory, id)
+}
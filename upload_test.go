@@ -0,0 +1,113 @@
+package fssync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Gleipnir-Technology/fieldseeker-sync/database"
+)
+
+func useUploadDirectory(t *testing.T) {
+	previous := config
+	config = &Config{Uploads: ConfigUploads{Directory: t.TempDir()}}
+	t.Cleanup(func() { config = previous })
+}
+
+func newTestUploadSession(content string) *database.UploadSession {
+	sum := sha256.Sum256([]byte(content))
+	return &database.UploadSession{
+		ID:     "test-" + hex.EncodeToString(sum[:4]),
+		SHA256: hex.EncodeToString(sum[:]),
+		Size:   int64(len(content)),
+	}
+}
+
+func TestUploadAppend(t *testing.T) {
+	useUploadDirectory(t)
+	ctx := context.Background()
+	session := newTestUploadSession("hello world")
+	cases := []struct {
+		name   string
+		start  int64
+		chunk  string
+		offset int64
+		err    error
+	}{
+		{"first chunk", 0, "hello", 5, nil},
+		{"chunk beyond the offset", 8, "rld", 5, ErrUploadOffset},
+		{"retried chunk overlapping the offset", 3, "lo wo", 8, nil},
+		{"retried chunk we already have", 0, "hello", 8, nil},
+		{"last chunk with more than the size", 8, "rld and more", 11, nil},
+		{"chunk after the end", 11, "!", 11, nil},
+	}
+	for _, c := range cases {
+		offset, err := UploadAppend(ctx, session, c.start, strings.NewReader(c.chunk))
+		if !errors.Is(err, c.err) {
+			t.Errorf("%s: got error %v, expected %v", c.name, err, c.err)
+		}
+		if offset != c.offset {
+			t.Errorf("%s: got offset %d, expected %d", c.name, offset, c.offset)
+		}
+	}
+	content, err := os.ReadFile(uploadPath(session.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "hello world" {
+		t.Errorf("Got content %q", content)
+	}
+}
+
+func TestUploadCheck(t *testing.T) {
+	useUploadDirectory(t)
+	ctx := context.Background()
+
+	session := newTestUploadSession("hello world")
+	if _, err := UploadAppend(ctx, session, 0, strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := uploadCheck(session); !errors.Is(err, ErrUploadIncomplete) {
+		t.Errorf("Got %v for an incomplete upload", err)
+	}
+	if _, err := UploadAppend(ctx, session, 5, strings.NewReader(" world")); err != nil {
+		t.Fatal(err)
+	}
+	file, err := uploadCheck(session)
+	if err != nil {
+		t.Fatalf("Got %v for a complete upload", err)
+	}
+	content, err := io.ReadAll(file)
+	file.Close()
+	if err != nil || string(content) != "hello world" {
+		t.Errorf("Got content %q, %v", content, err)
+	}
+
+	// Completing again does nothing
+	completed := time.Now()
+	session.Completed = &completed
+	if file, err := uploadCheck(session); file != nil || err != nil {
+		t.Errorf("Got %v, %v for a completed upload", file, err)
+	}
+	if offset, err := UploadOffset(session); offset != session.Size || err != nil {
+		t.Errorf("Got offset %d, %v for a completed upload", offset, err)
+	}
+
+	mismatched := newTestUploadSession("hello world")
+	mismatched.ID = "test-mismatched"
+	if _, err := UploadAppend(ctx, mismatched, 0, strings.NewReader("hello there")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := uploadCheck(mismatched); !errors.Is(err, ErrUploadChecksum) {
+		t.Errorf("Got %v for a mismatched upload", err)
+	}
+	if offset, err := UploadOffset(mismatched); offset != 0 || err != nil {
+		t.Errorf("Got offset %d, %v after discarding a mismatched upload", offset, err)
+	}
+}
@@ -1,45 +1,115 @@
 package fssync
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"os"
 
+	"github.com/Gleipnir-Technology/fieldseeker-sync/database"
 	"github.com/google/uuid"
 )
 
-func AudioFileContentPathRaw(audioUUID string) string {
-	config := ReadConfig()
-	return fmt.Sprintf("%s/%s.m4a", config.UserFiles.Directory, audioUUID)
+// The keys of user files in storage. See Storage.
+
+func AudioFileContentKeyRaw(audioUUID string) string {
+	return fmt.Sprintf("%s.m4a", audioUUID)
+}
+func AudioFileContentKeyMp3(audioUUID string) string {
+	return fmt.Sprintf("%s.mp3", audioUUID)
+}
+func AudioFileContentKeyNormalized(audioUUID string) string {
+	return fmt.Sprintf("%s-normalized.m4a", audioUUID)
 }
-func AudioFileContentPathMp3(audioUUID string) string {
-	config := ReadConfig()
-	return fmt.Sprintf("%s/%s.mp3", config.UserFiles.Directory, audioUUID)
+func AudioFileContentKeyOgg(audioUUID string) string {
+	return fmt.Sprintf("%s.ogg", audioUUID)
 }
-func AudioFileContentPathNormalized(audioUUID string) string {
-	config := ReadConfig()
-	return fmt.Sprintf("%s/%s-normalized.m4a", config.UserFiles.Directory, audioUUID)
+func AudioFileContentKeyTrimmed(audioUUID string) string {
+	return fmt.Sprintf("%s-trimmed.m4a", audioUUID)
 }
-func AudioFileContentPathOgg(audioUUID string) string {
-	config := ReadConfig()
-	return fmt.Sprintf("%s/%s.ogg", config.UserFiles.Directory, audioUUID)
+func AudioFileContentKeyWaveformJSON(audioUUID string) string {
+	return fmt.Sprintf("%s-waveform.json", audioUUID)
 }
-func AudioFileContentWrite(audioUUID uuid.UUID, body io.Reader) error {
-	// Create file in configured directory
-	filepath := AudioFileContentPathRaw(audioUUID.String())
-	dst, err := os.Create(filepath)
+func AudioFileContentKeyWaveformPNG(audioUUID string) string {
+	return fmt.Sprintf("%s-waveform.png", audioUUID)
+}
+func ImageFileContentKeyRaw(imageUUID string) string {
+	return fmt.Sprintf("%s.photo", imageUUID)
+}
+
+// UserFileKeyNote finds the note a user file belongs to from its key. ok is false for keys
+// that aren't named like any file we store.
+func UserFileKeyNote(key string) (kind database.UploadKind, noteUUID string, ok bool) {
+	if len(key) < 36 {
+		return "", "", false
+	}
+	parsed, err := uuid.Parse(key[:36])
 	if err != nil {
-		log.Printf("Failed to create audio file at %s: %v\n", filepath, err)
-		return fmt.Errorf("Failed to create audio file at %s: %v", filepath, err)
+		return "", "", false
+	}
+	noteUUID = parsed.String()
+	// The keys we store with the UUID left out
+	audioSuffixes := []string{
+		AudioFileContentKeyRaw(""),
+		AudioFileContentKeyNormalized(""),
+		AudioFileContentKeyTrimmed(""),
+		AudioFileContentKeyWaveformJSON(""),
+		AudioFileContentKeyWaveformPNG(""),
+	}
+	for i := range AudioProfiles {
+		audioSuffixes = append(audioSuffixes, AudioProfiles[i].Key(""))
+	}
+	imageSuffixes := []string{ImageFileContentKeyRaw("")}
+	for i := range ImageSizes {
+		for j := range ImageFormats {
+			imageSuffixes = append(imageSuffixes, ImageFileContentKeyDerivative("", &ImageSizes[i], &ImageFormats[j]))
+		}
+	}
+	suffix := key[36:]
+	for _, s := range audioSuffixes {
+		if suffix == s {
+			return database.UploadKindAudio, noteUUID, true
+		}
 	}
-	defer dst.Close()
+	for _, s := range imageSuffixes {
+		if suffix == s {
+			return database.UploadKindImage, noteUUID, true
+		}
+	}
+	return "", "", false
+}
+
+func AudioFileContentWrite(ctx context.Context, audioUUID uuid.UUID, body io.Reader) error {
+	key := AudioFileContentKeyRaw(audioUUID.String())
+	err := userFiles.Put(ctx, key, body)
+	if err != nil {
+		return fmt.Errorf("Unable to save audio file %s: %w", key, err)
+	}
+	log.Printf("Saved audio content to %s\n", key)
+	return nil
+}
+
+// ErrNotAnImage means an image upload was refused because of what's in it
+var ErrNotAnImage = errors.New("file is not an image")
 
-	// Copy rest of request body to file
-	_, err = io.Copy(dst, body)
+// ImageFileContentWrite saves an uploaded photo. Content that doesn't start like a type of
+// image we accept is refused with ErrNotAnImage.
+func ImageFileContentWrite(ctx context.Context, imageUUID uuid.UUID, body io.Reader) error {
+	key := ImageFileContentKeyRaw(imageUUID.String())
+	reader := bufio.NewReaderSize(body, imageSniffLength)
+	start, err := reader.Peek(imageSniffLength)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("Unable to read image file %s: %w", key, err)
+	}
+	if sniffImage(start) == "" {
+		return ErrNotAnImage
+	}
+	err = userFiles.Put(ctx, key, reader)
 	if err != nil {
-		return fmt.Errorf("Unable to save file to create audio file at %s: %v", filepath, err)
+		return fmt.Errorf("Unable to save image file %s: %w", key, err)
 	}
-	log.Printf("Saved audio content to %s\n", filepath)
+	log.Printf("Saved image content to %s\n", key)
 	return nil
 }
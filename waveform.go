@@ -0,0 +1,139 @@
+package fssync
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"os"
+	"os/exec"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// The number of min/max pairs in the waveform regardless of the length of the audio
+	waveformLength = 2000
+	// The rate we decode audio at to compute peaks. Plenty for speech.
+	waveformSampleRate = 8000
+	waveformPNGHeight  = 160
+)
+
+var waveformColor = color.RGBA{0x0d, 0x6e, 0xfd, 0xff}
+
+// Waveform is peak data in the same layout as the BBC audiowaveform tool, which most
+// waveform display libraries can read. Data holds a min and max sample for each pixel.
+type Waveform struct {
+	Bits            int     `json:"bits"`
+	Channels        int     `json:"channels"`
+	Data            []int16 `json:"data"`
+	Length          int     `json:"length"`
+	SampleRate      int     `json:"sample_rate"`
+	SamplesPerPixel int     `json:"samples_per_pixel"`
+	Version         int     `json:"version"`
+}
+
+// generateWaveform writes the peak data and a PNG of the waveform for the normalized audio
+func generateWaveform(ctx context.Context, ws *workspace, audioUUID uuid.UUID, force bool) error {
+	source := AudioFileContentKeyNormalized(audioUUID.String())
+	_, err := userFiles.Stat(ctx, source)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("%s doesn't exist, skipping waveform", source)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !force && isUpToDate(ctx, AudioFileContentKeyWaveformPNG(audioUUID.String()), source) {
+		log.Printf("Waveform for %s is up to date", audioUUID)
+		return nil
+	}
+	log.Printf("Generating waveform for %s", source)
+	input, err := ws.Fetch(ctx, source)
+	if err != nil {
+		return err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-i", input, "-ac", "1", "-ar", fmt.Sprintf("%d", waveformSampleRate), "-f", "s16le", "-")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		log.Printf("FFmpeg output for waveform: %s", stderr.Bytes())
+		return &commandError{fmt.Errorf("ffmpeg decoding for waveform failed: %v", err), stderr.Bytes()}
+	}
+	samples := make([]int16, stdout.Len()/2)
+	if err := binary.Read(&stdout, binary.LittleEndian, samples); err != nil {
+		return fmt.Errorf("Failed to read decoded audio: %v", err)
+	}
+	waveform := NewWaveform(samples, waveformSampleRate, waveformLength)
+
+	content, err := json.Marshal(waveform)
+	if err != nil {
+		return fmt.Errorf("Failed to marshal waveform: %v", err)
+	}
+	err = userFiles.Put(ctx, AudioFileContentKeyWaveformJSON(audioUUID.String()), bytes.NewReader(content))
+	if err != nil {
+		return fmt.Errorf("Failed to write waveform data: %v", err)
+	}
+
+	var image bytes.Buffer
+	if err := png.Encode(&image, waveform.Image(waveformPNGHeight)); err != nil {
+		return fmt.Errorf("Failed to encode waveform image: %v", err)
+	}
+	err = userFiles.Put(ctx, AudioFileContentKeyWaveformPNG(audioUUID.String()), &image)
+	if err != nil {
+		return fmt.Errorf("Failed to write waveform image: %v", err)
+	}
+	log.Printf("Generated waveform for %s", audioUUID)
+	return nil
+}
+
+// NewWaveform computes the peaks of mono 16-bit samples, using at most length pixels
+func NewWaveform(samples []int16, sampleRate int, length int) *Waveform {
+	perPixel := (len(samples) + length - 1) / length
+	if perPixel < 1 {
+		perPixel = 1
+	}
+	data := make([]int16, 0, 2*length)
+	for start := 0; start < len(samples); start += perPixel {
+		end := min(start+perPixel, len(samples))
+		low, high := samples[start], samples[start]
+		for _, s := range samples[start:end] {
+			low = min(low, s)
+			high = max(high, s)
+		}
+		data = append(data, low, high)
+	}
+	return &Waveform{
+		Bits:            16,
+		Channels:        1,
+		Data:            data,
+		Length:          len(data) / 2,
+		SampleRate:      sampleRate,
+		SamplesPerPixel: perPixel,
+		Version:         2,
+	}
+}
+
+// Image draws the waveform one pixel wide per peak on a transparent background
+func (w *Waveform) Image(height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, max(w.Length, 1), height))
+	middle := height / 2
+	for x := 0; x < w.Length; x++ {
+		top := middle - int(w.Data[2*x+1])*middle/32768
+		bottom := middle - int(w.Data[2*x])*middle/32768
+		// Always draw something so silence shows up as a flat line
+		if bottom <= top {
+			bottom = top + 1
+		}
+		for y := top; y < bottom && y < height; y++ {
+			img.Set(x, y, waveformColor)
+		}
+	}
+	return img
+}
@@ -0,0 +1,163 @@
+package fssync
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestXLSXColumn(t *testing.T) {
+	cases := map[int]string{
+		0:     "A",
+		1:     "B",
+		25:    "Z",
+		26:    "AA",
+		27:    "AB",
+		51:    "AZ",
+		52:    "BA",
+		701:   "ZZ",
+		702:   "AAA",
+		16383: "XFD",
+	}
+	for i, expected := range cases {
+		if column := xlsxColumn(i); column != expected {
+			t.Errorf("Got %s for column %d, expected %s", column, i, expected)
+		}
+	}
+}
+
+func TestXLSXDate(t *testing.T) {
+	pacific := time.FixedZone("PDT", -7*60*60)
+	cases := []struct {
+		time     time.Time
+		expected float64
+	}{
+		{time.Date(1899, time.December, 30, 0, 0, 0, 0, time.UTC), 0},
+		{time.Date(1900, time.March, 1, 0, 0, 0, 0, time.UTC), 61},
+		{time.Date(2025, time.June, 1, 0, 0, 0, 0, time.UTC), 45809},
+		{time.Date(2025, time.June, 1, 12, 0, 0, 0, time.UTC), 45809.5},
+		// The clock where it happened, not UTC
+		{time.Date(2025, time.June, 1, 18, 0, 0, 0, pacific), 45809.75},
+	}
+	for _, c := range cases {
+		if date := xlsxDate(c.time); date != c.expected {
+			t.Errorf("Got %v for %v, expected %v", date, c.time, c.expected)
+		}
+	}
+}
+
+// xlsxTestSheet is the part of sheet1.xml the export writes
+type xlsxTestSheet struct {
+	Rows []struct {
+		R     string `xml:"r,attr"`
+		Cells []struct {
+			R      string `xml:"r,attr"`
+			Style  string `xml:"s,attr"`
+			Type   string `xml:"t,attr"`
+			Value  string `xml:"v"`
+			Inline string `xml:"is>t"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+func TestXLSXExport(t *testing.T) {
+	var out bytes.Buffer
+	export, err := newXLSXExport(&out, "pointlocation & more, more than 31 characters")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := [][]any{
+		{"name", "active", "count", "depth", "inspected", "comments"},
+		{"North <pond>", true, int64(3), 1.5, time.Date(2025, time.June, 1, 12, 0, 0, 0, time.UTC), nil},
+		// Columns after the 26th need two letters
+		{nil, false, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, " spaced "},
+	}
+	for _, row := range rows {
+		if err := export.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := export.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatalf("Failed to open the workbook: %v", err)
+	}
+	parts := make(map[string][]byte)
+	for _, file := range archive.File {
+		f, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[file.Name], err = io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/workbook.xml", "xl/worksheets/sheet1.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("The workbook has no %s", name)
+		}
+	}
+
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := xml.Unmarshal(parts["xl/workbook.xml"], &workbook); err != nil {
+		t.Fatal(err)
+	}
+	if len(workbook.Sheets) != 1 || workbook.Sheets[0].Name != "pointlocation & more, more than" {
+		t.Errorf("Got sheets %+v", workbook.Sheets)
+	}
+
+	var sheet xlsxTestSheet
+	if err := xml.Unmarshal(parts["xl/worksheets/sheet1.xml"], &sheet); err != nil {
+		t.Fatalf("Failed to parse the sheet: %v", err)
+	}
+	type cell struct{ r, style, typ, value, inline string }
+	expected := [][]cell{
+		{
+			{"A1", "", "inlineStr", "", "name"},
+			{"B1", "", "inlineStr", "", "active"},
+			{"C1", "", "inlineStr", "", "count"},
+			{"D1", "", "inlineStr", "", "depth"},
+			{"E1", "", "inlineStr", "", "inspected"},
+			{"F1", "", "inlineStr", "", "comments"},
+		},
+		{
+			{"A2", "", "inlineStr", "", "North <pond>"},
+			{"B2", "", "b", "1", ""},
+			{"C2", "", "", "3", ""},
+			{"D2", "", "", "1.5", ""},
+			{"E2", "1", "", "45809.5", ""},
+		},
+		{
+			{"B3", "", "b", "0", ""},
+			{"AA3", "", "inlineStr", "", " spaced "},
+		},
+	}
+	if len(sheet.Rows) != len(expected) {
+		t.Fatalf("Got %d rows, expected %d", len(sheet.Rows), len(expected))
+	}
+	for i, row := range sheet.Rows {
+		if row.R != string(rune('1'+i)) {
+			t.Errorf("Got row %s at %d", row.R, i)
+		}
+		got := make([]cell, 0, len(row.Cells))
+		for _, c := range row.Cells {
+			got = append(got, cell{c.R, c.Style, c.Type, c.Value, c.Inline})
+		}
+		if !reflect.DeepEqual(got, expected[i]) {
+			t.Errorf("Got row %d %v, expected %v", i+1, got, expected[i])
+		}
+	}
+}